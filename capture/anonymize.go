@@ -0,0 +1,345 @@
+package capture
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Labels chosen by Anonymize for the names of players.
+const (
+	// LabelPseudonym replaces each name with a pseudonym derived from it,
+	// the same in every capture anonymized with the same key.
+	LabelPseudonym = "pseudonym"
+	// LabelRole replaces each name with the role and group of the unit the
+	// player had, such as "Medic (Alpha 1-1)". Names not tied to a unit get
+	// a pseudonym.
+	LabelRole = "role"
+)
+
+// ErrLabel is returned by Anonymize for an unknown label.
+var ErrLabel = errors.New("capture: unknown label")
+
+// AnonymizeResult describes an anonymized capture.
+type AnonymizeResult struct {
+	Header Header
+	// Names maps each name that was replaced to its replacement.
+	Names map[string]string
+}
+
+// Anonymize writes to dst a copy of the capture read from open in which the
+// names of players are replaced, according to label, by pseudonyms or role
+// labels: the names of their units, both in the entity and per frame in its
+// positions, the names in connection, capture and terminal hack events, and
+// their names in the text of markers. Markers placed by players still refer
+// to the player's unit, and thus to its new name. The copy is marked as
+// anonymized. key makes pseudonyms stable: the same name always gets the
+// same pseudonym with the same key, but cannot be guessed from it.
+//
+// The capture is read twice: first to find the names of players, then to copy
+// it.
+func Anonymize(dst io.Writer, open Source, label string, key []byte) (*AnonymizeResult, error) {
+	if label != LabelPseudonym && label != LabelRole {
+		return nil, fmt.Errorf("%w %q", ErrLabel, label)
+	}
+
+	a := anonymizer{
+		label: label,
+		key:   key,
+		names: make(map[string]string),
+		used:  make(map[string]int),
+	}
+	if err := a.scan(open); err != nil {
+		return nil, err
+	}
+
+	r, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	result := &AnonymizeResult{Header: Header{CaptureDelay: 1}, Names: a.names}
+	header := headerFields(&result.Header)
+	err = rewriteAppend(dst, r, func(key string, value json.RawMessage) (json.RawMessage, error) {
+		if key == "anonymized" {
+			return nil, nil
+		}
+		if dst, ok := header[key]; ok {
+			if err := json.Unmarshal(value, dst); err != nil {
+				return nil, err
+			}
+		}
+		return value, nil
+	}, map[string]elementFunc{
+		"entities": a.entity,
+		"events":   a.event,
+		"Markers":  a.marker,
+	}, map[string]json.RawMessage{
+		"anonymized": json.RawMessage("true"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Header.Anonymized = true
+	return result, nil
+}
+
+type anonymizer struct {
+	label string
+	key   []byte
+	names map[string]string // player name -> replacement
+	used  map[string]int    // replacement -> number of names given it
+	// longest holds the names, longest first, to be replaced in free text.
+	longest []string
+}
+
+// scan finds the names of players and chooses their replacements.
+func (a *anonymizer) scan(open Source) error {
+	r, err := open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// Per-frame names are those of whoever controlled the unit, so they are
+	// only known to be players' with the per-frame flag.
+	var controllers []string
+	_, err = Walk(r, Visitor{
+		Position: func(_, _ int, p *Position) error {
+			if p.IsPlayer == 1 && p.Name != "" {
+				controllers = append(controllers, p.Name)
+			}
+			return nil
+		},
+		Entity: func(_ int, e *Entity) error {
+			if e.Type != EntityUnit {
+				controllers = controllers[:0]
+				return nil
+			}
+			if e.IsPlayer == 1 && e.Name != "" {
+				a.add(e.Name, e)
+			}
+			for _, name := range controllers {
+				a.add(name, e)
+			}
+			controllers = controllers[:0]
+			return nil
+		},
+		Event: func(_ int, e *Event) error {
+			if name := eventPlayer(e); name != "" {
+				a.add(name, nil)
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	a.longest = make([]string, 0, len(a.names))
+	for name := range a.names {
+		a.longest = append(a.longest, name)
+	}
+	// Replace longer names first, so that a name containing another is
+	// replaced whole.
+	sort.Slice(a.longest, func(i, j int) bool {
+		if len(a.longest[i]) != len(a.longest[j]) {
+			return len(a.longest[i]) > len(a.longest[j])
+		}
+		return a.longest[i] < a.longest[j]
+	})
+	return nil
+}
+
+// add gives name a replacement, if it has none yet. unit is the unit the
+// player had, if known. Replacements given twice, which role labels often
+// are and pseudonyms almost never, get a number depending on the order the
+// names were found in.
+func (a *anonymizer) add(name string, unit *Entity) {
+	if _, ok := a.names[name]; ok {
+		return
+	}
+
+	var replacement string
+	if a.label == LabelRole && unit != nil {
+		role, _, _ := strings.Cut(unit.Role, "@")
+		if role = strings.TrimSpace(role); role == "" {
+			role = "Unit"
+		}
+		replacement = role
+		if unit.Group != "" {
+			replacement += " (" + unit.Group + ")"
+		}
+	} else {
+		mac := hmac.New(sha256.New, a.key)
+		mac.Write([]byte(name))
+		replacement = "Player " + hex.EncodeToString(mac.Sum(nil))[:10]
+	}
+
+	// Keep replacements distinct, so that players stay apart.
+	a.used[replacement]++
+	if n := a.used[replacement]; n > 1 {
+		replacement = fmt.Sprintf("%s %d", replacement, n)
+	}
+	a.names[name] = replacement
+}
+
+// eventPlayer returns the name of the player in a connection, capture or
+// terminal hack event.
+func eventPlayer(e *Event) string {
+	switch {
+	case e.Type == EventConnected || e.Type == EventDisconnected:
+		name, _ := e.Connection()
+		return name
+	case e.Type == EventCaptured || e.Type == EventCapturedFlag:
+		c, _ := e.Captured()
+		return c.Unit
+	case e.IsTerminalHack():
+		h, _ := e.TerminalHack()
+		return h.Unit
+	}
+	return ""
+}
+
+// replace returns the replacement of the name held in raw, or raw itself if
+// it is not the name of a player.
+func (a *anonymizer) replace(raw json.RawMessage) json.RawMessage {
+	var name string
+	if json.Unmarshal(raw, &name) != nil {
+		return raw
+	}
+	replacement, ok := a.names[name]
+	if !ok {
+		return raw
+	}
+	out, _ := json.Marshal(replacement)
+	return out
+}
+
+func (a *anonymizer) entity(elem json.RawMessage) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(elem, &fields); err != nil {
+		return nil, err
+	}
+	var e Entity
+	if err := json.Unmarshal(elem, &e); err != nil {
+		return nil, err
+	}
+	if e.Type != EntityUnit {
+		return elem, nil
+	}
+
+	fields["name"] = a.replace(fields["name"])
+	if raw, ok := fields["positions"]; ok {
+		var positions [][]json.RawMessage
+		if err := json.Unmarshal(raw, &positions); err != nil {
+			return nil, fmt.Errorf("entity %d positions: %w", e.ID, err)
+		}
+		for _, p := range positions {
+			if len(p) > 4 {
+				p[4] = a.replace(p[4])
+			}
+		}
+		fields["positions"], _ = json.Marshal(positions)
+	}
+	return json.Marshal(fields)
+}
+
+func (a *anonymizer) event(elem json.RawMessage) (json.RawMessage, error) {
+	var e Event
+	if json.Unmarshal(elem, &e) != nil || len(e.Fields) == 0 {
+		return elem, nil
+	}
+
+	// The index of the player's name in the payload of captures and hacks.
+	i := -1
+	switch {
+	case e.Type == EventConnected || e.Type == EventDisconnected:
+		e.Fields[0] = a.replace(e.Fields[0])
+	case e.Type == EventCaptured:
+		i = 1
+	case e.Type == EventCapturedFlag || e.IsTerminalHack():
+		i = 0
+	default:
+		return elem, nil
+	}
+
+	if i >= 0 {
+		var payload []json.RawMessage
+		if json.Unmarshal(e.Fields[0], &payload) != nil || i >= len(payload) {
+			return elem, nil
+		}
+		payload[i] = a.replace(payload[i])
+		e.Fields[0], _ = json.Marshal(payload)
+	}
+
+	fields := append([]json.RawMessage{rawInt(e.Frame), nil}, e.Fields...)
+	fields[1], _ = json.Marshal(e.Type)
+	return json.Marshal(fields)
+}
+
+func (a *anonymizer) marker(elem json.RawMessage) (json.RawMessage, error) {
+	var fields []json.RawMessage
+	if json.Unmarshal(elem, &fields) != nil || len(fields) < 2 {
+		return elem, nil
+	}
+	var text string
+	if json.Unmarshal(fields[1], &text) != nil || text == "" {
+		return elem, nil
+	}
+	fields[1], _ = json.Marshal(a.replaceText(text))
+	return json.Marshal(fields)
+}
+
+// replaceText replaces the names of players in text where they appear as
+// whole words, so that a name is not replaced inside a longer word.
+func (a *anonymizer) replaceText(text string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		name := a.nameAt(text, i)
+		if name == "" {
+			_, size := utf8.DecodeRuneInString(text[i:])
+			b.WriteString(text[i : i+size])
+			i += size
+			continue
+		}
+		b.WriteString(a.names[name])
+		i += len(name)
+	}
+	return b.String()
+}
+
+// nameAt returns the longest name of a player found as a whole word at index
+// i of text, or "".
+func (a *anonymizer) nameAt(text string, i int) string {
+	before, _ := utf8.DecodeLastRuneInString(text[:i])
+	for _, name := range a.longest {
+		if !strings.HasPrefix(text[i:], name) {
+			continue
+		}
+		first, _ := utf8.DecodeRuneInString(name)
+		last, _ := utf8.DecodeLastRuneInString(name)
+		after, _ := utf8.DecodeRuneInString(text[i+len(name):])
+		if i > 0 && isWord(before) && isWord(first) {
+			continue
+		}
+		if i+len(name) < len(text) && isWord(last) && isWord(after) {
+			continue
+		}
+		return name
+	}
+	return ""
+}
+
+func isWord(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
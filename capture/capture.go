@@ -0,0 +1,189 @@
+// Package capture describes the JSON format of OCAP captures and reads it.
+//
+// A capture is a JSON object, usually gzipped, with the top-level fields
+// worldName, missionName, captureDelay, endFrame, times, entities, events and
+// Markers, plus a few others written by newer versions of the recording
+// addon. Walk streams a capture to a Visitor one element at a time, so that
+// even captures of several hundred megabytes can be read in constant memory.
+// Validate checks a capture and reports every problem it finds with its
+// location. It is not as frugal: it reads each entity whole, since how its
+// positions are checked depends on its type, which may follow them, and it
+// keeps the frame and references of every entity and event to check them
+// once the whole capture has been read.
+package capture
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Header holds the scalar top-level fields of a capture.
+type Header struct {
+	WorldName        string  `json:"worldName"`
+	MissionName      string  `json:"missionName"`
+	MissionAuthor    string  `json:"missionAuthor"`
+	CaptureDelay     float64 `json:"captureDelay"`
+	EndFrame         int     `json:"endFrame"`
+	ExtensionVersion string  `json:"extensionVersion"`
+	AddonVersion     string  `json:"addonVersion"`
+	Tags             string  `json:"tags"`
+	// Anonymized is set on copies made by Anonymize.
+	Anonymized bool `json:"anonymized"`
+}
+
+// Entity holds the scalar fields of an element of the entities array.
+// Positions and framesFired are streamed separately.
+type Entity struct {
+	Type          string `json:"type"`
+	ID            int    `json:"id"`
+	Name          string `json:"name"`
+	Side          string `json:"side"`
+	Group         string `json:"group"`
+	Role          string `json:"role"`
+	Class         string `json:"class"`
+	IsPlayer      int    `json:"isPlayer"`
+	StartFrameNum int    `json:"startFrameNum"`
+}
+
+// Entity types.
+const (
+	EntityUnit    = "unit"
+	EntityVehicle = "vehicle"
+)
+
+// Sides used by entities.
+var Sides = []string{"WEST", "EAST", "GUER", "CIV", "UNKNOWN"}
+
+// Time is an element of the times array: the real and in-game time at a
+// frame.
+type Time struct {
+	FrameNum       int     `json:"frameNum"`
+	SystemTimeUTC  string  `json:"systemTimeUTC"`
+	Date           string  `json:"date"`
+	TimeMultiplier float64 `json:"timeMultiplier"`
+	Time           float64 `json:"time"`
+}
+
+// Shot is an element of an entity's framesFired array: [frameNum, [x, y, z]].
+type Shot struct {
+	Frame    int
+	Position []float64
+}
+
+// UnmarshalJSON decodes the array form of a shot. Frame is -1 and Position
+// empty when they cannot be read; Validate reports such elements.
+func (s *Shot) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	s.Frame = -1
+	s.Position = s.Position[:0]
+	if len(raw) > 0 && json.Unmarshal(raw[0], &s.Frame) != nil {
+		s.Frame = -1
+	}
+	if len(raw) > 1 && json.Unmarshal(raw[1], &s.Position) != nil {
+		s.Position = s.Position[:0]
+	}
+	return nil
+}
+
+// Marker is an element of the Markers array:
+// [type, text, startFrame, endFrame, playerId, color, side, positions,
+// size, shape, brush]. Size, shape and brush are missing from older
+// captures. PlayerID is -1 for markers not placed by a player, and Side is
+// -1 for global markers or the index of the side otherwise.
+type Marker struct {
+	Type       string
+	Text       string
+	StartFrame int
+	EndFrame   int
+	PlayerID   int
+	Color      string
+	Side       int
+	Positions  []MarkerPosition
+	Size       json.RawMessage
+	Shape      string
+	Brush      string
+}
+
+// MarkerPosition is one state of a marker: [frameNum, position, direction,
+// alpha]. Position is [x, y] for icons and a list of points for polylines.
+type MarkerPosition struct {
+	Frame     int
+	Position  json.RawMessage
+	Direction float64
+	Alpha     float64
+}
+
+// UnmarshalJSON decodes the array form of a marker.
+func (m *Marker) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw) < 8 {
+		return fmt.Errorf("marker has %d fields, want at least 8", len(raw))
+	}
+
+	fields := []struct {
+		name string
+		dst  any
+	}{
+		{"type", &m.Type},
+		{"text", &m.Text},
+		{"startFrame", &m.StartFrame},
+		{"endFrame", &m.EndFrame},
+		{"playerId", &m.PlayerID},
+		{"color", &m.Color},
+		{"side", &m.Side},
+		{"positions", &m.Positions},
+		{"size", &m.Size},
+		{"shape", &m.Shape},
+		{"brush", &m.Brush},
+	}
+	for i, f := range fields {
+		if i >= len(raw) {
+			break
+		}
+		if err := json.Unmarshal(raw[i], f.dst); err != nil {
+			return fmt.Errorf("marker %s: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSON decodes the array form of a marker position.
+func (p *MarkerPosition) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw) < 2 {
+		return fmt.Errorf("marker position has %d fields, want at least 2", len(raw))
+	}
+	if err := json.Unmarshal(raw[0], &p.Frame); err != nil {
+		return fmt.Errorf("marker position frame: %w", err)
+	}
+	p.Position = append(p.Position[:0], raw[1]...)
+	if len(raw) > 2 {
+		if err := json.Unmarshal(raw[2], &p.Direction); err != nil {
+			return fmt.Errorf("marker position direction: %w", err)
+		}
+	}
+	if len(raw) > 3 {
+		if err := json.Unmarshal(raw[3], &p.Alpha); err != nil {
+			return fmt.Errorf("marker position alpha: %w", err)
+		}
+	}
+	return nil
+}
+
+// isInt reports whether a JSON value is a plain integer, and returns it.
+func isInt(raw json.RawMessage) (int, bool) {
+	n, err := strconv.Atoi(string(bytes.TrimSpace(raw)))
+	return n, err == nil
+}
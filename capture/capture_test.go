@@ -0,0 +1,430 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCapture = `{
+	"worldName": "altis",
+	"missionName": "Test",
+	"captureDelay": 2,
+	"endFrame": 100,
+	"times": [{"frameNum": 0, "systemTimeUTC": "2024-01-01T20:00:00", "date": "2035-06-01", "timeMultiplier": 1, "time": 0}],
+	"entities": [
+		{"type": "unit", "id": 0, "name": "Alpha", "side": "WEST", "group": "A", "role": "Rifleman", "isPlayer": 1, "startFrameNum": 0,
+		 "positions": [[[1, 2], 90, 1, 0, "Alpha", 1], [], [[3, 4], 90, 2, 0, "Alpha", 1]],
+		 "framesFired": [[1, [1, 2, 0]], ["x", [1, 2, 0]]]},
+		{"type": "vehicle", "id": 1, "name": "Hunter", "class": "car", "startFrameNum": 5,
+		 "positions": [[[5, 6], 0, 1, [0], [5, 10]]], "framesFired": null}
+	],
+	"events": [
+		[10, "hit", 0, [1, "M2"], 120],
+		[11, "killed", 0, ["null"]],
+		[12, "connected", "Alpha"],
+		[20, "captured", ["flag", "Alpha", "#004C99", "#800000", [1, 2]]],
+		[30, "endMission", ["WEST", "Won"]]
+	],
+	"Markers": [["mil_dot", "Base", 0, 100, -1, "ColorBlue", -1, [[0, [1, 2], 0, 1]], [1, 1], "ICON", "Solid"]],
+	"extra": true
+}`
+
+func TestWalk(t *testing.T) {
+	var (
+		positions, shots, events int
+		entities                 []Entity
+		fields                   []string
+		hits                     []HitKilled
+	)
+	info, err := Walk(strings.NewReader(testCapture), Visitor{
+		Entity: func(_ int, e *Entity) error {
+			entities = append(entities, *e)
+			return nil
+		},
+		Position: func(entity, i int, p *Position) error {
+			positions++
+			if entity == 0 && i == 1 {
+				// An empty element repeats the previous one.
+				assert.Equal(t, 1.0, p.X)
+				assert.Equal(t, "Alpha", p.Name)
+			}
+			return nil
+		},
+		Shot: func(_ int, s *Shot) error {
+			shots++
+			return nil
+		},
+		Event: func(_ int, e *Event) error {
+			events++
+			if e.Type == EventHit || e.Type == EventKilled {
+				hk, err := e.HitKilled()
+				require.NoError(t, err)
+				hits = append(hits, hk)
+			}
+			return nil
+		},
+		Field: func(key string, _ json.RawMessage) error {
+			fields = append(fields, key)
+			return nil
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "altis", info.WorldName)
+	assert.Equal(t, 2.0, info.CaptureDelay)
+	assert.Equal(t, 2, info.Entities)
+	assert.Equal(t, 5, info.Events)
+	assert.Equal(t, 1, info.Markers)
+	assert.Equal(t, 1, info.Times)
+	assert.Equal(t, 4, positions)
+	assert.Equal(t, 2, shots)
+	assert.Equal(t, 5, events)
+	assert.Equal(t, []string{"extra"}, fields)
+
+	require.Len(t, entities, 2)
+	assert.Equal(t, "Alpha", entities[0].Name)
+	assert.Equal(t, "car", entities[1].Class)
+
+	require.Len(t, hits, 2)
+	assert.Equal(t, HitKilled{VictimID: 0, CausedByID: 1, Weapon: "M2", Distance: 120, HasDistance: true}, hits[0])
+	assert.Equal(t, HitKilled{VictimID: 0, CausedByID: -1, Weapon: "N/A"}, hits[1])
+
+	assert.True(t, info.Features.VehicleFrameRanges)
+	assert.True(t, info.Features.PlayerFlag)
+	assert.True(t, info.Features.Captured)
+	assert.False(t, info.Features.CapturedFlag)
+	assert.Equal(t, Version3, info.Version)
+}
+
+func TestWalkStop(t *testing.T) {
+	events := 0
+	_, err := Walk(strings.NewReader(testCapture), Visitor{
+		Event: func(int, *Event) error {
+			events++
+			return ErrStop
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, events)
+}
+
+func TestWalkHeaderEvents(t *testing.T) {
+	var (
+		delays []float64
+		frames []int
+	)
+	info, err := Walk(strings.NewReader(`{
+		"events": [[1, "hit", 0, [1, "M2"]], "bad", [2], [3, "endMission", ["WEST", "Won"]]],
+		"Markers": [["mil_dot", "Base"]],
+		"captureDelay": 2
+	}`), Visitor{
+		Header: func(key string, h *Header) error {
+			assert.Equal(t, "captureDelay", key)
+			delays = append(delays, h.CaptureDelay)
+			return nil
+		},
+		Event: func(_ int, e *Event) error {
+			frames = append(frames, e.Frame)
+			return nil
+		},
+	})
+	require.NoError(t, err)
+
+	// Events and markers that cannot be read are skipped.
+	assert.Equal(t, []int{1, 3}, frames)
+	assert.Equal(t, 2, info.Events)
+	assert.Equal(t, 0, info.Markers)
+	assert.Equal(t, []float64{2}, delays)
+}
+
+func TestVersion(t *testing.T) {
+	legacy := `{
+		"worldName": "stratis", "missionName": "Old", "captureDelay": 1, "endFrame": 10,
+		"entities": [{"type": "unit", "id": 0, "name": "A", "side": "EAST", "startFrameNum": 0, "positions": [[[1, 2], 0, 1, 0]]}],
+		"events": [[2, "capturedFlag", ["A", "#004C99", "#800000", [1, 2]]], [3, "killed", 0, ["null"]]]
+	}`
+	info, err := Walk(strings.NewReader(legacy), Visitor{})
+	require.NoError(t, err)
+	assert.True(t, info.Features.CapturedFlag)
+	assert.Equal(t, Version1, info.Version)
+
+	var e Event
+	require.NoError(t, e.UnmarshalJSON([]byte(`[2, "capturedFlag", ["A", "#004C99", "#800000", [1, 2]]]`)))
+	c, err := e.Captured()
+	require.NoError(t, err)
+	assert.Equal(t, "flag", c.Objective)
+	assert.Equal(t, "A", c.Unit)
+
+	// A malformed element does not hide the names of the elements after it.
+	named := `{
+		"entities": [{"type": "unit", "id": 0, "name": "A", "side": "EAST", "startFrameNum": 0,
+			"positions": [[[1, 2], 0, 1, [], "A"], [[1, 2], 0, 1, 0, "A"]]}]
+	}`
+	info, err = Walk(strings.NewReader(named), Visitor{})
+	require.NoError(t, err)
+	assert.True(t, info.Features.UnitNames)
+	assert.Equal(t, Version2, info.Version)
+
+	info, err = Walk(strings.NewReader(`{"worldName": "altis"}`), Visitor{})
+	require.NoError(t, err)
+	assert.Equal(t, VersionUnknown, info.Version)
+}
+
+func TestValidate(t *testing.T) {
+	// Walk skips the unreadable shot, Validate reports it.
+	report := Validate(strings.NewReader(testCapture))
+	assert.Equal(t, []Problem{{Path: "entities[0].framesFired[1]", Message: "want [frame, [x, y, z]]"}}, report.Problems)
+	assert.Equal(t, Version3, report.Info.Version)
+	assert.Equal(t, 5, report.Info.Events)
+
+	broken := `{
+		"worldName": "altis",
+		"captureDelay": 0,
+		"endFrame": 50,
+		"entities": [
+			{"type": "unit", "id": 0, "name": "A", "side": "WEST", "startFrameNum": 0, "positions": [[[1, 2], 0, 3, 0]]},
+			{"type": "unit", "id": 0, "name": "B", "side": "BLUE", "startFrameNum": 0, "positions": []},
+			{"type": "tank", "id": 2, "name": "C", "positions": []}
+		],
+		"events": [
+			[10, "killed", 7, [0, "AK"], 10],
+			[60, "connected", "A"],
+			[5, "endMission"]
+		]
+	}`
+	report = Validate(strings.NewReader(broken))
+	assert.False(t, report.Valid())
+	assert.Error(t, report.Err())
+
+	paths := make(map[string]string)
+	for _, p := range report.Problems {
+		paths[p.Path] = p.Message
+	}
+	assert.Contains(t, paths, "captureDelay")
+	assert.Contains(t, paths, "missionName")
+	assert.Contains(t, paths, "entities[0].positions[0][2]")
+	assert.Contains(t, paths, "entities[1].side")
+	assert.Equal(t, "duplicate id 0, also used by entities[0]", paths["entities[1].id"])
+	assert.Contains(t, paths, "entities[2].type")
+	assert.Contains(t, paths, "entities[2].startFrameNum")
+	assert.Equal(t, "unknown entity 7", paths["events[0][2]"])
+	assert.Equal(t, "frame 60 is after endFrame 50", paths["events[1][0]"])
+	assert.Contains(t, paths, "events[2]")
+	assert.Equal(t, 3, report.Info.Entities)
+	assert.Equal(t, 3, report.Info.Events)
+}
+
+func TestValidateMalformed(t *testing.T) {
+	report := Validate(strings.NewReader(`{"worldName": "altis", "entities": [{"type": `))
+	require.False(t, report.Valid())
+	assert.Contains(t, report.Problems[len(report.Problems)-1].Message, "malformed JSON")
+}
+
+func TestTrim(t *testing.T) {
+	var out bytes.Buffer
+	header, err := Trim(&out, strings.NewReader(testCapture), 1, 20)
+	require.NoError(t, err)
+	assert.Equal(t, 19, header.EndFrame)
+	assert.Equal(t, "altis", header.WorldName)
+
+	var trimmed struct {
+		EndFrame int               `json:"endFrame"`
+		Times    []Time            `json:"times"`
+		Entities []json.RawMessage `json:"entities"`
+		Events   []Event           `json:"events"`
+		Markers  []Marker          `json:"Markers"`
+		Extra    bool              `json:"extra"`
+	}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &trimmed))
+	assert.Equal(t, 19, trimmed.EndFrame)
+	assert.Empty(t, trimmed.Times)
+	assert.True(t, trimmed.Extra)
+
+	var unit struct {
+		StartFrameNum int               `json:"startFrameNum"`
+		Positions     []json.RawMessage `json:"positions"`
+		FramesFired   []Shot            `json:"framesFired"`
+	}
+	require.NoError(t, json.Unmarshal(trimmed.Entities[0], &unit))
+	assert.Equal(t, 0, unit.StartFrameNum)
+	// The empty element at frame 1 repeats frame 0, which was cut.
+	require.Len(t, unit.Positions, 2)
+	assert.JSONEq(t, `[[1, 2], 90, 1, 0, "Alpha", 1]`, string(unit.Positions[0]))
+	require.Len(t, unit.FramesFired, 1)
+	assert.Equal(t, 0, unit.FramesFired[0].Frame)
+
+	var vehicle struct {
+		StartFrameNum int               `json:"startFrameNum"`
+		Positions     []json.RawMessage `json:"positions"`
+	}
+	require.NoError(t, json.Unmarshal(trimmed.Entities[1], &vehicle))
+	assert.Equal(t, 4, vehicle.StartFrameNum)
+	require.Len(t, vehicle.Positions, 1)
+	assert.JSONEq(t, `[[5, 6], 0, 1, [0], [4, 9]]`, string(vehicle.Positions[0]))
+
+	frames := make([]int, len(trimmed.Events))
+	for i, e := range trimmed.Events {
+		frames[i] = e.Frame
+	}
+	// endMission at frame 30 is kept at the last frame.
+	assert.Equal(t, []int{9, 10, 11, 19, 19}, frames)
+
+	require.Len(t, trimmed.Markers, 1)
+	assert.Equal(t, 0, trimmed.Markers[0].StartFrame)
+	assert.Equal(t, 19, trimmed.Markers[0].EndFrame)
+	require.Len(t, trimmed.Markers[0].Positions, 1)
+	assert.Equal(t, 0, trimmed.Markers[0].Positions[0].Frame)
+
+	report := Validate(&out)
+	assert.Empty(t, report.Problems)
+
+	_, err = Trim(io.Discard, strings.NewReader(testCapture), 200, 300)
+	assert.ErrorIs(t, err, ErrFrameRange)
+	_, err = Trim(io.Discard, strings.NewReader(testCapture), 20, 10)
+	assert.ErrorIs(t, err, ErrFrameRange)
+}
+
+func TestMerge(t *testing.T) {
+	after := `{
+		"worldName": "altis", "missionName": "Test", "captureDelay": 1, "endFrame": 19,
+		"times": [{"frameNum": 0, "systemTimeUTC": "2024-01-01T21:00:00"}],
+		"entities": [
+			{"type": "unit", "id": 0, "name": "Rifleman", "side": "EAST", "isPlayer": 0, "startFrameNum": 0, "positions": [[[1, 1], 0, 1, 0, "Rifleman", 0], []]},
+			{"type": "unit", "id": 1, "name": "Alpha", "side": "WEST", "isPlayer": 1, "startFrameNum": 2, "positions": [[[5, 5], 0, 1, 0, "Alpha", 1], [], []], "framesFired": [[3, [5, 5, 0]]]}
+		],
+		"events": [[5, "killed", 0, [1, "MX"], 10], [19, "endMission", ["WEST", "Won"]]],
+		"Markers": []
+	}`
+	before := `{
+		"worldName": "Altis", "missionName": "Test", "captureDelay": 1, "endFrame": 9,
+		"times": [{"frameNum": 0, "systemTimeUTC": "2024-01-01T20:00:00"}],
+		"entities": [
+			{"type": "unit", "id": 0, "name": "Alpha", "side": "WEST", "isPlayer": 1, "startFrameNum": 0, "positions": [[[1, 2], 0, 1, 1, "Alpha", 1], [], [], [], []]},
+			{"type": "vehicle", "id": 1, "name": "Hunter", "class": "car", "startFrameNum": 0, "positions": [[[1, 2], 0, 1, [0], [0, 9]]]}
+		],
+		"events": [[1, "connected", "Alpha"], [4, "hit", 1, [0, "MX"], 3]],
+		"Markers": [["mil_dot", "Base", 0, -1, 0, "ColorBlue", 0, [[0, [1, 2], 0, 1]]]]
+	}`
+	source := func(s string) Source {
+		return func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(s)), nil }
+	}
+
+	var out bytes.Buffer
+	result, err := Merge(&out, []Source{source(after), source(before)})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 0}, result.Order)
+	assert.Equal(t, []int{10, 0}, result.Offsets)
+	assert.Equal(t, 29, result.Header.EndFrame)
+	assert.Equal(t, 1, result.Players)
+
+	report := Validate(bytes.NewReader(out.Bytes()))
+	assert.Empty(t, report.Problems)
+	assert.Equal(t, 29, report.Info.EndFrame)
+	assert.Equal(t, 3, report.Info.Entities)
+	assert.Equal(t, 2, report.Info.Times)
+
+	var merged struct {
+		Entities []struct {
+			ID            int               `json:"id"`
+			Name          string            `json:"name"`
+			StartFrameNum int               `json:"startFrameNum"`
+			Positions     []json.RawMessage `json:"positions"`
+			FramesFired   []Shot            `json:"framesFired"`
+		} `json:"entities"`
+		Events  []json.RawMessage `json:"events"`
+		Markers []Marker          `json:"Markers"`
+	}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &merged))
+
+	alpha := merged.Entities[0]
+	assert.Equal(t, "Alpha", alpha.Name)
+	// 5 positions, repeated until frame 12, then 3 more.
+	assert.Len(t, alpha.Positions, 15)
+	assert.JSONEq(t, `[[5, 5], 0, 1, 0, "Alpha", 1]`, string(alpha.Positions[12]))
+	require.Len(t, alpha.FramesFired, 1)
+	assert.Equal(t, 13, alpha.FramesFired[0].Frame)
+
+	assert.JSONEq(t, `[[1, 2], 0, 1, [0], [0, 9]]`, string(merged.Entities[1].Positions[0]))
+	assert.Equal(t, 2, merged.Entities[2].ID)
+	assert.Equal(t, "Rifleman", merged.Entities[2].Name)
+	assert.Equal(t, 10, merged.Entities[2].StartFrameNum)
+
+	require.Len(t, merged.Events, 4)
+	assert.JSONEq(t, `[4, "hit", 1, [0, "MX"], 3]`, string(merged.Events[1]))
+	assert.JSONEq(t, `[15, "killed", 2, [0, "MX"], 10]`, string(merged.Events[2]))
+	assert.JSONEq(t, `[29, "endMission", ["WEST", "Won"]]`, string(merged.Events[3]))
+
+	require.Len(t, merged.Markers, 1)
+	assert.Equal(t, 9, merged.Markers[0].EndFrame)
+
+	_, err = Merge(io.Discard, []Source{source(before), source(strings.Replace(after, "altis", "stratis", 1))})
+	assert.ErrorIs(t, err, ErrMismatch)
+}
+
+func TestAnonymize(t *testing.T) {
+	const in = `{
+		"worldName": "Altis", "missionName": "Test", "captureDelay": 1, "endFrame": 9, "anonymized": false,
+		"times": [],
+		"entities": [
+			{"type": "unit", "id": 0, "name": "Alpha", "side": "WEST", "group": "Alpha 1-1", "role": "Medic@Alpha 1-1", "isPlayer": 1, "startFrameNum": 0, "positions": [[[1, 2], 0, 1, 0, "Alpha", 1], [[1, 2], 0, 1, 0, "Bravo", 1]]},
+			{"type": "unit", "id": 1, "name": "Rifleman", "side": "EAST", "group": "Bravo 1-1", "role": "Rifleman", "isPlayer": 0, "startFrameNum": 0, "positions": [[[1, 1], 0, 1, 0, "Rifleman", 0]]},
+			{"type": "vehicle", "id": 2, "name": "Hunter", "class": "car", "startFrameNum": 0, "positions": [[[1, 2], 0, 1, [0], [0, 9]]]}
+		],
+		"events": [
+			[1, "connected", "Alpha"],
+			[2, "captured", ["Sector A", "Bravo", "#0000ff", "#ff0000", [1, 2]]],
+			[3, "killed", 1, [0, "MX"], 10]
+		],
+		"Markers": [
+			["mil_dot", "Alpha was here", 0, -1, 0, "ColorBlue", 0, [[0, [1, 2], 0, 1]]],
+			["mil_dot", "Alphabet, Bravo", 0, -1, 0, "ColorBlue", 0, [[0, [1, 2], 0, 1]]]
+		]
+	}`
+	source := func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(in)), nil }
+
+	anonymize := func(label string) (*AnonymizeResult, string) {
+		var out bytes.Buffer
+		result, err := Anonymize(&out, source, label, []byte("key"))
+		require.NoError(t, err)
+		assert.NotContains(t, out.String(), `"Alpha"`)
+		assert.NotContains(t, out.String(), `Bravo"`)
+		assert.NotContains(t, out.String(), "Alpha was")
+
+		report := Validate(bytes.NewReader(out.Bytes()))
+		assert.Empty(t, report.Problems)
+		assert.True(t, report.Info.Anonymized)
+		return result, out.String()
+	}
+
+	result, out := anonymize(LabelPseudonym)
+	assert.True(t, result.Header.Anonymized)
+	require.Len(t, result.Names, 2)
+	alpha := result.Names["Alpha"]
+	assert.Regexp(t, `^Player [0-9a-f]{10}$`, alpha)
+	assert.NotEqual(t, alpha, result.Names["Bravo"])
+	assert.Contains(t, out, `"name":"`+alpha+`"`)
+	assert.Contains(t, out, `"`+alpha+` was here"`)
+	// Names are replaced as whole words only.
+	assert.Contains(t, out, `"Alphabet, `+result.Names["Bravo"]+`"`)
+	// Vehicles and units of the AI keep their names.
+	assert.Contains(t, out, `"name":"Rifleman"`)
+	assert.Contains(t, out, `"name": "Hunter"`)
+
+	again, _ := anonymize(LabelPseudonym)
+	assert.Equal(t, result.Names, again.Names)
+
+	result, _ = anonymize(LabelRole)
+	assert.Equal(t, map[string]string{
+		"Alpha": "Medic (Alpha 1-1)",
+		"Bravo": "Medic (Alpha 1-1) 2",
+	}, result.Names)
+
+	_, err := Anonymize(io.Discard, source, "nickname", nil)
+	assert.ErrorIs(t, err, ErrLabel)
+}
@@ -0,0 +1,227 @@
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Event types.
+const (
+	EventHit                  = "hit"
+	EventKilled               = "killed"
+	EventConnected            = "connected"
+	EventDisconnected         = "disconnected"
+	EventCaptured             = "captured"
+	EventCapturedFlag         = "capturedFlag" // deprecated, see EventCaptured
+	EventTerminalHackStarted  = "terminalHackStarted"
+	EventTerminalHackCanceled = "terminalHackCanceled"
+	EventEndMission           = "endMission"
+)
+
+// Event is an element of the events array: [frameNum, type, ...]. Fields
+// holds the elements after the type, whose meaning depends on it; the typed
+// accessors decode them.
+type Event struct {
+	Frame  int
+	Type   string
+	Fields []json.RawMessage
+}
+
+// UnmarshalJSON decodes the array form of an event.
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw) < 2 {
+		return fmt.Errorf("event has %d fields, want at least 2", len(raw))
+	}
+	if err := json.Unmarshal(raw[0], &e.Frame); err != nil {
+		return fmt.Errorf("event frame: %w", err)
+	}
+	if err := json.Unmarshal(raw[1], &e.Type); err != nil {
+		return fmt.Errorf("event type: %w", err)
+	}
+	e.Fields = raw[2:]
+	return nil
+}
+
+// field returns the i-th element after the type, or an error naming it.
+func (e *Event) field(i int, name string) (json.RawMessage, error) {
+	if i >= len(e.Fields) {
+		return nil, fmt.Errorf("%s event has no %s", e.Type, name)
+	}
+	return e.Fields[i], nil
+}
+
+// HitKilled is the payload of a hit or killed event:
+// [frame, type, victimId, [causedById, weapon], distance]. The cause is
+// ["null"] when nothing identifiable caused the event; CausedByID is then -1
+// and Weapon "N/A". Older captures have no distance.
+type HitKilled struct {
+	VictimID    int
+	CausedByID  int
+	Weapon      string
+	Distance    float64
+	HasDistance bool
+}
+
+// HitKilled decodes the payload of a hit or killed event. It fails when the
+// victim cannot be identified.
+func (e *Event) HitKilled() (HitKilled, error) {
+	hk := HitKilled{CausedByID: -1, Weapon: "N/A"}
+
+	victim, err := e.field(0, "victim")
+	if err != nil {
+		return hk, err
+	}
+	if err := json.Unmarshal(victim, &hk.VictimID); err != nil {
+		return hk, fmt.Errorf("%s event victim: %w", e.Type, err)
+	}
+
+	causedBy, err := e.field(1, "cause")
+	if err != nil {
+		return hk, err
+	}
+	var causedByInfo []json.RawMessage
+	if err := json.Unmarshal(causedBy, &causedByInfo); err == nil && len(causedByInfo) >= 2 {
+		if err := json.Unmarshal(causedByInfo[0], &hk.CausedByID); err != nil {
+			hk.CausedByID = -1
+		}
+		if err := json.Unmarshal(causedByInfo[1], &hk.Weapon); err != nil {
+			hk.Weapon = "N/A"
+		}
+	}
+
+	if len(e.Fields) > 2 {
+		hk.HasDistance = json.Unmarshal(e.Fields[2], &hk.Distance) == nil
+	}
+
+	return hk, nil
+}
+
+// Connection returns the player name of a connected or disconnected event:
+// [frame, type, name].
+func (e *Event) Connection() (string, error) {
+	raw, err := e.field(0, "name")
+	if err != nil {
+		return "", err
+	}
+	var name string
+	if err := json.Unmarshal(raw, &name); err != nil {
+		return "", fmt.Errorf("%s event name: %w", e.Type, err)
+	}
+	return name, nil
+}
+
+// EndMission is the payload of an endMission event: [frame, type,
+// [side, message]].
+type EndMission struct {
+	Side    string
+	Message string
+}
+
+// EndMission decodes the payload of an endMission event.
+func (e *Event) EndMission() (EndMission, error) {
+	raw, err := e.field(0, "result")
+	if err != nil {
+		return EndMission{}, err
+	}
+	var end [2]string
+	if err := json.Unmarshal(raw, &end); err != nil {
+		return EndMission{}, fmt.Errorf("%s event result: %w", e.Type, err)
+	}
+	return EndMission{Side: end[0], Message: end[1]}, nil
+}
+
+// Captured is the payload of a captured event: [frame, type, [objective,
+// unit, unitColor, objectiveColor, position]]. The deprecated capturedFlag
+// event has no objective, which is then "flag".
+type Captured struct {
+	Objective      string
+	Unit           string
+	UnitColor      string
+	ObjectiveColor string
+	Position       []float64
+}
+
+// Captured decodes the payload of a captured or capturedFlag event.
+func (e *Event) Captured() (Captured, error) {
+	raw, err := e.field(0, "payload")
+	if err != nil {
+		return Captured{}, err
+	}
+	var fields []json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return Captured{}, fmt.Errorf("%s event payload: %w", e.Type, err)
+	}
+
+	c := Captured{Objective: "flag"}
+	dsts := []any{&c.Unit, &c.UnitColor, &c.ObjectiveColor, &c.Position}
+	names := []string{"unit", "unit color", "objective color", "position"}
+	if e.Type != EventCapturedFlag {
+		dsts = append([]any{&c.Objective}, dsts...)
+		names = append([]string{"objective"}, names...)
+	}
+	if len(fields) < len(dsts) {
+		return c, fmt.Errorf("%s event payload has %d fields, want %d", e.Type, len(fields), len(dsts))
+	}
+	for i, dst := range dsts {
+		if err := json.Unmarshal(fields[i], dst); err != nil {
+			return c, fmt.Errorf("%s event %s: %w", e.Type, names[i], err)
+		}
+	}
+	return c, nil
+}
+
+// TerminalHack is the payload of the terminal hack events: [frame, type,
+// [unit, unitColor, terminalColor, terminal, position, countdown]] when a
+// hack starts, and [... terminal, state] when it is canceled.
+type TerminalHack struct {
+	Unit          string
+	UnitColor     string
+	TerminalColor string
+	Terminal      string
+	Position      []float64 // started only
+	Countdown     float64   // started only
+	State         string    // canceled only
+}
+
+// IsTerminalHack reports whether the event is one of the terminal hack
+// events.
+func (e *Event) IsTerminalHack() bool {
+	return strings.HasPrefix(e.Type, "terminalHack")
+}
+
+// TerminalHack decodes the payload of a terminal hack event.
+func (e *Event) TerminalHack() (TerminalHack, error) {
+	raw, err := e.field(0, "payload")
+	if err != nil {
+		return TerminalHack{}, err
+	}
+	var fields []json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return TerminalHack{}, fmt.Errorf("%s event payload: %w", e.Type, err)
+	}
+
+	var h TerminalHack
+	dsts := []any{&h.Unit, &h.UnitColor, &h.TerminalColor, &h.Terminal}
+	names := []string{"unit", "unit color", "terminal color", "terminal"}
+	if e.Type == EventTerminalHackStarted {
+		dsts = append(dsts, &h.Position, &h.Countdown)
+		names = append(names, "position", "countdown")
+	} else {
+		dsts = append(dsts, &h.State)
+		names = append(names, "state")
+	}
+	if len(fields) < len(dsts) {
+		return h, fmt.Errorf("%s event payload has %d fields, want %d", e.Type, len(fields), len(dsts))
+	}
+	for i, dst := range dsts {
+		if err := json.Unmarshal(fields[i], dst); err != nil {
+			return h, fmt.Errorf("%s event %s: %w", e.Type, names[i], err)
+		}
+	}
+	return h, nil
+}
@@ -0,0 +1,500 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ErrMismatch is returned by Merge for captures that cannot be merged: of
+// different worlds, or recorded with different capture delays.
+var ErrMismatch = errors.New("capture: captures do not match")
+
+// Source opens one of the captures to merge. Merge opens each capture twice.
+type Source func() (io.ReadCloser, error)
+
+// MergeResult describes a merged capture.
+type MergeResult struct {
+	Header Header
+	// Order lists the indexes of the sources in the order they were merged.
+	Order []int
+	// Offsets holds the frame each source starts at in the merged capture,
+	// by source index.
+	Offsets []int
+	// Players is the number of player units found in several captures and
+	// merged into one entity.
+	Players int
+}
+
+// Merge writes to dst the captures of one mission, split by a server
+// restart, as a single capture. The captures are put in time order, by the
+// real time of their first frame, and each starts on the frame after the end
+// of the previous one. Entities are renumbered, and player units are merged
+// with the unit of the same name in an earlier capture, their positions in
+// between repeating the last one. The header and other top-level fields are
+// taken from the earliest capture.
+//
+// Only the entities are streamed, from a second read of each capture; times,
+// events, markers and the units of players are kept in memory while merging.
+func Merge(dst io.Writer, sources []Source) (*MergeResult, error) {
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("%w: nothing to merge", ErrMismatch)
+	}
+
+	parts := make([]*mergePart, len(sources))
+	for i, open := range sources {
+		p, err := scanMergePart(open)
+		if err != nil {
+			return nil, fmt.Errorf("capture %d: %w", i, err)
+		}
+		p.index = i
+		parts[i] = p
+	}
+
+	m, err := newMerger(parts)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.write(dst, sources); err != nil {
+		return nil, err
+	}
+	return m.result(), nil
+}
+
+// mergeEntity is what the first read keeps of an entity.
+type mergeEntity struct {
+	Entity
+	// raw is the whole entity, kept for player units only.
+	raw map[string]json.RawMessage
+}
+
+// mergePart is one of the captures being merged.
+type mergePart struct {
+	index     int
+	header    Header
+	fields    []rawField // top-level fields other than the arrays below
+	firstTime string     // systemTimeUTC of the first element of times
+	times     []json.RawMessage
+	entities  []mergeEntity
+	events    []json.RawMessage
+	markers   []json.RawMessage
+
+	offset int
+	// end is the last frame of the part in the merged capture, or -1 for
+	// the last part.
+	end int
+	ids map[int]int // entity ID -> merged ID
+}
+
+type rawField struct {
+	key   string
+	value json.RawMessage
+}
+
+// scanMergePart reads a capture for the first time.
+func scanMergePart(open Source) (*mergePart, error) {
+	r, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	p := &mergePart{header: Header{CaptureDelay: 1}}
+	header := headerFields(&p.header)
+	keep := func(list *[]json.RawMessage) elementFunc {
+		return func(elem json.RawMessage) (json.RawMessage, error) {
+			*list = append(*list, elem)
+			return nil, nil
+		}
+	}
+
+	err = rewrite(io.Discard, r, func(key string, value json.RawMessage) (json.RawMessage, error) {
+		if dst, ok := header[key]; ok {
+			if err := json.Unmarshal(value, dst); err != nil {
+				return nil, err
+			}
+		}
+		p.fields = append(p.fields, rawField{key: key, value: value})
+		return nil, nil
+	}, map[string]elementFunc{
+		"times":    keep(&p.times),
+		"entities": p.addEntity,
+		"events":   keep(&p.events),
+		"Markers":  keep(&p.markers),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(p.times) > 0 {
+		var t Time
+		if json.Unmarshal(p.times[0], &t) == nil {
+			p.firstTime = t.SystemTimeUTC
+		}
+	}
+	return p, nil
+}
+
+func (p *mergePart) addEntity(elem json.RawMessage) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(elem, &fields); err != nil {
+		return nil, err
+	}
+	var e mergeEntity
+	if err := json.Unmarshal(elem, &e.Entity); err != nil {
+		return nil, err
+	}
+	if e.Type == EntityUnit && e.IsPlayer == 1 {
+		e.raw = fields
+	}
+	p.entities = append(p.entities, e)
+	return nil, nil
+}
+
+type merger struct {
+	parts []*mergePart
+	// merged lists, by merged ID, the entities it is made of as
+	// [part, index in part.entities].
+	merged  [][][2]int
+	players int
+}
+
+func newMerger(parts []*mergePart) (*merger, error) {
+	ordered := make([]*mergePart, len(parts))
+	copy(ordered, parts)
+
+	// Order by the time of the first frame, if every capture has one.
+	dated := true
+	for _, p := range ordered {
+		dated = dated && p.firstTime != ""
+	}
+	if dated {
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return ordered[i].firstTime < ordered[j].firstTime
+		})
+	}
+
+	first := ordered[0].header
+	for _, p := range ordered[1:] {
+		if !strings.EqualFold(p.header.WorldName, first.WorldName) {
+			return nil, fmt.Errorf("%w: world %s, want %s", ErrMismatch, p.header.WorldName, first.WorldName)
+		}
+		if p.header.CaptureDelay != first.CaptureDelay {
+			return nil, fmt.Errorf("%w: capture delay %v, want %v", ErrMismatch, p.header.CaptureDelay, first.CaptureDelay)
+		}
+	}
+
+	m := &merger{parts: ordered}
+	players := make(map[string]int) // player name -> merged ID
+	offset := 0
+	for pi, p := range ordered {
+		p.offset = offset
+		offset += p.header.EndFrame + 1
+		p.end = offset - 1
+		if pi == len(ordered)-1 {
+			p.end = -1
+		}
+		p.ids = make(map[int]int, len(p.entities))
+
+		// A player has a single unit per capture.
+		seen := make(map[string]bool)
+		for ei, e := range p.entities {
+			if e.raw != nil && e.Name != "" && !seen[e.Name] {
+				seen[e.Name] = true
+				if id, ok := players[e.Name]; ok {
+					p.ids[e.ID] = id
+					m.merged[id] = append(m.merged[id], [2]int{pi, ei})
+					m.players++
+					continue
+				}
+				players[e.Name] = len(m.merged)
+			}
+			p.ids[e.ID] = len(m.merged)
+			m.merged = append(m.merged, [][2]int{{pi, ei}})
+		}
+	}
+	return m, nil
+}
+
+func (m *merger) result() *MergeResult {
+	last := m.parts[len(m.parts)-1]
+	r := &MergeResult{
+		Header:  m.parts[0].header,
+		Order:   make([]int, len(m.parts)),
+		Offsets: make([]int, len(m.parts)),
+		Players: m.players,
+	}
+	r.Header.EndFrame = last.offset + last.header.EndFrame
+	for i, p := range m.parts {
+		r.Order[i] = p.index
+		r.Offsets[p.index] = p.offset
+	}
+	return r
+}
+
+func (m *merger) write(dst io.Writer, sources []Source) error {
+	w := bufio.NewWriter(dst)
+	w.WriteByte('{')
+	written := 0
+
+	result := m.result()
+	for _, f := range m.parts[0].fields {
+		writeKey(w, &written, f.key)
+		if f.key == "endFrame" {
+			w.Write(rawInt(result.Header.EndFrame))
+		} else {
+			w.Write(f.value)
+		}
+	}
+
+	writeKey(w, &written, "times")
+	if err := m.writeArray(w, (*mergePart).time, func(p *mergePart) []json.RawMessage { return p.times }); err != nil {
+		return err
+	}
+
+	writeKey(w, &written, "entities")
+	w.WriteByte('[')
+	a := arrayWriter{w: w}
+	for pi, p := range m.parts {
+		if err := m.writeEntities(&a, pi, sources[p.index]); err != nil {
+			return fmt.Errorf("capture %d: %w", p.index, err)
+		}
+	}
+	w.WriteByte(']')
+
+	writeKey(w, &written, "events")
+	if err := m.writeArray(w, (*mergePart).event, func(p *mergePart) []json.RawMessage { return p.events }); err != nil {
+		return err
+	}
+
+	writeKey(w, &written, "Markers")
+	if err := m.writeArray(w, (*mergePart).marker, func(p *mergePart) []json.RawMessage { return p.markers }); err != nil {
+		return err
+	}
+
+	w.WriteByte('}')
+	return w.Flush()
+}
+
+// writeArray writes the elements of every part, from list, passed through
+// fn.
+func (m *merger) writeArray(w *bufio.Writer, fn func(*mergePart, json.RawMessage) (json.RawMessage, error), list func(*mergePart) []json.RawMessage) error {
+	w.WriteByte('[')
+	a := arrayWriter{w: w}
+	for _, p := range m.parts {
+		for _, elem := range list(p) {
+			out, err := fn(p, elem)
+			if err != nil {
+				return fmt.Errorf("capture %d: %w", p.index, err)
+			}
+			if out != nil {
+				a.add(out)
+			}
+		}
+	}
+	w.WriteByte(']')
+	return nil
+}
+
+// writeEntities reads the entities of part pi again and writes those that
+// start a merged entity.
+func (m *merger) writeEntities(a *arrayWriter, pi int, open Source) error {
+	r, err := open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	p := m.parts[pi]
+	ei := 0
+	return rewrite(io.Discard, r, nil, map[string]elementFunc{
+		"entities": func(elem json.RawMessage) (json.RawMessage, error) {
+			defer func() { ei++ }()
+			id := p.ids[p.entities[ei].ID]
+			if m.merged[id][0] != [2]int{pi, ei} {
+				// Part of a player's unit from an earlier capture.
+				return nil, nil
+			}
+
+			fields := p.entities[ei].raw
+			if fields == nil {
+				if err := json.Unmarshal(elem, &fields); err != nil {
+					return nil, err
+				}
+			}
+			out, err := m.entity(id, fields)
+			if err != nil {
+				return nil, err
+			}
+			a.add(out)
+			return nil, nil
+		},
+	})
+}
+
+// entity builds merged entity id, whose first part has fields.
+func (m *merger) entity(id int, fields map[string]json.RawMessage) (json.RawMessage, error) {
+	parts := m.merged[id]
+	first := m.parts[parts[0][0]]
+	e := first.entities[parts[0][1]]
+
+	var positions []json.RawMessage
+	if raw, ok := fields["positions"]; ok {
+		if err := json.Unmarshal(raw, &positions); err != nil {
+			return nil, fmt.Errorf("entity %d positions: %w", e.ID, err)
+		}
+	}
+	for i, pos := range positions {
+		positions[i] = first.position(pos)
+	}
+	shots := first.shots(fields["framesFired"])
+
+	start := first.offset + e.StartFrameNum
+	for _, ref := range parts[1:] {
+		p := m.parts[ref[0]]
+		part := p.entities[ref[1]]
+
+		// Repeat the last position until the unit is back.
+		partStart := p.offset + part.StartFrameNum
+		if len(positions) == 0 {
+			start = partStart
+		}
+		for frame := start + len(positions); frame < partStart; frame++ {
+			positions = append(positions, json.RawMessage("[]"))
+		}
+		var partPositions []json.RawMessage
+		if err := json.Unmarshal(part.raw["positions"], &partPositions); err != nil {
+			return nil, fmt.Errorf("entity %d positions: %w", part.ID, err)
+		}
+		positions = append(positions, partPositions...)
+		shots = append(shots, p.shots(part.raw["framesFired"])...)
+	}
+
+	fields["id"] = rawInt(id)
+	fields["startFrameNum"] = rawInt(start)
+	fields["positions"], _ = json.Marshal(positions)
+	if shots != nil || fields["framesFired"] != nil {
+		fields["framesFired"], _ = json.Marshal(shots)
+	}
+	return json.Marshal(fields)
+}
+
+// remap returns the merged ID of the entity ID held in raw, or raw itself
+// when it is not the ID of an entity.
+func (p *mergePart) remap(raw json.RawMessage) json.RawMessage {
+	if id, ok := isInt(raw); ok {
+		if merged, ok := p.ids[id]; ok {
+			return rawInt(merged)
+		}
+	}
+	return raw
+}
+
+// frame offsets the frame number held in raw.
+func (p *mergePart) frame(raw json.RawMessage) json.RawMessage {
+	if frame, ok := isInt(raw); ok {
+		return rawInt(frame + p.offset)
+	}
+	return raw
+}
+
+func (p *mergePart) time(elem json.RawMessage) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(elem, &fields); err != nil {
+		return nil, err
+	}
+	if raw, ok := fields["frameNum"]; ok {
+		fields["frameNum"] = p.frame(raw)
+	}
+	return json.Marshal(fields)
+}
+
+// position offsets the frame range of a vehicle position and renumbers its
+// crew.
+func (p *mergePart) position(elem json.RawMessage) json.RawMessage {
+	var fields []json.RawMessage
+	if json.Unmarshal(elem, &fields) != nil || len(fields) < 4 {
+		return elem
+	}
+
+	var crew []json.RawMessage
+	if json.Unmarshal(fields[3], &crew) == nil {
+		for i, id := range crew {
+			crew[i] = p.remap(id)
+		}
+		fields[3], _ = json.Marshal(crew)
+	}
+	if frames, ok := frameRange(fields); ok {
+		fields[4], _ = json.Marshal([2]int{frames[0] + p.offset, frames[1] + p.offset})
+	}
+
+	out, _ := json.Marshal(fields)
+	return out
+}
+
+// shots offsets the frames of a framesFired array.
+func (p *mergePart) shots(raw json.RawMessage) [][]json.RawMessage {
+	var shots [][]json.RawMessage
+	if raw == nil || json.Unmarshal(raw, &shots) != nil {
+		return nil
+	}
+	for _, shot := range shots {
+		if len(shot) > 0 {
+			shot[0] = p.frame(shot[0])
+		}
+	}
+	return shots
+}
+
+func (p *mergePart) event(elem json.RawMessage) (json.RawMessage, error) {
+	var fields []json.RawMessage
+	if json.Unmarshal(elem, &fields) != nil || len(fields) < 2 {
+		return nil, nil
+	}
+	fields[0] = p.frame(fields[0])
+
+	var e Event
+	if json.Unmarshal(elem, &e) == nil && (e.Type == EventHit || e.Type == EventKilled) && len(fields) > 3 {
+		fields[2] = p.remap(fields[2])
+		var causedBy []json.RawMessage
+		if json.Unmarshal(fields[3], &causedBy) == nil && len(causedBy) > 0 {
+			causedBy[0] = p.remap(causedBy[0])
+			fields[3], _ = json.Marshal(causedBy)
+		}
+	}
+	return json.Marshal(fields)
+}
+
+func (p *mergePart) marker(elem json.RawMessage) (json.RawMessage, error) {
+	var fields []json.RawMessage
+	if json.Unmarshal(elem, &fields) != nil || len(fields) < 8 {
+		return nil, nil
+	}
+
+	fields[2] = p.frame(fields[2])
+	// An endFrame of -1 keeps the marker until the end, which for all but
+	// the last capture is the end of the capture.
+	if end, ok := isInt(fields[3]); ok && end >= 0 {
+		fields[3] = p.frame(fields[3])
+	} else if ok {
+		fields[3] = rawInt(p.end)
+	}
+	if player, ok := isInt(fields[4]); ok && player >= 0 {
+		fields[4] = p.remap(fields[4])
+	}
+
+	var positions [][]json.RawMessage
+	if json.Unmarshal(fields[7], &positions) == nil {
+		for _, pos := range positions {
+			if len(pos) > 0 {
+				pos[0] = p.frame(pos[0])
+			}
+		}
+		fields[7], _ = json.Marshal(positions)
+	}
+	return json.Marshal(fields)
+}
@@ -0,0 +1,88 @@
+package capture
+
+import "encoding/json"
+
+// Position is one element of an entity's positions array. Units store
+// [pos, dir, alive, isInVehicle, name, isPlayer]; vehicles store
+// [pos, dir, alive, crew, [startFrame, endFrame]]. An empty element repeats
+// the previous state.
+type Position struct {
+	X, Y      float64
+	Direction float64
+	Alive     int
+	InVehicle bool
+	Crew      []int
+	Name      string
+	// IsPlayer is -1 when the element does not carry the per-frame flag.
+	IsPlayer int
+	// Frames is the inclusive frame range covered by the element, for
+	// vehicles recorded with one; otherwise both are -1.
+	Frames [2]int
+	// Fields is the number of fields of the last non-empty element.
+	Fields int
+
+	// hasCrew reports whether the last non-empty element carried a crew
+	// list. Crew itself is reused between elements, so it cannot tell.
+	hasCrew bool
+}
+
+// Values of the alive field of a unit position.
+const (
+	StateDead        = 0
+	StateAlive       = 1
+	StateUnconscious = 2
+)
+
+// UnmarshalJSON decodes the array form of a position. Fields that are missing
+// or of an unexpected type keep the value of the previous element, which is
+// how the viewer treats them too. Validate reports such elements.
+func (p *Position) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+
+	p.Fields = len(raw)
+	p.IsPlayer = -1
+	p.Frames = [2]int{-1, -1}
+	p.Crew = p.Crew[:0]
+	p.hasCrew = false
+
+	var coords []float64
+	if json.Unmarshal(raw[0], &coords) == nil && len(coords) >= 2 {
+		p.X, p.Y = coords[0], coords[1]
+	}
+	if len(raw) > 1 {
+		json.Unmarshal(raw[1], &p.Direction) //nolint:errcheck // keep previous on error
+	}
+	if len(raw) > 2 {
+		json.Unmarshal(raw[2], &p.Alive) //nolint:errcheck // keep previous on error
+	}
+	if len(raw) > 3 {
+		// A flag for units, the list of crew IDs for vehicles.
+		var flag int
+		if json.Unmarshal(raw[3], &flag) == nil {
+			p.InVehicle = flag != 0
+		} else {
+			p.hasCrew = json.Unmarshal(raw[3], &p.Crew) == nil
+		}
+	}
+	if len(raw) > 4 {
+		var frames []int
+		if json.Unmarshal(raw[4], &frames) == nil && len(frames) == 2 {
+			p.Frames = [2]int{frames[0], frames[1]}
+		} else {
+			json.Unmarshal(raw[4], &p.Name) //nolint:errcheck // keep previous on error
+		}
+	}
+	if len(raw) > 5 {
+		if json.Unmarshal(raw[5], &p.IsPlayer) != nil {
+			p.IsPlayer = -1
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// fieldFunc returns the value to write for a top-level field, or nil to drop
+// it.
+type fieldFunc func(key string, value json.RawMessage) (json.RawMessage, error)
+
+// elementFunc returns the element to write in place of elem, or nil to drop
+// it.
+type elementFunc func(elem json.RawMessage) (json.RawMessage, error)
+
+// rewrite copies the capture read from src to dst, one top-level field at a
+// time so that large captures are never held in memory. Every field is passed
+// through field, if set, except for the arrays named in elements, which are
+// streamed one element at a time through their function instead.
+func rewrite(dst io.Writer, src io.Reader, field fieldFunc, elements map[string]elementFunc) error {
+	return rewriteAppend(dst, src, field, elements, nil)
+}
+
+// rewriteAppend is rewrite, adding the fields in extra after those of src.
+// field should drop any field of src that extra replaces.
+func rewriteAppend(dst io.Writer, src io.Reader, field fieldFunc, elements map[string]elementFunc, extra map[string]json.RawMessage) error {
+	dec := json.NewDecoder(src)
+	w := bufio.NewWriter(dst)
+
+	if tok, err := dec.Token(); err != nil {
+		return fmt.Errorf("read opening brace: %w", err)
+	} else if tok != json.Delim('{') {
+		return fmt.Errorf("capture is not a JSON object")
+	}
+	w.WriteByte('{')
+
+	written := 0
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("read key: %w", err)
+		}
+		key, _ := tok.(string)
+
+		if fn, ok := elements[key]; ok {
+			writeKey(w, &written, key)
+			if err := rewriteArray(dec, w, key, fn); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return fmt.Errorf("decode %s: %w", key, err)
+		}
+		if field != nil {
+			if value, err = field(key, value); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+		if value != nil {
+			writeKey(w, &written, key)
+			w.Write(value)
+		}
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("read closing brace: %w", err)
+	}
+	keys := make([]string, 0, len(extra))
+	for key := range extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		writeKey(w, &written, key)
+		w.Write(extra[key])
+	}
+	w.WriteByte('}')
+	return w.Flush()
+}
+
+func writeKey(w *bufio.Writer, written *int, key string) {
+	if *written > 0 {
+		w.WriteByte(',')
+	}
+	*written++
+	quoted, _ := json.Marshal(key)
+	w.Write(quoted)
+	w.WriteByte(':')
+}
+
+// rewriteArray streams the array dec is positioned at through fn. A null
+// array is written as an empty one.
+func rewriteArray(dec *json.Decoder, w *bufio.Writer, name string, fn elementFunc) error {
+	w.WriteByte('[')
+	a := arrayWriter{w: w}
+	err := eachElement(dec, name, func(i int) error {
+		var elem json.RawMessage
+		if err := dec.Decode(&elem); err != nil {
+			return err
+		}
+		out, err := fn(elem)
+		if err != nil || out == nil {
+			return err
+		}
+		a.add(out)
+		return nil
+	})
+	w.WriteByte(']')
+	return err
+}
+
+// arrayWriter writes the elements of a JSON array, without its brackets.
+type arrayWriter struct {
+	w *bufio.Writer
+	n int
+}
+
+func (a *arrayWriter) add(elem json.RawMessage) {
+	if a.n > 0 {
+		a.w.WriteByte(',')
+	}
+	a.n++
+	a.w.Write(elem)
+}
+
+// rawInt encodes n as a JSON number.
+func rawInt(n int) json.RawMessage {
+	return json.RawMessage(strconv.Itoa(n))
+}
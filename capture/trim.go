@@ -0,0 +1,272 @@
+package capture
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrFrameRange is returned by Trim when the frame range selects nothing.
+var ErrFrameRange = errors.New("capture: invalid frame range")
+
+// Trim writes to dst the part of the capture read from src between frames
+// from and to, inclusive, rebasing every frame number so that from becomes
+// frame 0. Entities keep their IDs, which the viewer uses as indexes, so
+// entities outside the range are kept with no positions. An endMission event
+// after the range is moved to its last frame, so that the result of the
+// mission is not lost, while events and markers that cannot be read are
+// dropped. Trim returns the header of the trimmed capture.
+func Trim(dst io.Writer, src io.Reader, from, to int) (*Header, error) {
+	if from < 0 || to < from {
+		return nil, ErrFrameRange
+	}
+
+	t := trimmer{from: from, to: to}
+	t.header.CaptureDelay = 1
+	err := rewrite(dst, src, t.field, map[string]elementFunc{
+		"times":    t.time,
+		"entities": t.entity,
+		"events":   t.event,
+		"Markers":  t.marker,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &t.header, nil
+}
+
+type trimmer struct {
+	from, to int
+	header   Header
+}
+
+// frame rebases an absolute frame known to be in the range.
+func (t *trimmer) frame(frame int) json.RawMessage {
+	return rawInt(frame - t.from)
+}
+
+func (t *trimmer) field(key string, value json.RawMessage) (json.RawMessage, error) {
+	dst, ok := headerFields(&t.header)[key]
+	if !ok {
+		return value, nil
+	}
+	if err := json.Unmarshal(value, dst); err != nil {
+		return nil, err
+	}
+	if key != "endFrame" {
+		return value, nil
+	}
+
+	if t.header.EndFrame < t.from {
+		return nil, fmt.Errorf("%w: capture ends at frame %d", ErrFrameRange, t.header.EndFrame)
+	}
+	t.header.EndFrame = minInt(t.header.EndFrame, t.to) - t.from
+	return rawInt(t.header.EndFrame), nil
+}
+
+func (t *trimmer) time(elem json.RawMessage) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(elem, &fields); err != nil {
+		return nil, err
+	}
+	var frame int
+	if err := json.Unmarshal(fields["frameNum"], &frame); err != nil || frame < t.from || frame > t.to {
+		return nil, nil
+	}
+	fields["frameNum"] = t.frame(frame)
+	return json.Marshal(fields)
+}
+
+func (t *trimmer) entity(elem json.RawMessage) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(elem, &fields); err != nil {
+		return nil, err
+	}
+	var start int
+	if raw, ok := fields["startFrameNum"]; ok {
+		if err := json.Unmarshal(raw, &start); err != nil {
+			return nil, fmt.Errorf("startFrameNum: %w", err)
+		}
+	}
+
+	if raw, ok := fields["positions"]; ok {
+		positions, err := t.positions(raw, start)
+		if err != nil {
+			return nil, err
+		}
+		fields["positions"] = positions
+	}
+	if raw, ok := fields["framesFired"]; ok {
+		shots, err := t.shots(raw)
+		if err != nil {
+			return nil, err
+		}
+		fields["framesFired"] = shots
+	}
+	fields["startFrameNum"] = t.frame(minInt(maxInt(start, t.from), t.to))
+
+	return json.Marshal(fields)
+}
+
+// positions trims a positions array. Elements are one per frame from start,
+// except for vehicle elements carrying their own [startFrame, endFrame]
+// range, which are clipped to the range instead.
+func (t *trimmer) positions(raw json.RawMessage, start int) (json.RawMessage, error) {
+	var elems []json.RawMessage
+	if err := json.Unmarshal(raw, &elems); err != nil {
+		return nil, fmt.Errorf("positions: %w", err)
+	}
+
+	kept := make([]json.RawMessage, 0, len(elems))
+	// previous is the last non-empty element before the range, which an
+	// empty first element repeats.
+	var previous json.RawMessage
+	for i, elem := range elems {
+		var fields []json.RawMessage
+		if err := json.Unmarshal(elem, &fields); err != nil {
+			return nil, fmt.Errorf("positions[%d]: %w", i, err)
+		}
+
+		if frames, ok := frameRange(fields); ok {
+			if frames[1] < t.from || frames[0] > t.to {
+				continue
+			}
+			fields[4], _ = json.Marshal([2]int{
+				maxInt(frames[0], t.from) - t.from,
+				minInt(frames[1], t.to) - t.from,
+			})
+			elem, _ = json.Marshal(fields)
+			kept = append(kept, elem)
+			continue
+		}
+
+		switch frame := start + i; {
+		case frame < t.from:
+			if len(fields) > 0 {
+				previous = elem
+			}
+		case frame <= t.to:
+			if len(fields) == 0 && len(kept) == 0 && previous != nil {
+				elem = previous
+			}
+			kept = append(kept, elem)
+		}
+	}
+	return json.Marshal(kept)
+}
+
+// frameRange returns the frame range of a vehicle position element.
+func frameRange(fields []json.RawMessage) ([2]int, bool) {
+	var frames []int
+	if len(fields) < 5 || json.Unmarshal(fields[4], &frames) != nil || len(frames) != 2 {
+		return [2]int{}, false
+	}
+	return [2]int{frames[0], frames[1]}, true
+}
+
+func (t *trimmer) shots(raw json.RawMessage) (json.RawMessage, error) {
+	var shots [][]json.RawMessage
+	if err := json.Unmarshal(raw, &shots); err != nil {
+		return nil, fmt.Errorf("framesFired: %w", err)
+	}
+
+	kept := make([][]json.RawMessage, 0, len(shots))
+	for _, shot := range shots {
+		var frame int
+		if len(shot) == 0 || json.Unmarshal(shot[0], &frame) != nil || frame < t.from || frame > t.to {
+			continue
+		}
+		shot[0] = t.frame(frame)
+		kept = append(kept, shot)
+	}
+	return json.Marshal(kept)
+}
+
+func (t *trimmer) event(elem json.RawMessage) (json.RawMessage, error) {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(elem, &fields); err != nil {
+		return nil, nil
+	}
+	var e Event
+	if err := json.Unmarshal(elem, &e); err != nil {
+		return nil, nil
+	}
+
+	switch {
+	case e.Frame < t.from:
+		return nil, nil
+	case e.Frame > t.to:
+		if e.Type != EventEndMission {
+			return nil, nil
+		}
+		e.Frame = t.to
+	}
+	fields[0] = t.frame(e.Frame)
+	return json.Marshal(fields)
+}
+
+// marker trims a marker, dropping it if it is not shown during the range. Its
+// state at the start of the range is kept as its first position.
+func (t *trimmer) marker(elem json.RawMessage) (json.RawMessage, error) {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(elem, &fields); err != nil {
+		return nil, nil
+	}
+	var m Marker
+	if err := json.Unmarshal(elem, &m); err != nil {
+		return nil, nil
+	}
+
+	// An endFrame of -1 keeps the marker until the end.
+	if m.StartFrame > t.to || m.EndFrame >= 0 && m.EndFrame < t.from {
+		return nil, nil
+	}
+	start := maxInt(m.StartFrame, t.from)
+	fields[2] = t.frame(start)
+	if m.EndFrame >= 0 {
+		fields[3] = t.frame(minInt(m.EndFrame, t.to))
+	}
+
+	var positions [][]json.RawMessage
+	if err := json.Unmarshal(fields[7], &positions); err != nil {
+		return nil, nil
+	}
+	kept := make([][]json.RawMessage, 0, len(positions))
+	var previous []json.RawMessage
+	for i, p := range positions {
+		frame := m.Positions[i].Frame
+		switch {
+		case frame < t.from:
+			previous = p
+		case frame <= t.to:
+			if len(kept) == 0 && frame > start && previous != nil {
+				previous[0] = t.frame(start)
+				kept = append(kept, previous)
+			}
+			p[0] = t.frame(frame)
+			kept = append(kept, p)
+		}
+	}
+	if len(kept) == 0 && previous != nil {
+		previous[0] = t.frame(start)
+		kept = append(kept, previous)
+	}
+	fields[7], _ = json.Marshal(kept)
+
+	return json.Marshal(fields)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
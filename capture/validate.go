@@ -0,0 +1,572 @@
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxProblems is the most problems a Report lists.
+const maxProblems = 100
+
+// Problem is something wrong with a capture. Path locates it, in the form
+// entities[3].positions[12][2].
+type Problem struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	if p.Path == "" {
+		return p.Message
+	}
+	return p.Path + ": " + p.Message
+}
+
+// Report is the result of validating a capture. Info is filled in as far as
+// the capture could be read. Warnings are things the viewer tolerates, such as
+// event types it does not know, and do not make a capture invalid.
+type Report struct {
+	Info      Info      `json:"info"`
+	Problems  []Problem `json:"problems"`
+	Warnings  []Problem `json:"warnings"`
+	Truncated bool      `json:"truncated"` // more than maxProblems were found
+}
+
+// Valid reports whether no problems were found. Warnings are ignored.
+func (r *Report) Valid() bool {
+	return len(r.Problems) == 0
+}
+
+// Err returns nil for a valid capture, or an error listing the first
+// problems otherwise.
+func (r *Report) Err() error {
+	if r.Valid() {
+		return nil
+	}
+	return &ValidationError{Problems: r.Problems}
+}
+
+// ValidationError is returned by Report.Err.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	const shown = 3
+	msgs := make([]string, 0, shown)
+	for i, p := range e.Problems {
+		if i == shown {
+			msgs = append(msgs, fmt.Sprintf("and %d more", len(e.Problems)-shown))
+			break
+		}
+		msgs = append(msgs, p.String())
+	}
+	return "invalid capture: " + strings.Join(msgs, "; ")
+}
+
+// ValidateFile validates the capture file at path.
+func ValidateFile(path string) (*Report, error) {
+	r, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return Validate(r), nil
+}
+
+// Validate reads the capture from r and checks it against the format. It
+// reports every problem found, up to a limit, rather than stopping at the
+// first; a capture that is not well-formed JSON is reported up to the point
+// where it breaks. Entities are read one at a time but each is held whole in
+// memory, so the memory used grows with the largest entity.
+func Validate(r io.Reader) *Report {
+	v := validator{
+		dec:      json.NewDecoder(r),
+		report:   &Report{Info: newInfo()},
+		ids:      make(map[int]int),
+		required: map[string]bool{},
+	}
+	v.validate()
+	v.report.Info.Version = v.report.Info.Features.Version()
+	if v.report.Problems == nil {
+		v.report.Problems = []Problem{}
+	}
+	if v.report.Warnings == nil {
+		v.report.Warnings = []Problem{}
+	}
+	return v.report
+}
+
+// frameRef is an entity or event whose frame and entity references are
+// checked once the whole capture has been read. victim and causedBy are -1
+// when there is nothing to check.
+type frameRef struct {
+	path     string
+	frame    int
+	victim   int
+	causedBy int
+}
+
+type validator struct {
+	dec      *json.Decoder
+	report   *Report
+	ids      map[int]int // entity ID -> index
+	refs     []frameRef
+	required map[string]bool
+	// Frame of the previous event and time, which must not decrease.
+	lastEvent, lastTime int
+}
+
+func (v *validator) add(path, format string, args ...any) {
+	v.report.Problems = v.appendProblem(v.report.Problems, path, format, args...)
+}
+
+func (v *validator) warn(path, format string, args ...any) {
+	v.report.Warnings = v.appendProblem(v.report.Warnings, path, format, args...)
+}
+
+func (v *validator) appendProblem(list []Problem, path, format string, args ...any) []Problem {
+	if len(list) >= maxProblems {
+		v.report.Truncated = true
+		return list
+	}
+	return append(list, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// malformed reports a problem that stops the validation.
+func (v *validator) malformed(path string, err error) {
+	v.add(path, "malformed JSON near byte %d: %v", v.dec.InputOffset(), err)
+}
+
+func (v *validator) validate() {
+	dec := v.dec
+	info := &v.report.Info
+
+	tok, err := dec.Token()
+	if err != nil {
+		v.malformed("", err)
+		return
+	}
+	if tok != json.Delim('{') {
+		v.add("", "capture is not a JSON object")
+		return
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			v.malformed("", err)
+			return
+		}
+		key, _ := tok.(string)
+
+		var ok bool
+		switch key {
+		case "worldName":
+			ok = v.decode(key, &info.WorldName)
+			if ok && info.WorldName == "" {
+				v.add(key, "must not be empty")
+			}
+		case "missionName":
+			ok = v.decode(key, &info.MissionName)
+		case "missionAuthor":
+			ok = v.decode(key, &info.MissionAuthor)
+		case "captureDelay":
+			ok = v.decode(key, &info.CaptureDelay)
+			if ok && info.CaptureDelay <= 0 {
+				v.add(key, "must be positive, got %v", info.CaptureDelay)
+			}
+		case "endFrame":
+			ok = v.decode(key, &info.EndFrame)
+			if ok && info.EndFrame < 0 {
+				v.add(key, "must not be negative, got %d", info.EndFrame)
+			}
+		case "extensionVersion":
+			ok = v.decode(key, &info.ExtensionVersion)
+		case "addonVersion":
+			ok = v.decode(key, &info.AddonVersion)
+		case "tags":
+			ok = v.decode(key, &info.Tags)
+		case "anonymized":
+			ok = v.decode(key, &info.Anonymized)
+		case "times":
+			info.Features.Times = true
+			ok = v.array(key, v.time)
+		case "entities":
+			ok = v.array(key, v.entity)
+		case "events":
+			ok = v.array(key, v.event)
+		case "Markers":
+			info.Features.Markers = true
+			ok = v.array(key, v.marker)
+		default:
+			var discard json.RawMessage
+			ok = v.decode(key, &discard)
+		}
+		if !ok {
+			return
+		}
+		v.required[key] = true
+	}
+
+	for _, key := range []string{"worldName", "missionName", "endFrame", "captureDelay", "entities", "events"} {
+		if !v.required[key] {
+			v.add(key, "is missing")
+		}
+	}
+
+	v.checkRefs()
+}
+
+// decode decodes the next value into dst. A value of the wrong type is
+// reported and skipped; it returns false if the JSON itself is broken.
+func (v *validator) decode(path string, dst any) bool {
+	var raw json.RawMessage
+	if err := v.dec.Decode(&raw); err != nil {
+		v.malformed(path, err)
+		return false
+	}
+	if err := json.Unmarshal(raw, dst); err != nil {
+		v.add(path, "%s", typeError(err))
+	}
+	return true
+}
+
+// typeError shortens the errors of encoding/json.
+func typeError(err error) string {
+	if te, ok := err.(*json.UnmarshalTypeError); ok {
+		return fmt.Sprintf("want %s, got %s", te.Type, te.Value)
+	}
+	return strings.TrimPrefix(err.Error(), "json: ")
+}
+
+// array validates the array at path one element at a time with fn, which
+// gets the raw element.
+func (v *validator) array(path string, fn func(path string, raw json.RawMessage)) bool {
+	tok, err := v.dec.Token()
+	if err != nil {
+		v.malformed(path, err)
+		return false
+	}
+	if tok != json.Delim('[') {
+		if tok == nil {
+			return true
+		}
+		v.add(path, "want array")
+		// Skip the rest of an object; scalars are a single token.
+		if tok == json.Delim('{') {
+			for v.dec.More() {
+				var discard json.RawMessage
+				if _, err := v.dec.Token(); err != nil {
+					v.malformed(path, err)
+					return false
+				}
+				if err := v.dec.Decode(&discard); err != nil {
+					v.malformed(path, err)
+					return false
+				}
+			}
+			if _, err := v.dec.Token(); err != nil {
+				v.malformed(path, err)
+				return false
+			}
+		}
+		return true
+	}
+
+	for i := 0; v.dec.More(); i++ {
+		var raw json.RawMessage
+		elemPath := fmt.Sprintf("%s[%d]", path, i)
+		if err := v.dec.Decode(&raw); err != nil {
+			v.malformed(elemPath, err)
+			return false
+		}
+		fn(elemPath, raw)
+	}
+
+	if _, err := v.dec.Token(); err != nil {
+		v.malformed(path, err)
+		return false
+	}
+	return true
+}
+
+func (v *validator) time(path string, raw json.RawMessage) {
+	var t Time
+	if err := json.Unmarshal(raw, &t); err != nil {
+		v.add(path, "%s", typeError(err))
+		return
+	}
+	if v.report.Info.Times > 0 && t.FrameNum < v.lastTime {
+		v.add(path+".frameNum", "frame %d is before the previous time's frame %d", t.FrameNum, v.lastTime)
+	}
+	v.lastTime = t.FrameNum
+	v.report.Info.Times++
+}
+
+func (v *validator) marker(path string, raw json.RawMessage) {
+	var m Marker
+	if err := json.Unmarshal(raw, &m); err != nil {
+		v.add(path, "%s", typeError(err))
+		return
+	}
+	v.report.Info.Markers++
+}
+
+func (v *validator) entity(path string, raw json.RawMessage) {
+	index := v.report.Info.Entities
+	v.report.Info.Entities++
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		v.add(path, "want object")
+		return
+	}
+
+	var e Entity
+	for _, f := range []struct {
+		key string
+		dst any
+	}{
+		{"type", &e.Type},
+		{"id", &e.ID},
+		{"name", &e.Name},
+		{"side", &e.Side},
+		{"group", &e.Group},
+		{"role", &e.Role},
+		{"class", &e.Class},
+		{"isPlayer", &e.IsPlayer},
+		{"startFrameNum", &e.StartFrameNum},
+	} {
+		if value, ok := fields[f.key]; ok {
+			if err := json.Unmarshal(value, f.dst); err != nil {
+				v.add(path+"."+f.key, "%s", typeError(err))
+			}
+		}
+	}
+
+	required := []string{"type", "id", "name", "startFrameNum", "positions"}
+	switch e.Type {
+	case EntityUnit:
+		v.report.Info.Units++
+		required = append(required, "side")
+		if _, ok := fields["side"]; ok && !knownSide(e.Side) {
+			v.add(path+".side", "unknown side %q", e.Side)
+		}
+		if e.IsPlayer != 0 && e.IsPlayer != 1 {
+			v.add(path+".isPlayer", "want 0 or 1, got %d", e.IsPlayer)
+		}
+	case EntityVehicle:
+		v.report.Info.Vehicles++
+		required = append(required, "class")
+	default:
+		v.add(path+".type", "unknown entity type %q", e.Type)
+	}
+	for _, key := range required {
+		if _, ok := fields[key]; !ok {
+			v.add(path+"."+key, "is missing")
+		}
+	}
+
+	if _, ok := fields["id"]; ok {
+		if other, dup := v.ids[e.ID]; dup {
+			v.add(path+".id", "duplicate id %d, also used by entities[%d]", e.ID, other)
+		} else {
+			v.ids[e.ID] = index
+		}
+	}
+	if e.StartFrameNum < 0 {
+		v.add(path+".startFrameNum", "must not be negative, got %d", e.StartFrameNum)
+	} else {
+		v.refs = append(v.refs, frameRef{path: path + ".startFrameNum", frame: e.StartFrameNum, victim: -1, causedBy: -1})
+	}
+
+	if raw, ok := fields["positions"]; ok {
+		v.positions(path+".positions", raw, e.Type == EntityVehicle)
+	}
+	if raw, ok := fields["framesFired"]; ok {
+		v.shots(path+".framesFired", raw)
+	}
+}
+
+func knownSide(side string) bool {
+	for _, s := range Sides {
+		if s == side {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *validator) positions(path string, raw json.RawMessage, vehicle bool) {
+	var elems []json.RawMessage
+	if err := json.Unmarshal(raw, &elems); err != nil {
+		v.add(path, "want array")
+		return
+	}
+	if len(elems) == 0 {
+		v.warn(path, "is empty")
+	}
+
+	var pos Position
+	for i, elem := range elems {
+		elemPath := fmt.Sprintf("%s[%d]", path, i)
+		if !v.position(elemPath, elem, vehicle) {
+			continue
+		}
+		if json.Unmarshal(elem, &pos) == nil {
+			v.report.Info.Features.addPosition(&pos)
+		}
+	}
+}
+
+// position checks one positions element strictly, reporting whether it is
+// well-formed.
+func (v *validator) position(path string, raw json.RawMessage, vehicle bool) bool {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		v.add(path, "want array")
+		return false
+	}
+
+	maxFields := 6
+	if vehicle {
+		maxFields = 5
+	}
+	if len(fields) > maxFields {
+		v.add(path, "has %d fields, want at most %d", len(fields), maxFields)
+		return false
+	}
+
+	ok := true
+	check := func(i int, valid bool, want string) {
+		if !valid {
+			v.add(fmt.Sprintf("%s[%d]", path, i), "want %s", want)
+			ok = false
+		}
+	}
+	for i, f := range fields {
+		switch i {
+		case 0:
+			var coords []float64
+			err := json.Unmarshal(f, &coords)
+			check(i, err == nil && len(coords) >= 2 && len(coords) <= 3, "[x, y] or [x, y, z]")
+		case 1:
+			var dir float64
+			check(i, json.Unmarshal(f, &dir) == nil, "direction")
+		case 2:
+			alive, isIntOK := isInt(f)
+			check(i, isIntOK && alive >= StateDead && alive <= StateUnconscious, "alive state 0, 1 or 2")
+		case 3:
+			if vehicle {
+				var crew []int
+				check(i, json.Unmarshal(f, &crew) == nil, "list of crew ids")
+			} else {
+				flag, isIntOK := isInt(f)
+				check(i, isIntOK && (flag == 0 || flag == 1), "in vehicle flag 0 or 1")
+			}
+		case 4:
+			if vehicle {
+				var frames []int
+				err := json.Unmarshal(f, &frames)
+				check(i, err == nil && len(frames) == 2 && frames[0] <= frames[1], "[startFrame, endFrame]")
+			} else {
+				var name string
+				check(i, json.Unmarshal(f, &name) == nil, "unit name")
+			}
+		case 5:
+			flag, isIntOK := isInt(f)
+			check(i, isIntOK && (flag == 0 || flag == 1), "player flag 0 or 1")
+		}
+	}
+	return ok
+}
+
+func (v *validator) shots(path string, raw json.RawMessage) {
+	var elems [][]json.RawMessage
+	if err := json.Unmarshal(raw, &elems); err != nil {
+		v.add(path, "want array of [frame, [x, y, z]]")
+		return
+	}
+	for i, e := range elems {
+		ok := len(e) == 2
+		if ok {
+			var pos []float64
+			_, ok = isInt(e[0])
+			ok = ok && json.Unmarshal(e[1], &pos) == nil
+		}
+		if !ok {
+			v.add(fmt.Sprintf("%s[%d]", path, i), "want [frame, [x, y, z]]")
+		}
+	}
+}
+
+func (v *validator) event(path string, raw json.RawMessage) {
+	first := v.report.Info.Events == 0
+	v.report.Info.Events++
+
+	var e Event
+	if err := json.Unmarshal(raw, &e); err != nil {
+		v.add(path, "%s", typeError(err))
+		return
+	}
+	v.report.Info.Features.addEvent(&e)
+	v.report.Info.EventTypes[e.Type]++
+
+	ref := frameRef{path: path + "[0]", frame: e.Frame, victim: -1, causedBy: -1}
+	if e.Frame < 0 {
+		v.add(path+"[0]", "frame must not be negative, got %d", e.Frame)
+	}
+	if !first && e.Frame < v.lastEvent {
+		v.add(path+"[0]", "frame %d is before the previous event's frame %d", e.Frame, v.lastEvent)
+	}
+	v.lastEvent = e.Frame
+
+	var err error
+	switch {
+	case e.Type == EventHit || e.Type == EventKilled:
+		var hk HitKilled
+		hk, err = e.HitKilled()
+		ref.victim, ref.causedBy = hk.VictimID, hk.CausedByID
+	case e.Type == EventConnected || e.Type == EventDisconnected:
+		_, err = e.Connection()
+	case e.Type == EventEndMission:
+		_, err = e.EndMission()
+	case e.Type == EventCaptured || e.Type == EventCapturedFlag:
+		_, err = e.Captured()
+	case e.Type == EventTerminalHackStarted || e.Type == EventTerminalHackCanceled:
+		_, err = e.TerminalHack()
+	default:
+		v.warn(path+"[1]", "unknown event type %q", e.Type)
+	}
+	if err != nil {
+		v.add(path, "%s", err)
+		ref.victim, ref.causedBy = -1, -1
+	}
+
+	v.refs = append(v.refs, ref)
+}
+
+// checkRefs checks the frames and entity references of events and entities
+// against the whole capture.
+func (v *validator) checkRefs() {
+	endFrame, hasEnd := v.report.Info.EndFrame, v.required["endFrame"]
+
+	for _, r := range v.refs {
+		if hasEnd && r.frame > endFrame {
+			v.add(r.path, "frame %d is after endFrame %d", r.frame, endFrame)
+		}
+		// The event path ends in [0]; the entities are its 3rd and 4th
+		// elements.
+		event := strings.TrimSuffix(r.path, "[0]")
+		if _, ok := v.ids[r.victim]; r.victim >= 0 && !ok {
+			v.add(event+"[2]", "unknown entity %d", r.victim)
+		}
+		if _, ok := v.ids[r.causedBy]; r.causedBy >= 0 && !ok {
+			v.add(event+"[3]", "unknown entity %d", r.causedBy)
+		}
+	}
+}
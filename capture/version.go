@@ -0,0 +1,110 @@
+package capture
+
+// Version is a known revision of the capture format. Captures do not record
+// their version, so it is inferred from the features they use.
+type Version int
+
+const (
+	// VersionUnknown is reported for captures without entities or events to
+	// tell the versions apart.
+	VersionUnknown Version = iota
+	// Version1 captures come from the original OCAP addon: flags are
+	// captured with capturedFlag events, hit and killed events have no
+	// distance and unit positions have no name.
+	Version1
+	// Version2 captures come from OCAP2: hit and killed events record the
+	// distance, unit positions the unit's name, and captures use captured
+	// events. They also have the times array.
+	Version2
+	// Version3 captures come from later OCAP2 releases, which record vehicle
+	// positions as frame ranges and whether a player controls each unit at
+	// every frame.
+	Version3
+)
+
+var versionNames = [...]string{"unknown", "1", "2", "3"}
+
+func (v Version) String() string {
+	if v < 0 || int(v) >= len(versionNames) {
+		return "unknown"
+	}
+	return versionNames[v]
+}
+
+// MarshalText encodes v as its name.
+func (v Version) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// UnmarshalText decodes a version name; unknown names give VersionUnknown.
+func (v *Version) UnmarshalText(text []byte) error {
+	*v = VersionUnknown
+	for i, name := range versionNames {
+		if name == string(text) {
+			*v = Version(i)
+		}
+	}
+	return nil
+}
+
+// Features lists the optional parts of the format found in a capture.
+type Features struct {
+	CapturedFlag       bool `json:"captured_flag"`
+	Captured           bool `json:"captured"`
+	TerminalHacks      bool `json:"terminal_hacks"`
+	EventDistance      bool `json:"event_distance"`
+	UnitNames          bool `json:"unit_names"`
+	PlayerFlag         bool `json:"player_flag"`
+	VehicleFrameRanges bool `json:"vehicle_frame_ranges"`
+	Times              bool `json:"times"`
+	Markers            bool `json:"markers"`
+
+	// legacy is set by elements that only exist in Version1 captures.
+	legacy bool
+}
+
+// addPosition records the features used by a position.
+func (f *Features) addPosition(p *Position) {
+	switch {
+	case p.Frames[0] >= 0:
+		f.VehicleFrameRanges = true
+	case !p.hasCrew && p.Fields >= 5:
+		f.UnitNames = true
+	}
+	if p.IsPlayer >= 0 {
+		f.PlayerFlag = true
+	}
+}
+
+// addEvent records the features used by an event.
+func (f *Features) addEvent(e *Event) {
+	switch {
+	case e.Type == EventCapturedFlag:
+		f.CapturedFlag = true
+		f.legacy = true
+	case e.Type == EventCaptured:
+		f.Captured = true
+	case e.IsTerminalHack():
+		f.TerminalHacks = true
+	case e.Type == EventHit || e.Type == EventKilled:
+		if len(e.Fields) > 2 {
+			f.EventDistance = true
+		} else {
+			f.legacy = true
+		}
+	}
+}
+
+// Version returns the newest format version whose features were found.
+func (f *Features) Version() Version {
+	switch {
+	case f.VehicleFrameRanges || f.PlayerFlag:
+		return Version3
+	case f.EventDistance || f.UnitNames || f.Captured || f.Times:
+		return Version2
+	case f.legacy:
+		return Version1
+	default:
+		return VersionUnknown
+	}
+}
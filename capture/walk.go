@@ -0,0 +1,392 @@
+package capture
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrStop can be returned by a Visitor function to end a walk early without
+// an error.
+var ErrStop = errors.New("capture: stop walk")
+
+// Visitor receives the elements of a capture as Walk streams it. Any
+// function may be nil. The values passed are reused, so they must be copied
+// to be kept. Positions and shots are passed before the entity they belong
+// to, since an entity's scalar fields may follow them; entity is the index
+// of the entity in the entities array. Events and markers that cannot be
+// read, such as events without a frame and a type, are skipped; Validate
+// reports them.
+type Visitor struct {
+	// Header is called after each top-level field of Header is decoded,
+	// with key naming it and h holding the header read so far.
+	Header   func(key string, h *Header) error
+	Time     func(i int, t *Time) error
+	Entity   func(i int, e *Entity) error
+	Position func(entity, i int, p *Position) error
+	Shot     func(entity int, s *Shot) error
+	Event    func(i int, e *Event) error
+	Marker   func(i int, m *Marker) error
+	// Field receives the top-level fields not described by Header, nor
+	// streamed above.
+	Field func(key string, value json.RawMessage) error
+}
+
+// Info describes a walked capture.
+type Info struct {
+	Header
+	Version    Version        `json:"version"`
+	Features   Features       `json:"features"`
+	Entities   int            `json:"entities"`
+	Units      int            `json:"units"`
+	Vehicles   int            `json:"vehicles"`
+	Events     int            `json:"events"`
+	EventTypes map[string]int `json:"event_types"` // event type -> count
+	Markers    int            `json:"markers"`
+	Times      int            `json:"times"`
+}
+
+func newInfo() Info {
+	return Info{
+		Header:     Header{CaptureDelay: 1},
+		EventTypes: make(map[string]int),
+	}
+}
+
+// Open opens a capture file for reading, decompressing it if it is gzipped.
+func Open(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &gzipFile{Reader: gz, f: f}, nil
+}
+
+type gzipFile struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (g *gzipFile) Close() error {
+	err := g.Reader.Close()
+	if ferr := g.f.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// Decompress returns a reader of the capture read from r, decompressing it if
+// it is gzipped. Uploads may be either.
+func Decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(br)
+	}
+	return br, nil
+}
+
+// WalkFile walks the capture file at path.
+func WalkFile(path string, v Visitor) (*Info, error) {
+	r, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return Walk(r, v)
+}
+
+// Walk streams the capture read from r to v and returns what it found.
+func Walk(r io.Reader, v Visitor) (*Info, error) {
+	info := newInfo()
+	w := walker{
+		dec:  json.NewDecoder(r),
+		v:    v,
+		info: &info,
+	}
+	err := w.walk()
+	if errors.Is(err, ErrStop) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	w.info.Version = w.info.Features.Version()
+	return w.info, nil
+}
+
+type walker struct {
+	dec  *json.Decoder
+	v    Visitor
+	info *Info
+}
+
+func (w *walker) walk() error {
+	dec := w.dec
+
+	if tok, err := dec.Token(); err != nil {
+		return fmt.Errorf("read opening brace: %w", err)
+	} else if tok != json.Delim('{') {
+		return fmt.Errorf("capture is not a JSON object")
+	}
+
+	header := headerFields(&w.info.Header)
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("read key: %w", err)
+		}
+		key, _ := tok.(string)
+
+		if dst, ok := header[key]; ok {
+			if err := dec.Decode(dst); err != nil {
+				return fmt.Errorf("decode %s: %w", key, err)
+			}
+			if w.v.Header != nil {
+				if err := w.v.Header(key, &w.info.Header); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		switch key {
+		case "times":
+			w.info.Features.Times = true
+			var t Time
+			err = eachElement(dec, key, func(i int) error {
+				t = Time{}
+				if err := dec.Decode(&t); err != nil {
+					return err
+				}
+				w.info.Times++
+				return call(w.v.Time, i, &t)
+			})
+
+		case "entities":
+			var e Entity
+			err = eachElement(dec, key, func(i int) error {
+				if err := DecodeEntity(dec, i, &w.v, &w.info.Features, &e); err != nil {
+					return err
+				}
+				w.info.Entities++
+				switch e.Type {
+				case EntityUnit:
+					w.info.Units++
+				case EntityVehicle:
+					w.info.Vehicles++
+				}
+				return call(w.v.Entity, i, &e)
+			})
+
+		case "events":
+			var (
+				raw json.RawMessage
+				e   Event
+			)
+			err = eachElement(dec, key, func(i int) error {
+				if err := dec.Decode(&raw); err != nil {
+					return err
+				}
+				if json.Unmarshal(raw, &e) != nil {
+					return nil
+				}
+				w.info.Events++
+				w.info.EventTypes[e.Type]++
+				w.info.Features.addEvent(&e)
+				return call(w.v.Event, i, &e)
+			})
+
+		case "Markers":
+			w.info.Features.Markers = true
+			var (
+				raw json.RawMessage
+				m   Marker
+			)
+			err = eachElement(dec, key, func(i int) error {
+				if err := dec.Decode(&raw); err != nil {
+					return err
+				}
+				m = Marker{}
+				if json.Unmarshal(raw, &m) != nil {
+					return nil
+				}
+				w.info.Markers++
+				return call(w.v.Marker, i, &m)
+			})
+
+		default:
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				return fmt.Errorf("decode %s: %w", key, err)
+			}
+			if w.v.Field != nil {
+				err = w.v.Field(key, value)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// headerFields maps the keys of the scalar top-level fields to their place in
+// h.
+func headerFields(h *Header) map[string]any {
+	return map[string]any{
+		"worldName":        &h.WorldName,
+		"missionName":      &h.MissionName,
+		"missionAuthor":    &h.MissionAuthor,
+		"captureDelay":     &h.CaptureDelay,
+		"endFrame":         &h.EndFrame,
+		"extensionVersion": &h.ExtensionVersion,
+		"addonVersion":     &h.AddonVersion,
+		"tags":             &h.Tags,
+		"anonymized":       &h.Anonymized,
+	}
+}
+
+func call[T any](fn func(int, *T) error, i int, v *T) error {
+	if fn == nil {
+		return nil
+	}
+	return fn(i, v)
+}
+
+// eachElement calls fn for every element of the array dec is positioned at,
+// which fn must consume. A null array is treated as empty.
+func eachElement(dec *json.Decoder, name string, fn func(i int) error) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("read %s start: %w", name, err)
+	}
+	if tok == nil {
+		return nil
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("%s is not an array", name)
+	}
+
+	for i := 0; dec.More(); i++ {
+		if err := fn(i); err != nil {
+			if errors.Is(err, ErrStop) {
+				return err
+			}
+			return fmt.Errorf("%s[%d]: %w", name, i, err)
+		}
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("read %s end: %w", name, err)
+	}
+	return nil
+}
+
+// DecodeEntity streams one entity object from dec into e. Scalar fields are
+// decoded into e, while positions and framesFired are passed to v one
+// element at a time so an entity's complete history is never decoded into
+// memory at once. index is passed on to v, and features, if not nil, is
+// updated from the positions.
+func DecodeEntity(dec *json.Decoder, index int, v *Visitor, features *Features, e *Entity) error {
+	*e = Entity{}
+
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("read entity start: %w", err)
+	}
+
+	scalars := map[string]any{
+		"type":          &e.Type,
+		"id":            &e.ID,
+		"name":          &e.Name,
+		"side":          &e.Side,
+		"group":         &e.Group,
+		"role":          &e.Role,
+		"class":         &e.Class,
+		"isPlayer":      &e.IsPlayer,
+		"startFrameNum": &e.StartFrameNum,
+	}
+
+	var (
+		pos  Position
+		shot Shot
+	)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("read entity key: %w", err)
+		}
+		key, _ := tok.(string)
+
+		if dst, ok := scalars[key]; ok {
+			if err := dec.Decode(dst); err != nil {
+				return fmt.Errorf("decode entity %s: %w", key, err)
+			}
+			continue
+		}
+
+		switch key {
+		case "positions":
+			err = eachElement(dec, key, func(i int) error {
+				if err := dec.Decode(&pos); err != nil {
+					return err
+				}
+				if features != nil {
+					features.addPosition(&pos)
+				}
+				if v.Position == nil {
+					return nil
+				}
+				return v.Position(index, i, &pos)
+			})
+
+		case "framesFired":
+			err = eachElement(dec, key, func(i int) error {
+				if err := dec.Decode(&shot); err != nil {
+					return err
+				}
+				if v.Shot == nil {
+					return nil
+				}
+				return v.Shot(index, &shot)
+			})
+
+		default:
+			// Skip everything else (description, ...).
+			var discard json.RawMessage
+			if err = dec.Decode(&discard); err != nil {
+				err = fmt.Errorf("skip entity %s: %w", key, err)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("read entity end: %w", err)
+	}
+
+	return nil
+}
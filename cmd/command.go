@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/OCAP2/web/server"
+)
+
+// command runs the maintenance command name with its arguments. A server
+// running on the same data directory does not notice the changes and keeps
+// serving the player statistics it built before, until it is restarted.
+func command(name string, args []string, setting server.Setting, operation *server.RepoOperation) error {
+	switch name {
+	case "trim":
+		return trim(args, setting, operation)
+	case "merge":
+		return merge(args, setting, operation)
+	case "anonymize":
+		return anonymize(args, setting, operation)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+// trim cuts a stored capture to a frame range.
+func trim(args []string, setting server.Setting, operation *server.RepoOperation) error {
+	fs := flag.NewFlagSet("trim", flag.ContinueOnError)
+	from := fs.Int("from", 0, "first frame to keep")
+	to := fs.Int("to", -1, "last frame to keep")
+	out := fs.String("out", "", "filename of a new operation to store the result as, instead of trimming in place")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: trim -from frame -to frame [-out filename] capture")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *to < 0 {
+		fs.Usage()
+		return fmt.Errorf("trim: missing capture or frame range")
+	}
+
+	op, err := server.TrimCapture(context.Background(), operation, setting.Data, fs.Arg(0), server.TrimOptions{
+		From:     *from,
+		To:       *to,
+		Filename: *out,
+	})
+	if err != nil {
+		return fmt.Errorf("trim: %w", err)
+	}
+
+	fmt.Printf("trimmed %s: %s, %.0f seconds\n", fs.Arg(0), op.Filename, op.MissionDuration)
+	return nil
+}
+
+// merge merges captures split by a server restart into one operation.
+func merge(args []string, setting server.Setting, operation *server.RepoOperation) error {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	out := fs.String("out", "", "filename of the merged operation, by default that of the earliest capture")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: merge [-out filename] capture capture...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return fmt.Errorf("merge: at least two captures are needed")
+	}
+
+	op, err := server.MergeCaptures(context.Background(), operation, setting.Data, fs.Args(), *out)
+	if err != nil {
+		return fmt.Errorf("merge: %w", err)
+	}
+
+	fmt.Printf("merged %d captures into %s, %.0f seconds\n", fs.NArg(), op.Filename, op.MissionDuration)
+	return nil
+}
+
+// anonymize stores an anonymized copy of a capture as a new operation.
+func anonymize(args []string, setting server.Setting, operation *server.RepoOperation) error {
+	fs := flag.NewFlagSet("anonymize", flag.ContinueOnError)
+	label := fs.String("label", "pseudonym", "what replaces the names of players: pseudonym or role")
+	out := fs.String("out", "", "filename of the new operation, by default that of the capture followed by _public")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: anonymize [-label pseudonym|role] [-out filename] capture")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("anonymize: missing capture")
+	}
+
+	op, err := server.AnonymizeCapture(context.Background(), operation, setting.Data, fs.Arg(0), *label, *out, []byte(setting.Secret))
+	if err != nil {
+		return fmt.Errorf("anonymize: %w", err)
+	}
+
+	fmt.Printf("anonymized %s: %s\n", fs.Arg(0), op.Filename)
+	return nil
+}
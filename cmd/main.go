@@ -13,6 +13,11 @@ import (
 
 func main() {
 	if err := app(); err != nil {
+		// Maintenance commands fail like any command line tool.
+		if len(os.Args) > 1 {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 		log.Panicln(err)
 	}
 }
@@ -28,6 +33,11 @@ func app() error {
 		return fmt.Errorf("operation: %w", err)
 	}
 
+	// Maintenance commands run instead of the server.
+	if len(os.Args) > 1 {
+		return command(os.Args[1], os.Args[2:], setting, operation)
+	}
+
 	marker, err := server.NewRepoMarker(setting.Markers)
 	if err != nil {
 		return fmt.Errorf("marker: %w", err)
@@ -0,0 +1,208 @@
+package ocapbin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// FromJSON converts a JSON capture read from src into the binary format.
+// Entities and events are streamed one at a time; the remaining top-level
+// fields are written as a header chunk at the end, since they may follow the
+// entities in the JSON.
+func FromJSON(dst io.Writer, src io.Reader) error {
+	dec := json.NewDecoder(src)
+
+	w, err := NewWriter(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("read opening brace: %w", err)
+	}
+
+	header := make(map[string]json.RawMessage)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("read key: %w", err)
+		}
+		key, ok := tok.(string)
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "entities":
+			if _, err := dec.Token(); err != nil {
+				return fmt.Errorf("read entities start: %w", err)
+			}
+			for dec.More() {
+				var fields map[string]json.RawMessage
+				if err := dec.Decode(&fields); err != nil {
+					return fmt.Errorf("decode entity: %w", err)
+				}
+				if err := w.WriteEntity(EntityFromJSON(fields)); err != nil {
+					return err
+				}
+			}
+			if _, err := dec.Token(); err != nil {
+				return fmt.Errorf("read entities end: %w", err)
+			}
+
+		case "events":
+			var events json.RawMessage
+			if err := dec.Decode(&events); err != nil {
+				return fmt.Errorf("decode events: %w", err)
+			}
+			if err := w.WriteEvents(events); err != nil {
+				return err
+			}
+
+		default:
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				return fmt.Errorf("decode field %s: %w", key, err)
+			}
+			header[key] = value
+		}
+	}
+
+	if err := w.WriteHeader(header); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// EntityFromJSON splits the fields of a JSON entity into an Entity. Positions
+// and framesFired that are not arrays are left in Meta.
+func EntityFromJSON(fields map[string]json.RawMessage) *Entity {
+	e := &Entity{Meta: fields}
+
+	if raw, ok := fields["positions"]; ok {
+		var elems []json.RawMessage
+		if json.Unmarshal(raw, &elems) == nil && elems != nil {
+			e.HasPositions = true
+			e.Positions = make([]Position, len(elems))
+			for i, elem := range elems {
+				e.Positions[i] = ParsePosition(elem)
+			}
+			delete(fields, "positions")
+		}
+	}
+
+	if raw, ok := fields["framesFired"]; ok {
+		if shots, ok := ParseShots(raw); ok {
+			e.HasFramesFired = true
+			e.FramesFired = shots
+			delete(fields, "framesFired")
+		}
+	}
+
+	return e
+}
+
+// MarshalJSON encodes e as a JSON entity object.
+func (e *Entity) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]json.RawMessage, len(e.Meta)+2)
+	for k, v := range e.Meta {
+		fields[k] = v
+	}
+
+	if e.HasPositions {
+		positions := e.Positions
+		if positions == nil {
+			positions = []Position{}
+		}
+		raw, err := json.Marshal(positions)
+		if err != nil {
+			return nil, err
+		}
+		fields["positions"] = raw
+	}
+	if e.HasFramesFired {
+		shots := e.FramesFired
+		if shots == nil {
+			shots = []Shot{}
+		}
+		raw, err := json.Marshal(shots)
+		if err != nil {
+			return nil, err
+		}
+		fields["framesFired"] = raw
+	}
+
+	return json.Marshal(fields)
+}
+
+// ToJSON converts a binary capture read from src back into JSON.
+func ToJSON(dst io.Writer, src io.Reader) error {
+	r, err := NewReader(src)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(dst)
+	var (
+		header   map[string]json.RawMessage
+		events   json.RawMessage
+		entities int
+	)
+
+	w.WriteString(`{"entities":[`) //nolint:errcheck // checked on Flush
+	for {
+		c, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch c.Kind {
+		case KindHeader:
+			header = c.Header
+		case KindEvents:
+			events = c.Events
+		case KindEntity:
+			raw, err := json.Marshal(c.Entity)
+			if err != nil {
+				return err
+			}
+			if entities > 0 {
+				w.WriteByte(',') //nolint:errcheck // checked on Flush
+			}
+			w.Write(raw) //nolint:errcheck // checked on Flush
+			entities++
+		}
+	}
+	w.WriteByte(']') //nolint:errcheck // checked on Flush
+
+	if events == nil {
+		events = json.RawMessage("[]")
+	}
+	w.WriteString(`,"events":`) //nolint:errcheck // checked on Flush
+	w.Write(events)             //nolint:errcheck // checked on Flush
+
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		key, err := json.Marshal(k)
+		if err != nil {
+			return err
+		}
+		w.WriteByte(',')   //nolint:errcheck // checked on Flush
+		w.Write(key)       //nolint:errcheck // checked on Flush
+		w.WriteByte(':')   //nolint:errcheck // checked on Flush
+		w.Write(header[k]) //nolint:errcheck // checked on Flush
+	}
+	w.WriteByte('}') //nolint:errcheck // checked on Flush
+
+	return w.Flush()
+}
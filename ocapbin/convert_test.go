@@ -0,0 +1,82 @@
+package ocapbin
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCapture = `{
+	"worldName": "Altis",
+	"entities": [
+		{"type": "unit", "id": 0, "name": "Alpha", "side": "WEST", "isPlayer": 1, "startFrameNum": 0,
+			"positions": [[[1000.5, 2000.25, 3], 90, 1, 0, "Alpha", 1], [], [[1001.5, 1999.75, 3], 95, 1, 1, "Alpha", 1], [[1001.5, 1999.75], 95.125, 0, 0, "Alpha", 0], [[5, 5], 0, 1, 0, "Bravo"]],
+			"framesFired": [[3, [1000, 2000, 1.5]], [7, [1010.25, 2001, 1.5]]]},
+		{"type": "vehicle", "id": 1, "name": "Ghosthawk", "class": "heli", "startFrameNum": 0,
+			"positions": [[[0, 0, 0], 0, 1, [0], [0, 14]], [[10, 10, 50], 180, 1, [], [15, 20]], [[10, 10, 50], 180, 0, []]]},
+		{"type": "unit", "id": 2, "name": "Old", "positions": null, "framesFired": "broken"}
+	],
+	"events": [[10, "killed", 1, [0, "MX"], 120]],
+	"endFrame": 20,
+	"Markers": [["mil_dot", "Objective", 0, 20, 0, -1, [], "ColorRed", 1]]
+}`
+
+func TestRoundTrip(t *testing.T) {
+	var bin bytes.Buffer
+	require.NoError(t, FromJSON(&bin, strings.NewReader(testCapture)))
+	assert.Less(t, bin.Len(), len(testCapture))
+
+	var out bytes.Buffer
+	require.NoError(t, ToJSON(&out, bytes.NewReader(bin.Bytes())))
+
+	var want, got any
+	require.NoError(t, json.Unmarshal([]byte(testCapture), &want))
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	assert.Equal(t, want, got)
+}
+
+func TestReader(t *testing.T) {
+	var bin bytes.Buffer
+	require.NoError(t, FromJSON(&bin, strings.NewReader(testCapture)))
+
+	r, err := NewReader(&bin)
+	require.NoError(t, err)
+
+	var kinds []byte
+	var entities []*Entity
+	for {
+		c, err := r.Next()
+		if err != nil {
+			break
+		}
+		kinds = append(kinds, c.Kind)
+		if c.Kind == KindEntity {
+			entities = append(entities, c.Entity)
+		}
+	}
+	assert.Equal(t, []byte{KindEntity, KindEntity, KindEntity, KindEvents, KindHeader}, kinds)
+
+	alpha := entities[0]
+	require.Len(t, alpha.Positions, 5)
+	assert.Equal(t, 0, alpha.Positions[1].Fields)
+	assert.Equal(t, []float64{1001.5, 1999.75, 3}, alpha.Positions[2].Pos)
+	assert.NotNil(t, alpha.Positions[3].Raw, "direction is not exact in hundredths")
+	assert.Equal(t, "Bravo", alpha.Positions[4].Name)
+	assert.Equal(t, []Shot{{Frame: 3, Pos: []float64{1000, 2000, 1.5}}, {Frame: 7, Pos: []float64{1010.25, 2001, 1.5}}}, alpha.FramesFired)
+
+	heli := entities[1]
+	assert.Equal(t, &[2]int{15, 20}, heli.Positions[1].Frames)
+	assert.Equal(t, []int{}, heli.Positions[2].Crew)
+
+	old := entities[2]
+	assert.False(t, old.HasPositions)
+	assert.False(t, old.HasFramesFired)
+	assert.JSONEq(t, `"broken"`, string(old.Meta["framesFired"]))
+
+	_, err = NewReader(strings.NewReader(`{"worldName": "Altis"}`))
+	assert.ErrorIs(t, err, ErrMagic)
+}
@@ -0,0 +1,278 @@
+// Package ocapbin implements a compact binary encoding of OCAP captures.
+//
+// A file starts with Magic and a version byte, followed by chunks. Each chunk
+// is a kind byte, the payload length as a uvarint and the payload. Header
+// chunks hold the top-level fields of the capture other than entities and
+// events as a JSON object, events chunks hold the events array as JSON, and
+// each entity is written as its own chunk so that readers can stream them.
+// The file ends with an end chunk of length zero.
+//
+// Within an entity chunk, positions and framesFired are delta encoded:
+// coordinates and directions are stored in hundredths as zigzag varints
+// relative to the previous element, and unit names go through a per-entity
+// string table. Elements that cannot be stored exactly this way are kept as
+// raw JSON, so converting a capture to the binary format and back yields the
+// same values.
+package ocapbin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+)
+
+// MediaType is the content type of the binary format.
+const MediaType = "application/x-ocap-binary"
+
+// Extension is the file extension of binary captures.
+const Extension = ".ocapb"
+
+// Magic starts every binary capture.
+const Magic = "OCAPBIN"
+
+// Version is the version of the format written by this package.
+const Version = 1
+
+// Chunk kinds.
+const (
+	KindEnd    byte = 0
+	KindHeader byte = 1
+	KindEntity byte = 2
+	KindEvents byte = 3
+)
+
+var (
+	// ErrMagic is returned when the input is not a binary capture.
+	ErrMagic = errors.New("ocapbin: not a binary capture")
+	// ErrVersion is returned for binary captures of an unknown version.
+	ErrVersion = errors.New("ocapbin: unsupported version")
+	// ErrEntitiesSplit is returned when entities are not written one after
+	// the other.
+	ErrEntitiesSplit = errors.New("ocapbin: entities must be written contiguously")
+)
+
+// Chunk is one decoded chunk. Only the field matching Kind is set.
+type Chunk struct {
+	Kind   byte
+	Header map[string]json.RawMessage
+	Entity *Entity
+	Events json.RawMessage
+}
+
+// Entity is one element of the entities array. Meta holds every field except
+// positions and framesFired, which are only set if the entity has them.
+type Entity struct {
+	Meta           map[string]json.RawMessage
+	Positions      []Position
+	HasPositions   bool
+	FramesFired    []Shot
+	HasFramesFired bool
+}
+
+// Position is one element of an entity's positions array. Units store
+// [pos, dir, alive, isInVehicle, name, isPlayer] and vehicles
+// [pos, dir, alive, crew, [startFrame, endFrame]]; Fields is how many of
+// them the element has, and zero for an empty element. Raw is set instead
+// for elements that do not follow either layout.
+type Position struct {
+	Fields    int
+	Pos       []float64
+	Direction float64
+	Alive     int
+	InVehicle int
+	Crew      []int // set for vehicles, even if empty
+	Name      string
+	Frames    *[2]int
+	IsPlayer  int
+	Raw       json.RawMessage
+}
+
+// Shot is one element of framesFired: [frame, [x, y, z]].
+type Shot struct {
+	Frame int
+	Pos   []float64
+}
+
+// maxFields is the most fields a typed position has.
+const maxFields = 6
+
+// hundredths returns v in hundredths and whether that is exact.
+func hundredths(v float64) (int64, bool) {
+	q := math.Round(v * 100)
+	if math.Abs(q) > 1<<53 || q/100 != v {
+		return 0, false
+	}
+	return int64(q), true
+}
+
+// isInt reports whether a JSON number is a plain integer.
+func isInt(raw json.RawMessage) (int, bool) {
+	n, err := strconv.Atoi(string(bytes.TrimSpace(raw)))
+	return n, err == nil
+}
+
+// parseFloats decodes a JSON array of numbers that are exact in hundredths.
+func parseFloats(raw json.RawMessage, minLen, maxLen int) ([]float64, bool) {
+	var vs []float64
+	if json.Unmarshal(raw, &vs) != nil || len(vs) < minLen || len(vs) > maxLen {
+		return nil, false
+	}
+	for _, v := range vs {
+		if _, ok := hundredths(v); !ok {
+			return nil, false
+		}
+	}
+	return vs, true
+}
+
+// ParsePosition decodes a positions element, falling back to Raw when it
+// does not fit the typed layout.
+func ParsePosition(raw json.RawMessage) Position {
+	fallback := Position{Raw: append(json.RawMessage(nil), raw...)}
+
+	var fields []json.RawMessage
+	if json.Unmarshal(raw, &fields) != nil || fields == nil || len(fields) > maxFields {
+		return fallback
+	}
+
+	p := Position{Fields: len(fields)}
+	for i, f := range fields {
+		var ok bool
+		switch i {
+		case 0:
+			p.Pos, ok = parseFloats(f, 2, 3)
+		case 1:
+			if ok = json.Unmarshal(f, &p.Direction) == nil; ok {
+				_, ok = hundredths(p.Direction)
+			}
+		case 2:
+			p.Alive, ok = isInt(f)
+		case 3:
+			if p.InVehicle, ok = isInt(f); !ok {
+				ok = json.Unmarshal(f, &p.Crew) == nil && p.Crew != nil
+			}
+		case 4:
+			var frames []int
+			if json.Unmarshal(f, &frames) == nil && len(frames) == 2 && p.Crew != nil {
+				p.Frames, ok = &[2]int{frames[0], frames[1]}, true
+			} else {
+				ok = p.Crew == nil && json.Unmarshal(f, &p.Name) == nil
+			}
+		case 5:
+			p.IsPlayer, ok = isInt(f)
+		}
+		if !ok {
+			return fallback
+		}
+	}
+	// Fields after the crew or frame range only exist for units.
+	if p.Crew != nil && p.Fields > 5 {
+		return fallback
+	}
+
+	return p
+}
+
+// MarshalJSON encodes p back into its array form.
+func (p Position) MarshalJSON() ([]byte, error) {
+	if p.Raw != nil {
+		return p.Raw, nil
+	}
+
+	buf := []byte{'['}
+	for i := 0; i < p.Fields; i++ {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		switch i {
+		case 0:
+			buf = appendFloats(buf, p.Pos)
+		case 1:
+			buf = appendFloat(buf, p.Direction)
+		case 2:
+			buf = strconv.AppendInt(buf, int64(p.Alive), 10)
+		case 3:
+			if p.Crew != nil {
+				buf = appendInts(buf, p.Crew)
+			} else {
+				buf = strconv.AppendInt(buf, int64(p.InVehicle), 10)
+			}
+		case 4:
+			if p.Frames != nil {
+				buf = appendInts(buf, p.Frames[:])
+			} else {
+				name, err := json.Marshal(p.Name)
+				if err != nil {
+					return nil, err
+				}
+				buf = append(buf, name...)
+			}
+		case 5:
+			buf = strconv.AppendInt(buf, int64(p.IsPlayer), 10)
+		}
+	}
+	return append(buf, ']'), nil
+}
+
+// ParseShots decodes a framesFired array, reporting false if any element
+// does not fit the typed layout.
+func ParseShots(raw json.RawMessage) ([]Shot, bool) {
+	var elems [][]json.RawMessage
+	if json.Unmarshal(raw, &elems) != nil || elems == nil {
+		return nil, false
+	}
+
+	shots := make([]Shot, 0, len(elems))
+	for _, e := range elems {
+		if len(e) != 2 {
+			return nil, false
+		}
+		frame, ok := isInt(e[0])
+		if !ok {
+			return nil, false
+		}
+		pos, ok := parseFloats(e[1], 0, 3)
+		if !ok {
+			return nil, false
+		}
+		shots = append(shots, Shot{Frame: frame, Pos: pos})
+	}
+	return shots, true
+}
+
+// MarshalJSON encodes s back into its array form.
+func (s Shot) MarshalJSON() ([]byte, error) {
+	buf := []byte{'['}
+	buf = strconv.AppendInt(buf, int64(s.Frame), 10)
+	buf = append(buf, ',')
+	buf = appendFloats(buf, s.Pos)
+	return append(buf, ']'), nil
+}
+
+func appendFloat(buf []byte, v float64) []byte {
+	return strconv.AppendFloat(buf, v, 'f', -1, 64)
+}
+
+func appendFloats(buf []byte, vs []float64) []byte {
+	buf = append(buf, '[')
+	for i, v := range vs {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = appendFloat(buf, v)
+	}
+	return append(buf, ']')
+}
+
+func appendInts(buf []byte, vs []int) []byte {
+	buf = append(buf, '[')
+	for i, v := range vs {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = strconv.AppendInt(buf, int64(v), 10)
+	}
+	return append(buf, ']')
+}
@@ -0,0 +1,283 @@
+package ocapbin
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxChunkSize bounds the payload length accepted from a chunk header, so a
+// corrupt file cannot make the reader allocate without limit.
+const maxChunkSize = 1 << 30
+
+// Reader reads the chunks of a binary capture one at a time.
+type Reader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// NewReader checks the file header of r and returns a Reader for its
+// chunks.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+
+	head := make([]byte, len(Magic)+1)
+	if _, err := io.ReadFull(br, head); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrMagic
+		}
+		return nil, err
+	}
+	if string(head[:len(Magic)]) != Magic {
+		return nil, ErrMagic
+	}
+	if head[len(Magic)] != Version {
+		return nil, fmt.Errorf("%w: %d", ErrVersion, head[len(Magic)])
+	}
+
+	return &Reader{r: br}, nil
+}
+
+// Next returns the next chunk, or io.EOF after the end chunk.
+func (r *Reader) Next() (*Chunk, error) {
+	kind, err := r.r.ReadByte()
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	if size > maxChunkSize {
+		return nil, fmt.Errorf("ocapbin: chunk of %d bytes is too large", size)
+	}
+
+	if kind == KindEnd {
+		return nil, io.EOF
+	}
+
+	// The payload of events and header chunks is kept, so only entity
+	// chunks reuse the buffer.
+	var payload []byte
+	if kind == KindEntity {
+		if cap(r.buf) < int(size) {
+			r.buf = make([]byte, size)
+		}
+		payload = r.buf[:size]
+	} else {
+		payload = make([]byte, size)
+	}
+	if _, err := io.ReadFull(r.r, payload); err != nil {
+		return nil, unexpected(err)
+	}
+
+	c := &Chunk{Kind: kind}
+	switch kind {
+	case KindHeader:
+		if err := json.Unmarshal(payload, &c.Header); err != nil {
+			return nil, fmt.Errorf("ocapbin: decode header: %w", err)
+		}
+	case KindEvents:
+		c.Events = payload
+	case KindEntity:
+		d := decoder{buf: payload}
+		c.Entity, err = d.entity()
+		if err != nil {
+			return nil, fmt.Errorf("ocapbin: decode entity: %w", err)
+		}
+	default:
+		// Unknown chunks are skipped so that later versions can add some.
+		return r.Next()
+	}
+
+	return c, nil
+}
+
+func unexpected(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// decoder reads an entity from buf.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+var errTruncated = errors.New("truncated entity")
+
+func (d *decoder) byte() byte {
+	if d.err != nil || len(d.buf) == 0 {
+		d.err = errTruncated
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = errTruncated
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = errTruncated
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+// count reads a length and checks it against the remaining input, each
+// element taking at least one byte.
+func (d *decoder) count() int {
+	n := d.uvarint()
+	if n > uint64(len(d.buf)) {
+		d.err = errTruncated
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.count()
+	if d.err != nil {
+		return nil
+	}
+	b := append([]byte(nil), d.buf[:n]...)
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) coords(prev *[3]int64) []float64 {
+	n := int(d.byte())
+	if n > len(prev) {
+		d.err = errTruncated
+		return nil
+	}
+	vs := make([]float64, n)
+	for i := range vs {
+		prev[i] += d.varint()
+		vs[i] = float64(prev[i]) / 100
+	}
+	return vs
+}
+
+func (d *decoder) entity() (*Entity, error) {
+	e := &Entity{}
+	if err := json.Unmarshal(d.bytes(), &e.Meta); d.err == nil && err != nil {
+		return nil, err
+	}
+
+	if d.byte() == 1 {
+		e.HasPositions = true
+		d.positions(e)
+	}
+	if d.byte() == shotsTyped {
+		e.HasFramesFired = true
+		d.shots(e)
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	return e, nil
+}
+
+func (d *decoder) positions(e *Entity) {
+	n := d.count()
+	e.Positions = make([]Position, 0, n)
+
+	var (
+		prevPos [3]int64
+		prevDir int64
+		names   []string
+	)
+	for i := 0; i < n && d.err == nil; i++ {
+		tag := d.byte()
+		if tag == tagRaw {
+			e.Positions = append(e.Positions, Position{Raw: d.bytes()})
+			continue
+		}
+
+		p := Position{Fields: int(tag & tagFieldMask)}
+		if tag&tagCrew != 0 {
+			p.Crew = []int{}
+		}
+		for f := 0; f < p.Fields; f++ {
+			switch f {
+			case 0:
+				p.Pos = d.coords(&prevPos)
+			case 1:
+				prevDir += d.varint()
+				p.Direction = float64(prevDir) / 100
+			case 2:
+				p.Alive = int(d.varint())
+			case 3:
+				if p.Crew != nil {
+					crew := d.count()
+					for j := 0; j < crew; j++ {
+						p.Crew = append(p.Crew, int(d.varint()))
+					}
+				} else {
+					p.InVehicle = int(d.varint())
+				}
+			case 4:
+				if tag&tagFrames != 0 {
+					start := int(d.varint())
+					p.Frames = &[2]int{start, start + int(d.varint())}
+					break
+				}
+				idx := int(d.uvarint())
+				switch {
+				case idx < len(names):
+					p.Name = names[idx]
+				case idx == len(names):
+					p.Name = string(d.bytes())
+					names = append(names, p.Name)
+				default:
+					d.err = errTruncated
+				}
+			case 5:
+				p.IsPlayer = int(d.varint())
+			}
+		}
+		e.Positions = append(e.Positions, p)
+	}
+}
+
+func (d *decoder) shots(e *Entity) {
+	n := d.count()
+	e.FramesFired = make([]Shot, 0, n)
+
+	var (
+		prevFrame int64
+		prevPos   [3]int64
+	)
+	for i := 0; i < n && d.err == nil; i++ {
+		prevFrame += d.varint()
+		e.FramesFired = append(e.FramesFired, Shot{
+			Frame: int(prevFrame),
+			Pos:   d.coords(&prevPos),
+		})
+	}
+}
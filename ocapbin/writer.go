@@ -0,0 +1,222 @@
+package ocapbin
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Tags of an encoded position. The low bits of a typed tag hold the number of
+// fields.
+const (
+	tagEmpty     = 0x00
+	tagRaw       = 0x0f
+	tagFieldMask = 0x0f
+	tagCrew      = 0x10
+	tagFrames    = 0x20
+)
+
+// Encodings of framesFired.
+const (
+	shotsNone  = 0
+	shotsTyped = 1
+)
+
+// Writer writes a binary capture.
+type Writer struct {
+	w *bufio.Writer
+	// entitiesDone is set once another chunk follows the entities.
+	entities     bool
+	entitiesDone bool
+	buf          []byte
+}
+
+// NewWriter writes the file header to w and returns a Writer for the
+// chunks. Close must be called to end the file.
+func NewWriter(w io.Writer) (*Writer, error) {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(Magic); err != nil {
+		return nil, err
+	}
+	if err := bw.WriteByte(Version); err != nil {
+		return nil, err
+	}
+	return &Writer{w: bw}, nil
+}
+
+func (w *Writer) writeChunk(kind byte, payload []byte) error {
+	if kind != KindEntity && w.entities {
+		w.entitiesDone = true
+	}
+	if err := w.w.WriteByte(kind); err != nil {
+		return err
+	}
+	var n [binary.MaxVarintLen64]byte
+	if _, err := w.w.Write(n[:binary.PutUvarint(n[:], uint64(len(payload)))]); err != nil {
+		return err
+	}
+	_, err := w.w.Write(payload)
+	return err
+}
+
+// WriteHeader writes top-level fields of the capture.
+func (w *Writer) WriteHeader(fields map[string]json.RawMessage) error {
+	payload, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("encode header: %w", err)
+	}
+	return w.writeChunk(KindHeader, payload)
+}
+
+// WriteEvents writes the events array.
+func (w *Writer) WriteEvents(events json.RawMessage) error {
+	return w.writeChunk(KindEvents, events)
+}
+
+// WriteEntity writes one entity. All entities must be written one after the
+// other.
+func (w *Writer) WriteEntity(e *Entity) error {
+	if w.entitiesDone {
+		return ErrEntitiesSplit
+	}
+	w.entities = true
+
+	meta, err := json.Marshal(e.Meta)
+	if err != nil {
+		return fmt.Errorf("encode entity: %w", err)
+	}
+
+	enc := encoder{buf: w.buf[:0]}
+	enc.bytes(meta)
+	enc.positions(e)
+	enc.shots(e)
+	w.buf = enc.buf
+
+	return w.writeChunk(KindEntity, enc.buf)
+}
+
+// Close writes the end chunk and flushes the output. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if err := w.writeChunk(KindEnd, nil); err != nil {
+		return err
+	}
+	return w.w.Flush()
+}
+
+// encoder appends the encoding of an entity to buf.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uvarint(v uint64) {
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+func (e *encoder) varint(v int64) {
+	e.buf = binary.AppendVarint(e.buf, v)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uvarint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// coords appends vs as deltas from prev, which is updated.
+func (e *encoder) coords(vs []float64, prev *[3]int64) {
+	e.buf = append(e.buf, byte(len(vs)))
+	for i, v := range vs {
+		q, _ := hundredths(v)
+		e.varint(q - prev[i])
+		prev[i] = q
+	}
+}
+
+func (e *encoder) positions(ent *Entity) {
+	if !ent.HasPositions {
+		e.buf = append(e.buf, 0)
+		return
+	}
+	e.buf = append(e.buf, 1)
+	e.uvarint(uint64(len(ent.Positions)))
+
+	var (
+		prevPos [3]int64
+		prevDir int64
+		names   = make(map[string]int)
+	)
+	for i := range ent.Positions {
+		p := &ent.Positions[i]
+		if p.Raw != nil {
+			e.buf = append(e.buf, tagRaw)
+			e.bytes(p.Raw)
+			continue
+		}
+
+		tag := byte(p.Fields)
+		if p.Crew != nil {
+			tag |= tagCrew
+		}
+		if p.Frames != nil {
+			tag |= tagFrames
+		}
+		e.buf = append(e.buf, tag)
+
+		for f := 0; f < p.Fields; f++ {
+			switch f {
+			case 0:
+				e.coords(p.Pos, &prevPos)
+			case 1:
+				q, _ := hundredths(p.Direction)
+				e.varint(q - prevDir)
+				prevDir = q
+			case 2:
+				e.varint(int64(p.Alive))
+			case 3:
+				if p.Crew != nil {
+					e.uvarint(uint64(len(p.Crew)))
+					for _, id := range p.Crew {
+						e.varint(int64(id))
+					}
+				} else {
+					e.varint(int64(p.InVehicle))
+				}
+			case 4:
+				if p.Frames != nil {
+					e.varint(int64(p.Frames[0]))
+					e.varint(int64(p.Frames[1] - p.Frames[0]))
+				} else if idx, ok := names[p.Name]; ok {
+					e.uvarint(uint64(idx))
+				} else {
+					idx = len(names)
+					names[p.Name] = idx
+					e.uvarint(uint64(idx))
+					e.bytes([]byte(p.Name))
+				}
+			case 5:
+				e.varint(int64(p.IsPlayer))
+			}
+		}
+	}
+}
+
+func (e *encoder) shots(ent *Entity) {
+	if !ent.HasFramesFired {
+		e.buf = append(e.buf, shotsNone)
+		return
+	}
+	e.buf = append(e.buf, shotsTyped)
+	e.uvarint(uint64(len(ent.FramesFired)))
+
+	var (
+		prevFrame int64
+		prevPos   [3]int64
+	)
+	for _, s := range ent.FramesFired {
+		e.varint(int64(s.Frame) - prevFrame)
+		prevFrame = int64(s.Frame)
+		e.coords(s.Pos, &prevPos)
+	}
+}
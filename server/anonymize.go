@@ -0,0 +1,141 @@
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/OCAP2/web/capture"
+	"github.com/labstack/echo/v4"
+)
+
+// publicSuffix is added to the name of a capture to name its anonymized copy
+// by default.
+const publicSuffix = "_public"
+
+// anonymizeSource returns the source Anonymize reads the stored capture name
+// from.
+func anonymizeSource(dataDir, name string) capture.Source {
+	path := filepath.Join(dataDir, name+".gz")
+	return func() (io.ReadCloser, error) {
+		return capture.Open(path)
+	}
+}
+
+// AnonymizeCapture registers an anonymized copy of the stored capture name as
+// a new operation named filename, or the name of the capture followed by
+// _public when filename is empty. The names of players are replaced
+// according to label, see capture.Anonymize; key keeps pseudonyms the same
+// across captures.
+func AnonymizeCapture(ctx context.Context, repo *RepoOperation, dataDir, name, label, filename string, key []byte) (*Operation, error) {
+	name = filepath.Base(name)
+	if !captureExists(dataDir, name) {
+		return nil, ErrNotFound
+	}
+	op, err := storedOperation(ctx, repo, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if filename == "" {
+		filename = name + publicSuffix
+	}
+	filename = filepath.Base(filename)
+	if captureExists(dataDir, filename) {
+		return nil, fmt.Errorf("capture %s: %w", filename, ErrExists)
+	}
+
+	tmp, err := createCapture(dataDir, func(w io.Writer) error {
+		_, err := capture.Anonymize(w, anonymizeSource(dataDir, name), label, key)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("anonymize capture: %w", err)
+	}
+	defer os.Remove(tmp)
+
+	if err := os.Rename(tmp, filepath.Join(dataDir, filename+".gz")); err != nil {
+		return nil, err
+	}
+	public := *op
+	public.ID = 0
+	public.Filename = filename
+	if err := repo.Store(ctx, &public); err != nil {
+		os.Remove(filepath.Join(dataDir, filename+".gz"))
+		return nil, fmt.Errorf("store operation: %w", err)
+	}
+	return &public, nil
+}
+
+// anonymizeLabel returns the label form value, a pseudonym by default.
+func anonymizeLabel(c echo.Context) string {
+	if label := c.FormValue("label"); label != "" {
+		return label
+	}
+	return capture.LabelPseudonym
+}
+
+// AnonymizeOperation handles POST /api/v1/captures/:name/anonymize
+// It registers an anonymized copy of a stored capture as a new operation,
+// named by the filename form value or after the capture. The label form
+// value chooses what replaces the names of players: pseudonym, the default,
+// or role. It requires the upload secret.
+func (h *Handler) AnonymizeOperation(c echo.Context) error {
+	if c.FormValue("secret") != h.setting.Secret {
+		return echo.ErrForbidden
+	}
+
+	name, err := url.PathUnescape(c.Param("name"))
+	if err != nil {
+		return err
+	}
+
+	op, err := AnonymizeCapture(c.Request().Context(), h.repoOperation, h.setting.Data, name, anonymizeLabel(c), c.FormValue("filename"), []byte(h.setting.Secret))
+	if errors.Is(err, capture.ErrLabel) {
+		return echo.ErrBadRequest
+	}
+	if err != nil {
+		return err
+	}
+
+	h.playerCache.Invalidate()
+
+	return c.JSONPretty(http.StatusOK, op, "\t")
+}
+
+// GetAnonymizedCapture handles GET /api/v1/captures/:name/anonymized
+// It downloads an anonymized copy of a stored capture without storing it.
+// The label query parameter is as for AnonymizeOperation. Pseudonyms are
+// derived from the upload secret, so that they cannot be traced back to
+// names but match those of stored copies.
+func (h *Handler) GetAnonymizedCapture(c echo.Context) error {
+	path, err := h.capturePath(c)
+	if err != nil {
+		return err
+	}
+	name := strings.TrimSuffix(filepath.Base(path), ".gz")
+
+	label := anonymizeLabel(c)
+	if label != capture.LabelPseudonym && label != capture.LabelRole {
+		return echo.ErrBadRequest
+	}
+
+	filename := name + publicSuffix + ".gz"
+	c.Response().Header().Set("Content-Disposition", "attachment;filename=\""+filename+"\"")
+	c.Response().Header().Set("Content-Type", "application/gzip")
+	c.Response().WriteHeader(http.StatusOK)
+
+	gz := gzip.NewWriter(c.Response())
+	if _, err := capture.Anonymize(gz, anonymizeSource(h.setting.Data, name), label, []byte(h.setting.Secret)); err != nil {
+		// The response has started, so the download is cut short instead.
+		return fmt.Errorf("anonymize capture: %w", err)
+	}
+	return gz.Close()
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/OCAP2/web/capture"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnonymizeCapture(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	single, err := processCapture(writeCapture(t, dir, "op", testCapture))
+	require.NoError(t, err)
+	h := newAdminHandler(t, dir, "op")
+	repo := h.repoOperation
+
+	form := url.Values{"secret": {"secret"}, "label": {"role"}}
+	c, rec := formContext("/api/v1/captures/op/anonymize", "op", form)
+	require.NoError(t, h.AnonymizeOperation(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	ops, err := repo.SelectByFilenames(ctx, []string{"op_public"})
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, "TvT", ops[0].Tag)
+
+	report, err := capture.ValidateFile(filepath.Join(dir, "op_public.gz"))
+	require.NoError(t, err)
+	assert.Empty(t, report.Problems)
+	assert.True(t, report.Info.Anonymized)
+
+	// The copy is not counted again in the player statistics.
+	players, err := h.playerCache.GetAll()
+	require.NoError(t, err)
+	for _, p := range players {
+		assert.NotContains(t, p.Name, "Alpha 1-1")
+	}
+	bravo, err := h.playerCache.GetByName("Bravo")
+	require.NoError(t, err)
+	require.NotNil(t, bravo)
+	want := playerByName(single.Players, "Bravo")
+	assert.Equal(t, want.KillCount, bravo.KillCount)
+	assert.Equal(t, want.DeathCount, bravo.DeathCount)
+	assert.Equal(t, 1, bravo.OperationsAttended)
+
+	_, err = AnonymizeCapture(ctx, repo, dir, "op", capture.LabelPseudonym, "", nil)
+	assert.ErrorIs(t, err, ErrExists)
+	_, err = AnonymizeCapture(ctx, repo, dir, "op", "nickname", "op_nick", nil)
+	assert.ErrorIs(t, err, capture.ErrLabel)
+	assert.NoFileExists(t, filepath.Join(dir, "op_nick.gz"))
+
+	// As a download.
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/captures/op/anonymized", nil)
+	rec = httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.SetParamNames("name")
+	c.SetParamValues("op")
+	require.NoError(t, h.GetAnonymizedCapture(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Disposition"), "op_public.gz")
+
+	gz, err := gzip.NewReader(rec.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), `"Bravo"`)
+	assert.Contains(t, string(body), `"anonymized":true`)
+
+	form.Set("secret", "wrong")
+	c, _ = formContext("/api/v1/captures/op/anonymize", "op", form)
+	assert.ErrorIs(t, h.AnonymizeOperation(c), echo.ErrForbidden)
+}
+
+func TestAnonymizeCaptureStoreFails(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeCapture(t, dir, "op", testCapture)
+	repo := newAdminHandler(t, dir, "op").repoOperation
+	_, err := repo.db.Exec(`CREATE TRIGGER no_insert BEFORE INSERT ON operations BEGIN SELECT RAISE(FAIL, 'read only'); END`)
+	require.NoError(t, err)
+
+	// A failed copy leaves nothing behind, so that it can be retried.
+	_, err = AnonymizeCapture(ctx, repo, dir, "op", capture.LabelPseudonym, "", nil)
+	require.Error(t, err)
+	assert.NoFileExists(t, filepath.Join(dir, "op_public.gz"))
+
+	_, err = repo.db.Exec(`DROP TRIGGER no_insert`)
+	require.NoError(t, err)
+	_, err = AnonymizeCapture(ctx, repo, dir, "op", capture.LabelPseudonym, "", nil)
+	require.NoError(t, err)
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// archiveDir is the directory, inside the data directory, that captures
+// replaced by trimming or merging are moved to. It is not scanned for
+// captures, so archived captures are neither listed nor counted in the
+// statistics.
+const archiveDir = "archive"
+
+// maxArchiveNames bounds the names archiveCapture tries for one capture
+// archived several times within the same second.
+const maxArchiveNames = 100
+
+// archiveCapture moves the capture name out of dataDir into its archive,
+// under a name carrying the time it was archived, and removes its binary
+// form. It returns the new path. An archived capture is never overwritten:
+// the capture is linked to a name no other file has before it is removed
+// from dataDir.
+func archiveCapture(dataDir, name string) (string, error) {
+	dir := filepath.Join(dataDir, archiveDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	src := filepath.Join(dataDir, name+".gz")
+	if err := removeBinary(src); err != nil {
+		return "", err
+	}
+	stamp := name + "." + time.Now().Format("20060102-150405")
+	for i := 0; i < maxArchiveNames; i++ {
+		dst := filepath.Join(dir, stamp+".gz")
+		if i > 0 {
+			dst = filepath.Join(dir, fmt.Sprintf("%s-%d.gz", stamp, i))
+		}
+		err := os.Link(src, dst)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if err := os.Remove(src); err != nil {
+			os.Remove(dst)
+			return "", err
+		}
+		return dst, nil
+	}
+	return "", fmt.Errorf("archive %s: %w", stamp, ErrExists)
+}
+
+// restoreCapture moves the archived capture back to the capture name in
+// dataDir, replacing what is there. It undoes archiveCapture when the
+// capture replacing the archived one cannot be registered.
+func restoreCapture(dataDir, name, archived string) error {
+	dst := filepath.Join(dataDir, name+".gz")
+	if err := removeBinary(dst); err != nil {
+		return err
+	}
+	return os.Rename(archived, dst)
+}
+
+// createCapture writes a gzipped capture with write to a temporary file in
+// dataDir and returns its path. Callers move it into place with os.Rename, so
+// that a capture is never seen half written.
+func createCapture(dataDir string, write func(w io.Writer) error) (string, error) {
+	f, err := os.CreateTemp(dataDir, "capture.*.tmp")
+	if err != nil {
+		return "", err
+	}
+
+	gz := gzip.NewWriter(f)
+	err = write(gz)
+	if cerr := gz.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// storedOperation returns the operation registered for the capture name.
+func storedOperation(ctx context.Context, repo *RepoOperation, name string) (*Operation, error) {
+	ops, err := repo.SelectByFilenames(ctx, []string{name})
+	if err != nil {
+		return nil, fmt.Errorf("select operation: %w", err)
+	}
+	if len(ops) == 0 {
+		return nil, ErrNotFound
+	}
+	return &ops[0], nil
+}
+
+// captureExists reports whether dataDir holds the capture name.
+func captureExists(dataDir, name string) bool {
+	_, err := os.Stat(filepath.Join(dataDir, name+".gz"))
+	return err == nil
+}
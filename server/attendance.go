@@ -0,0 +1,213 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// PresenceInterval is a half-open range of capture frames [StartFrame,
+// EndFrame) during which a player was in the mission.
+type PresenceInterval struct {
+	StartFrame int `json:"start_frame"`
+	EndFrame   int `json:"end_frame"`
+}
+
+// PlayerAppearance records one operation a player attended.
+type PlayerAppearance struct {
+	Filename    string             `json:"filename"`
+	WorldName   string             `json:"world_name"`
+	MissionName string             `json:"mission_name"`
+	Date        string             `json:"date"`
+	Side        string             `json:"side"`
+	Role        string             `json:"role"`
+	Group       string             `json:"group"`
+	Kills       int                `json:"kills"`
+	Deaths      int                `json:"deaths"`
+	Minutes     float64            `json:"minutes"`
+	Presence    []PresenceInterval `json:"presence"`
+
+	captureDelay float64
+	notableKills []NotableKill
+}
+
+// PlayerAttendance is the output of the attendance endpoint. Streaks count
+// consecutive calendar weeks, starting on Monday, with at least one operation.
+type PlayerAttendance struct {
+	Name               string             `json:"name"`
+	OperationsAttended int                `json:"operations_attended"`
+	MinutesPlayed      float64            `json:"minutes_played"`
+	FirstSeen          string             `json:"first_seen"`
+	LastSeen           string             `json:"last_seen"`
+	LongestWeekStreak  int                `json:"longest_week_streak"`
+	CurrentWeekStreak  int                `json:"current_week_streak"`
+	Operations         []PlayerAppearance `json:"operations"`
+}
+
+// mergePresence sorts intervals and joins those that overlap or touch.
+func mergePresence(intervals []PresenceInterval) []PresenceInterval {
+	if len(intervals) == 0 {
+		return intervals
+	}
+
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i].StartFrame < intervals[j].StartFrame
+	})
+
+	merged := intervals[:1]
+	for _, iv := range intervals[1:] {
+		last := &merged[len(merged)-1]
+		if iv.StartFrame <= last.EndFrame {
+			if iv.EndFrame > last.EndFrame {
+				last.EndFrame = iv.EndFrame
+			}
+			continue
+		}
+		merged = append(merged, iv)
+	}
+	return merged
+}
+
+// clipPresence removes the frames between each disconnect and the following
+// reconnect from intervals. Both frame lists must be sorted.
+func clipPresence(intervals []PresenceInterval, disconnects, connects []int) []PresenceInterval {
+	for _, d := range disconnects {
+		// The player stays away until their next connect, if any.
+		back := -1
+		if i := sort.SearchInts(connects, d+1); i < len(connects) {
+			back = connects[i]
+		}
+
+		clipped := intervals[:0:0]
+		for _, iv := range intervals {
+			if iv.EndFrame <= d || (back >= 0 && iv.StartFrame >= back) {
+				clipped = append(clipped, iv)
+				continue
+			}
+			if iv.StartFrame < d {
+				clipped = append(clipped, PresenceInterval{StartFrame: iv.StartFrame, EndFrame: d})
+			}
+			if back >= 0 && iv.EndFrame > back {
+				clipped = append(clipped, PresenceInterval{StartFrame: back, EndFrame: iv.EndFrame})
+			}
+		}
+		intervals = clipped
+	}
+	return intervals
+}
+
+// presenceMinutes converts the frames covered by intervals into minutes.
+func presenceMinutes(intervals []PresenceInterval, captureDelay float64) float64 {
+	frames := 0
+	for _, iv := range intervals {
+		frames += iv.EndFrame - iv.StartFrame
+	}
+	return float64(frames) * captureDelay / 60
+}
+
+// weekIndex returns the number of Monday-based weeks between 1970-01-05 and
+// date, or false when date cannot be parsed.
+func weekIndex(date string) (int, bool) {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return 0, false
+	}
+	days := int(t.Sub(time.Date(1970, 1, 5, 0, 0, 0, 0, time.UTC)).Hours() / 24)
+	if days < 0 {
+		days -= 6
+	}
+	return days / 7, true
+}
+
+// weekStreaks returns the longest run of consecutive weeks among dates and
+// the run still going at now. A run is still going if it includes the current
+// or the previous week, so a player is not reset before the week is over.
+func weekStreaks(dates []string, now time.Time) (longest, current int) {
+	seen := make(map[int]bool)
+	weeks := []int{}
+	for _, d := range dates {
+		w, ok := weekIndex(d)
+		if ok && !seen[w] {
+			seen[w] = true
+			weeks = append(weeks, w)
+		}
+	}
+	if len(weeks) == 0 {
+		return 0, 0
+	}
+	sort.Ints(weeks)
+
+	run := 0
+	for i, w := range weeks {
+		if i > 0 && w == weeks[i-1]+1 {
+			run++
+		} else {
+			run = 1
+		}
+		if run > longest {
+			longest = run
+		}
+	}
+
+	thisWeek, _ := weekIndex(now.Format("2006-01-02"))
+	if last := weeks[len(weeks)-1]; last >= thisWeek-1 {
+		current = run
+	}
+
+	return longest, current
+}
+
+// newPlayerAttendance summarises a player's appearances, which must be sorted
+// by date.
+func newPlayerAttendance(name string, appearances []PlayerAppearance, now time.Time) PlayerAttendance {
+	a := PlayerAttendance{
+		Name:               name,
+		OperationsAttended: len(appearances),
+		Operations:         appearances,
+	}
+	if a.Operations == nil {
+		a.Operations = []PlayerAppearance{}
+	}
+
+	dates := make([]string, 0, len(appearances))
+	for _, op := range appearances {
+		a.MinutesPlayed += op.Minutes
+		dates = append(dates, op.Date)
+	}
+	if len(dates) > 0 {
+		a.FirstSeen = dates[0]
+		a.LastSeen = dates[len(dates)-1]
+	}
+	a.LongestWeekStreak, a.CurrentWeekStreak = weekStreaks(dates, now)
+
+	return a
+}
+
+// GetPlayerAttendance handles GET /api/v1/players/:name/attendance
+// It lists the operations a player attended, how long they were present in
+// each, and their weekly attendance streaks.
+func (h *Handler) GetPlayerAttendance(c echo.Context) error {
+	playerName, err := url.PathUnescape(c.Param("name"))
+	if err != nil {
+		return err
+	}
+
+	player, err := h.playerCache.GetByName(playerName)
+	if err != nil {
+		return fmt.Errorf("process player events by name: %w", err)
+	}
+	if player == nil {
+		return echo.ErrNotFound
+	}
+
+	appearances, err := h.playerCache.GetAppearances(player.Name)
+	if err != nil {
+		return fmt.Errorf("process player attendance: %w", err)
+	}
+
+	return c.JSONPretty(http.StatusOK, newPlayerAttendance(player.Name, appearances, time.Now()), "\t")
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresence(t *testing.T) {
+	stats := processFixture(t, `{
+		"worldName": "Altis", "missionName": "Op", "endFrame": 10, "captureDelay": 2,
+		"times": [{"frameNum": 0, "systemTimeUTC": "2024-03-09T19:00:00.000"}],
+		"entities": [
+			{"type": "unit", "id": 0, "name": "Alpha", "side": "WEST", "isPlayer": 1, "startFrameNum": 2,
+				"positions": [[[0, 0], 0, 1, 0, "Alpha"], [], [], []]},
+			{"type": "unit", "id": 1, "name": "Bravo", "side": "WEST", "isPlayer": 1, "startFrameNum": 0,
+				"positions": [[[0, 0], 0, 1, 0, "Bravo", 0], [[0, 0], 0, 1, 0, "Bravo", 1], [], [], [[0, 0], 0, 1, 0, "Bravo", 0], [[0, 0], 0, 1, 0, "Bravo", 1]]},
+			{"type": "unit", "id": 2, "name": "Charlie", "side": "EAST", "isPlayer": 1, "startFrameNum": 0,
+				"positions": [[[0, 0], 0, 1, 0, "Charlie"], [], [], [], [], []]}
+		],
+		"events": [
+			[2, "disconnected", "Bravo"],
+			[3, "connected", "Bravo"],
+			[4, "disconnected", "Charlie"]
+		]
+	}`)
+
+	// Without the per-frame player flag, the whole lifetime counts.
+	alpha := playerByName(stats.Players, "Alpha")
+	require.NotNil(t, alpha)
+	assert.Equal(t, []PresenceInterval{{2, 6}}, alpha.Presence)
+	assert.InDelta(t, 8.0/60, alpha.MinutesPlayed, 1e-9)
+	assert.Equal(t, 1, alpha.OperationsAttended)
+	assert.Equal(t, "2024-03-09", alpha.FirstSeen)
+	assert.Equal(t, "2024-03-09", alpha.LastSeen)
+
+	// With it, only frames under player control count, less the time
+	// between a disconnect and the reconnect.
+	bravo := playerByName(stats.Players, "Bravo")
+	require.NotNil(t, bravo)
+	assert.Equal(t, []PresenceInterval{{1, 2}, {3, 4}, {5, 6}}, bravo.Presence)
+	assert.InDelta(t, 6.0/60, bravo.MinutesPlayed, 1e-9)
+
+	// Without a reconnect the player is gone for good.
+	charlie := playerByName(stats.Players, "Charlie")
+	require.NotNil(t, charlie)
+	assert.Equal(t, []PresenceInterval{{0, 4}}, charlie.Presence)
+}
+
+func TestWeekStreaks(t *testing.T) {
+	// 2024-03-04 is a Monday.
+	dates := []string{"2024-02-12", "2024-03-04", "2024-03-10", "2024-03-11", "2024-03-20", "2024-03-21"}
+
+	longest, current := weekStreaks(dates, time.Date(2024, 3, 27, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, 3, longest)
+	assert.Equal(t, 3, current)
+
+	_, current = weekStreaks(dates, time.Date(2024, 4, 10, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, 0, current)
+}
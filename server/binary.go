@@ -0,0 +1,107 @@
+package server
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/OCAP2/web/ocapbin"
+)
+
+// acceptsBinary reports whether an Accept header asks for the binary capture
+// format.
+func acceptsBinary(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, _ := strings.Cut(part, ";")
+		if strings.TrimSpace(mediaType) == ocapbin.MediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// conversions runs one conversion per capture at a time.
+var conversions flightGroup[string]
+
+// binaryPath returns the path of the binary form of the capture at gzPath.
+func binaryPath(gzPath string) string {
+	return strings.TrimSuffix(gzPath, ".gz") + ocapbin.Extension
+}
+
+// binaryCapture returns the path of the binary form of the capture at
+// gzPath, converting the capture first if the binary form is missing or older
+// than the capture. Requests for a capture being converted wait for that
+// conversion.
+func binaryCapture(gzPath string) (string, error) {
+	binPath := binaryPath(gzPath)
+	if fresh, err := binaryFresh(gzPath, binPath); err != nil || fresh {
+		return binPath, err
+	}
+
+	return conversions.do(gzPath, func() (string, error) {
+		// The capture may have been converted since it was checked.
+		if fresh, err := binaryFresh(gzPath, binPath); err != nil || fresh {
+			return binPath, err
+		}
+		if err := convertCapture(gzPath, binPath); err != nil {
+			return "", fmt.Errorf("convert capture: %w", err)
+		}
+		return binPath, nil
+	})
+}
+
+// binaryFresh reports whether binPath exists and is not older than the
+// capture at gzPath.
+func binaryFresh(gzPath, binPath string) (bool, error) {
+	src, err := os.Stat(gzPath)
+	if err != nil {
+		return false, err
+	}
+	dst, err := os.Stat(binPath)
+	return err == nil && !dst.ModTime().Before(src.ModTime()), nil
+}
+
+// removeBinary removes the binary form of the capture at gzPath, if any.
+func removeBinary(gzPath string) error {
+	if err := os.Remove(binaryPath(gzPath)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// convertCapture writes the binary form of the capture at gzPath to binPath.
+// It writes to a temporary file first, so that concurrent requests never see
+// a partial conversion.
+func convertCapture(gzPath, binPath string) error {
+	f, err := os.Open(gzPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(binPath), filepath.Base(binPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := ocapbin.FromJSON(tmp, gz); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), binPath)
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/OCAP2/web/ocapbin"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCaptureBinary(t *testing.T) {
+	dir := t.TempDir()
+	writeCapture(t, dir, "op", testCapture)
+	hdlr := Handler{setting: Setting{Data: dir}}
+
+	get := func(accept string) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("name")
+		c.SetParamValues("op")
+		require.NoError(t, hdlr.GetCapture(c))
+		return rec
+	}
+
+	rec := get("application/json")
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+
+	rec = get("application/x-ocap-binary;q=1.0, application/json;q=0.5")
+	assert.Equal(t, ocapbin.MediaType, rec.Header().Get("Content-Type"))
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.FileExists(t, filepath.Join(dir, "op"+ocapbin.Extension))
+
+	var out bytes.Buffer
+	require.NoError(t, ocapbin.ToJSON(&out, rec.Body))
+	var want, got any
+	require.NoError(t, json.Unmarshal([]byte(testCapture), &want))
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	assert.Equal(t, want, got)
+}
+
+func TestBinaryCapture(t *testing.T) {
+	dir := t.TempDir()
+	gzPath := writeCapture(t, dir, "op", testCapture)
+	h := newAdminHandler(t, dir, "op")
+
+	// Requests arriving together share a single conversion.
+	const n = 8
+	paths := make([]string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			path, err := binaryCapture(gzPath)
+			assert.NoError(t, err)
+			paths[i] = path
+		}(i)
+	}
+	wg.Wait()
+	for _, path := range paths {
+		assert.Equal(t, binaryPath(gzPath), path)
+	}
+	assert.FileExists(t, binaryPath(gzPath))
+	tmp, err := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, tmp)
+
+	// Trimming in place archives the capture and drops its binary form.
+	_, err = TrimCapture(context.Background(), h.repoOperation, dir, "op", TrimOptions{From: 0, To: 50})
+	require.NoError(t, err)
+	assert.NoFileExists(t, binaryPath(gzPath))
+}
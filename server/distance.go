@@ -0,0 +1,161 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/labstack/echo/v4"
+)
+
+// killDistanceBuckets are the lower bounds, in metres, of the kill distance
+// histogram buckets. The last bucket is open-ended.
+var killDistanceBuckets = []float64{0, 25, 50, 100, 200, 300, 500, 800, 1200}
+
+// DistanceBucket is one bucket of a kill distance histogram.
+type DistanceBucket struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max,omitempty"` // omitted for the open-ended last bucket
+	Count int     `json:"count"`
+}
+
+// WeaponSummary holds statistics for one weapon across every player.
+// ShotsFired only includes shots that could be attributed to the weapon.
+type WeaponSummary struct {
+	Weapon              string  `json:"weapon"`
+	Players             int     `json:"players"`
+	Kills               int     `json:"kills"`
+	Hits                int     `json:"hits"`
+	HitsPerKill         float64 `json:"hits_per_kill"`
+	LongestKill         float64 `json:"longest_kill"`
+	AverageKillDistance float64 `json:"average_kill_distance"`
+	MedianKillDistance  float64 `json:"median_kill_distance"`
+	ShotsFired          int     `json:"shots_fired"`
+	Accuracy            float64 `json:"accuracy"`
+	RoundsPerKill       float64 `json:"rounds_per_kill"`
+}
+
+// summariseDistances returns the longest, average and median distance.
+// All three are zero for an empty slice.
+func summariseDistances(distances []float64) (longest, average, median float64) {
+	if len(distances) == 0 {
+		return 0, 0, 0
+	}
+
+	sorted := append([]float64(nil), distances...)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, d := range sorted {
+		sum += d
+	}
+
+	n := len(sorted)
+	if n%2 == 1 {
+		median = sorted[n/2]
+	} else {
+		median = (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+
+	return sorted[n-1], sum / float64(n), median
+}
+
+// distanceHistogram counts distances into killDistanceBuckets.
+func distanceHistogram(distances []float64) []DistanceBucket {
+	buckets := make([]DistanceBucket, len(killDistanceBuckets))
+	for i, min := range killDistanceBuckets {
+		buckets[i].Min = min
+		if i+1 < len(killDistanceBuckets) {
+			buckets[i].Max = killDistanceBuckets[i+1]
+		}
+	}
+
+	for _, d := range distances {
+		// The bucket is the last one whose lower bound does not exceed d.
+		i := sort.Search(len(killDistanceBuckets), func(i int) bool {
+			return killDistanceBuckets[i] > d
+		}) - 1
+		if i < 0 {
+			i = 0
+		}
+		buckets[i].Count++
+	}
+
+	return buckets
+}
+
+// applyKillDistances fills in the distance fields derived from p.killDistances.
+func applyKillDistances(p *PlayerEventSummary) {
+	p.LongestKill, p.AverageKillDistance, p.MedianKillDistance = summariseDistances(p.killDistances)
+	p.KillDistanceHistogram = distanceHistogram(p.killDistances)
+}
+
+// aggregateWeapons merges the weapon statistics of every player into one
+// summary per weapon, sorted by kills.
+func aggregateWeapons(players []PlayerEventSummary) []WeaponSummary {
+	type weaponAcc struct {
+		WeaponSummary
+		distances []float64
+	}
+	weapons := make(map[string]*weaponAcc)
+
+	for i := range players {
+		for _, ws := range players[i].WeaponStats {
+			w, ok := weapons[ws.Weapon]
+			if !ok {
+				w = &weaponAcc{WeaponSummary: WeaponSummary{Weapon: ws.Weapon}}
+				weapons[ws.Weapon] = w
+			}
+			w.Players++
+			w.Kills += ws.Kills
+			w.Hits += ws.Hits
+			w.ShotsFired += ws.ShotsFired
+			w.distances = append(w.distances, ws.killDistances...)
+		}
+	}
+
+	result := make([]WeaponSummary, 0, len(weapons))
+	for _, w := range weapons {
+		w.HitsPerKill = ratio(w.Hits, w.Kills)
+		w.Accuracy = ratio(w.Hits, w.ShotsFired)
+		w.RoundsPerKill = ratio(w.ShotsFired, w.Kills)
+		w.LongestKill, w.AverageKillDistance, w.MedianKillDistance = summariseDistances(w.distances)
+		result = append(result, w.WeaponSummary)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Kills != result[j].Kills {
+			return result[i].Kills > result[j].Kills
+		}
+		return result[i].Weapon < result[j].Weapon
+	})
+
+	return result
+}
+
+// GetWeaponStats handles GET /api/v1/weapons
+// It returns per-weapon statistics for player kills across all captures.
+func (h *Handler) GetWeaponStats(c echo.Context) error {
+	players, err := h.playerCache.GetAll()
+	if err != nil {
+		return fmt.Errorf("process all player events: %w", err)
+	}
+
+	return c.JSONPretty(http.StatusOK, aggregateWeapons(players), "\t")
+}
+
+// GetCaptureWeaponStats handles GET /api/v1/captures/:name/weapons
+// It returns per-weapon statistics for player kills in a single capture.
+func (h *Handler) GetCaptureWeaponStats(c echo.Context) error {
+	path, err := h.capturePath(c)
+	if err != nil {
+		return err
+	}
+
+	stats, err := processCapture(path)
+	if err != nil {
+		return fmt.Errorf("process player events: %w", err)
+	}
+
+	return c.JSONPretty(http.StatusOK, aggregateWeapons(stats.Players), "\t")
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKillDistances(t *testing.T) {
+	stats := processFixture(t, `{
+		"worldName": "Altis", "missionName": "Op", "endFrame": 10, "captureDelay": 1,
+		"entities": [
+			{"type": "unit", "id": 0, "name": "Alpha", "side": "WEST", "isPlayer": 1, "startFrameNum": 0},
+			{"type": "unit", "id": 1, "name": "Rifleman", "side": "EAST", "isPlayer": 0, "startFrameNum": 0}
+		],
+		"events": [
+			[1, "killed", 1, [0, "MX"], 10],
+			[2, "killed", 1, [0, "MX"], 30],
+			[3, "killed", 1, [0, "LRR"], 200],
+			[4, "killed", 1, [0, "MX"], 60],
+			[5, "killed", 1, [0, "MX"]]
+		]
+	}`)
+
+	// The kill of an older capture, without a distance, only counts as a
+	// kill.
+	alpha := playerByName(stats.Players, "Alpha")
+	require.NotNil(t, alpha)
+	assert.Equal(t, 5, alpha.KillCount)
+	assert.Equal(t, 200.0, alpha.LongestKill)
+	assert.Equal(t, 75.0, alpha.AverageKillDistance)
+	assert.Equal(t, 45.0, alpha.MedianKillDistance)
+	var counts []int
+	for _, b := range alpha.KillDistanceHistogram {
+		counts = append(counts, b.Count)
+	}
+	assert.Equal(t, []int{1, 1, 1, 0, 1, 0, 0, 0, 0}, counts)
+
+	require.Len(t, alpha.WeaponStats, 2)
+	mx := alpha.WeaponStats[0]
+	assert.Equal(t, "MX", mx.Weapon)
+	assert.Equal(t, 4, mx.Kills)
+	assert.Equal(t, 60.0, mx.LongestKill)
+	assert.InDelta(t, 100.0/3, mx.AverageKillDistance, 1e-9)
+	assert.Equal(t, 30.0, mx.MedianKillDistance)
+}
+
+func TestDistanceHistogram(t *testing.T) {
+	buckets := distanceHistogram([]float64{0, 24.9, 25, 150, 1200, 5000})
+
+	require.Len(t, buckets, len(killDistanceBuckets))
+	assert.Equal(t, DistanceBucket{Min: 0, Max: 25, Count: 2}, buckets[0])
+	assert.Equal(t, DistanceBucket{Min: 25, Max: 50, Count: 1}, buckets[1])
+	assert.Equal(t, DistanceBucket{Min: 100, Max: 200, Count: 1}, buckets[3])
+	assert.Equal(t, DistanceBucket{Min: 1200, Count: 2}, buckets[len(buckets)-1])
+}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"sort"
+
+	"github.com/OCAP2/web/capture"
+)
+
+// entityScan holds everything kept from one streamed entity. It is reused
+// across entities so that its buffers are only allocated once.
+type entityScan struct {
+	meta  capture.Entity
+	shots []int // frame of every shot in framesFired
+	track entityTrack
+	// onPosition, if set, is called with every element of positions. The
+	// position is reused for the next element.
+	onPosition func(i int, p *capture.Position)
+}
+
+func (s *entityScan) reset() {
+	s.meta = capture.Entity{}
+	s.shots = s.shots[:0]
+	s.track.reset()
+}
+
+// scanEntities returns a Visitor that streams every entity into scan and
+// calls fn with it once the entity has been read. Positions and framesFired
+// are walked one element at a time so an entity's complete history is never
+// decoded into memory at once.
+func scanEntities(scan *entityScan, fn func(scan *entityScan) error) capture.Visitor {
+	scan.reset()
+
+	return capture.Visitor{
+		Position: func(_, i int, p *capture.Position) error {
+			scan.track.add(i, p)
+			if scan.onPosition != nil {
+				scan.onPosition(i, p)
+			}
+			return nil
+		},
+		Shot: func(_ int, s *capture.Shot) error {
+			if s.Frame >= 0 {
+				scan.shots = append(scan.shots, s.Frame)
+			}
+			return nil
+		},
+		Entity: func(_ int, e *capture.Entity) error {
+			scan.meta = *e
+			err := fn(scan)
+			scan.reset()
+			return err
+		},
+	}
+}
+
+// frameRange is a half-open range of frames [Start, End).
+type frameRange struct {
+	Start, End int
+}
+
+// aliveUnknown stands for the alive state of a unit with no positions.
+const aliveUnknown = -1
+
+// entityTrack summarises an entity's positions while they are streamed.
+// Frames are relative to the entity's startFrameNum, which may only be known
+// once the whole entity has been read.
+type entityTrack struct {
+	frames int
+	// lastAlive is the alive state of the last element, or aliveUnknown
+	// when there were no positions.
+	lastAlive int
+	// Transitions of the alive state: alive to unconscious, unconscious
+	// back to alive, and unconscious to dead.
+	downed     int
+	revived    int
+	diedDowned int
+	// lives holds each span between spawning and dying; the last one stays
+	// open until the unit dies.
+	lives    []lifeRun
+	lifeOpen bool
+	move     movementTrack
+	// playerFlag reports whether any element carried the per-frame isPlayer
+	// flag; playerRuns holds the ranges where it was set.
+	playerFlag bool
+	playerRuns []frameRange
+	// crew holds the frames each unit spent in a vehicle. Elements that
+	// carry a frame range use absolute frames; crewAbsolute records that.
+	crew         []crewRun
+	crewAbsolute bool
+	lastCrewRun  map[int]int // unit ID -> index of its latest run in crew
+}
+
+// crewRun is a range of frames [Start, End) during which Unit was in Vehicle.
+type crewRun struct {
+	Unit, Vehicle int
+	Start, End    int
+}
+
+func (t *entityTrack) reset() {
+	t.frames = 0
+	t.lastAlive = aliveUnknown
+	t.downed, t.revived, t.diedDowned = 0, 0, 0
+	t.lives = t.lives[:0]
+	t.lifeOpen = false
+	t.move.reset()
+	t.playerFlag = false
+	t.playerRuns = t.playerRuns[:0]
+	t.crew = t.crew[:0]
+	t.crewAbsolute = false
+	if t.lastCrewRun == nil || len(t.lastCrewRun) > 0 {
+		t.lastCrewRun = make(map[int]int)
+	}
+}
+
+// add records the position at relative frame i.
+func (t *entityTrack) add(i int, p *capture.Position) {
+	t.frames = i + 1
+	t.addTransition(p.Alive)
+	t.addLife(i, p.Alive)
+	t.move.add(p)
+	t.lastAlive = p.Alive
+	t.addCrew(i, p)
+
+	if p.IsPlayer < 0 {
+		return
+	}
+	t.playerFlag = true
+	if p.IsPlayer != 1 {
+		return
+	}
+	if n := len(t.playerRuns); n > 0 && t.playerRuns[n-1].End == i {
+		t.playerRuns[n-1].End = i + 1
+	} else {
+		t.playerRuns = append(t.playerRuns, frameRange{Start: i, End: i + 1})
+	}
+}
+
+// addTransition counts the change from the previous alive state to alive.
+func (t *entityTrack) addTransition(alive int) {
+	switch {
+	case t.lastAlive == capture.StateAlive && alive == capture.StateUnconscious:
+		t.downed++
+	case t.lastAlive == capture.StateUnconscious && alive == capture.StateAlive:
+		t.revived++
+	case t.lastAlive == capture.StateUnconscious && alive == capture.StateDead:
+		t.diedDowned++
+	}
+}
+
+// lifeRun is a range of relative frames [Start, End) during which a unit was
+// alive or unconscious. Died is false if it was still alive at the end.
+type lifeRun struct {
+	Start, End int
+	Died       bool
+}
+
+// addLife extends the current life with relative frame i, or ends it if the
+// unit is dead. A unit coming back to life after dying has respawned.
+func (t *entityTrack) addLife(i, alive int) {
+	if alive == capture.StateDead {
+		if t.lifeOpen {
+			t.lives[len(t.lives)-1].Died = true
+			t.lifeOpen = false
+		}
+		return
+	}
+
+	if !t.lifeOpen {
+		t.lives = append(t.lives, lifeRun{Start: i})
+		t.lifeOpen = true
+	}
+	t.lives[len(t.lives)-1].End = i + 1
+}
+
+// addCrew extends the crew runs with the crew of the position at relative
+// frame i.
+func (t *entityTrack) addCrew(i int, p *capture.Position) {
+	start, end := i, i+1
+	if p.Frames[0] >= 0 && p.Frames[1] >= p.Frames[0] {
+		start, end = p.Frames[0], p.Frames[1]+1
+		t.crewAbsolute = true
+	}
+
+	for _, unit := range p.Crew {
+		if j, ok := t.lastCrewRun[unit]; ok && t.crew[j].End == start {
+			t.crew[j].End = end
+			continue
+		}
+		t.lastCrewRun[unit] = len(t.crew)
+		t.crew = append(t.crew, crewRun{Unit: unit, Start: start, End: end})
+	}
+}
+
+// crewRuns returns a copy of the crew runs of vehicle id in absolute frames.
+func (t *entityTrack) crewRuns(id, startFrame int) []crewRun {
+	runs := make([]crewRun, len(t.crew))
+	for i, r := range t.crew {
+		r.Vehicle = id
+		if !t.crewAbsolute {
+			r.Start += startFrame
+			r.End += startFrame
+		}
+		runs[i] = r
+	}
+	return runs
+}
+
+// presence returns the absolute frame ranges during which a player controlled
+// the entity. Captures without the per-frame flag count the whole lifetime.
+func (t *entityTrack) presence(startFrame int) []PresenceInterval {
+	if !t.playerFlag {
+		if t.frames == 0 {
+			return nil
+		}
+		return []PresenceInterval{{StartFrame: startFrame, EndFrame: startFrame + t.frames}}
+	}
+
+	intervals := make([]PresenceInterval, 0, len(t.playerRuns))
+	for _, r := range t.playerRuns {
+		intervals = append(intervals, PresenceInterval{StartFrame: startFrame + r.Start, EndFrame: startFrame + r.End})
+	}
+	return intervals
+}
+
+// weaponUse records the weapon a player used in a hit or kill event.
+type weaponUse struct {
+	frame  int
+	weapon string
+}
+
+// attributeShots assigns each player's shots to a weapon. framesFired does
+// not name the weapon, so every shot is credited to the weapon of the
+// player's next hit or kill, or failing that to the weapon of their last one.
+// Players who never hit anything keep their shots unattributed.
+func (p *playerAcc) attributeShots() {
+	if len(p.weaponUses) == 0 {
+		return
+	}
+
+	sort.SliceStable(p.weaponUses, func(i, j int) bool {
+		return p.weaponUses[i].frame < p.weaponUses[j].frame
+	})
+
+	for _, frame := range p.shotFrames {
+		i := sort.Search(len(p.weaponUses), func(i int) bool {
+			return p.weaponUses[i].frame >= frame
+		})
+		if i == len(p.weaponUses) {
+			i--
+		}
+		p.weapon(p.weaponUses[i].weapon).ShotsFired++
+	}
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShotStats(t *testing.T) {
+	stats := processFixture(t, `{
+		"worldName": "Altis", "missionName": "Op", "endFrame": 10, "captureDelay": 1,
+		"entities": [
+			{"type": "unit", "id": 0, "name": "Alpha", "side": "WEST", "isPlayer": 1, "startFrameNum": 0,
+				"framesFired": [[1, [0, 0, 0]], [2, [0, 0, 0]], ["bad"], [5, [0, 0, 0]], [9, [0, 0, 0]], [9, [0, 0, 0]]]},
+			{"type": "unit", "id": 1, "name": "Bravo", "side": "WEST", "isPlayer": 1, "startFrameNum": 0,
+				"framesFired": [[1, [0, 0, 0]]]},
+			{"type": "unit", "id": 2, "name": "Rifleman", "side": "EAST", "isPlayer": 0, "startFrameNum": 0}
+		],
+		"events": [
+			[3, "hit", 2, [0, "MX"], 50],
+			[6, "killed", 2, [0, "Pistol"], 10]
+		]
+	}`)
+
+	// Unreadable shots are not counted.
+	alpha := playerByName(stats.Players, "Alpha")
+	require.NotNil(t, alpha)
+	assert.Equal(t, 5, alpha.ShotsFired)
+	assert.Equal(t, 0.2, alpha.Accuracy)
+	assert.Equal(t, 5.0, alpha.RoundsPerKill)
+
+	// Shots go to the weapon of the next hit or kill, then the last one.
+	require.Len(t, alpha.WeaponStats, 2)
+	pistol, mx := alpha.WeaponStats[0], alpha.WeaponStats[1]
+	assert.Equal(t, "Pistol", pistol.Weapon)
+	assert.Equal(t, 3, pistol.ShotsFired)
+	assert.Equal(t, 3.0, pistol.RoundsPerKill)
+	assert.Equal(t, "MX", mx.Weapon)
+	assert.Equal(t, 2, mx.ShotsFired)
+	assert.Equal(t, 0.5, mx.Accuracy)
+
+	// Without a hit or kill, shots cannot be attributed to a weapon.
+	bravo := playerByName(stats.Players, "Bravo")
+	require.NotNil(t, bravo)
+	assert.Equal(t, 1, bravo.ShotsFired)
+	assert.Zero(t, bravo.Accuracy)
+	assert.Empty(t, bravo.WeaponStats)
+}
+
+func TestDownedStats(t *testing.T) {
+	stats := processFixture(t, `{
+		"worldName": "Altis", "missionName": "Op", "endFrame": 10, "captureDelay": 1,
+		"entities": [
+			{"type": "unit", "id": 0, "name": "Alpha", "side": "WEST", "isPlayer": 1, "startFrameNum": 0,
+				"positions": [[[0, 0], 0, 1, 0, "Alpha", 1], [[0, 0], 0, 2, 0, "Alpha", 1], [[0, 0], 0, 1, 0, "Alpha", 1],
+					[[0, 0], 0, 2, 0, "Alpha", 1], [[0, 0], 0, 2, 0, "Alpha", 1], [[0, 0], 0, 0, 0, "Alpha", 1]]},
+			{"type": "unit", "id": 1, "name": "Bravo", "side": "WEST", "isPlayer": 1, "startFrameNum": 0,
+				"positions": [[[0, 0], 0, 2, 0, "Bravo", 1], [[0, 0], 0, 1, 0, "Bravo", 1], [[0, 0], 0, 0, 0, "Bravo", 1]]},
+			{"type": "unit", "id": 2, "name": "Charlie", "side": "EAST", "isPlayer": 1, "startFrameNum": 0,
+				"positions": [[[0, 0], 0, 1, 0, "Charlie", 1], [[0, 0], 0, 0, 0, "Charlie", 1]]}
+		]
+	}`)
+
+	// Downed twice: revived once, then died unconscious.
+	alpha := playerByName(stats.Players, "Alpha")
+	require.NotNil(t, alpha)
+	assert.Equal(t, 2, alpha.TimesDowned)
+	assert.Equal(t, 1, alpha.Revives)
+	assert.Equal(t, 1, alpha.DeathsAfterDowned)
+
+	// Spawning unconscious is not being downed, but getting up is a revive.
+	bravo := playerByName(stats.Players, "Bravo")
+	require.NotNil(t, bravo)
+	assert.Equal(t, 0, bravo.TimesDowned)
+	assert.Equal(t, 1, bravo.Revives)
+	assert.Equal(t, 0, bravo.DeathsAfterDowned)
+
+	// Killed outright.
+	charlie := playerByName(stats.Players, "Charlie")
+	require.NotNil(t, charlie)
+	assert.Equal(t, 0, charlie.TimesDowned)
+	assert.Equal(t, 0, charlie.Revives)
+	assert.Equal(t, 0, charlie.DeathsAfterDowned)
+}
@@ -5,4 +5,5 @@ import "errors"
 var (
 	ErrNotFound    = errors.New("not found")
 	ErrInvalidPath = errors.New("invalid path")
+	ErrExists      = errors.New("already exists")
 )
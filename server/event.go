@@ -0,0 +1,348 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/OCAP2/web/capture"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	eventsDefaultLimit = 100
+	eventsMaxLimit     = 1000
+)
+
+// CaptureEventFilter holds the query parameters of the capture events
+// endpoint. Type is a comma separated list of event types; a trailing "*"
+// matches by prefix, so "terminalHack*" selects every terminal hack event.
+// Entity is a unit ID or name, matched against every unit an event involves.
+// Side matches events involving a unit of that side, or ending the mission in
+// its favour. Frame and time bounds are inclusive; time is in seconds.
+type CaptureEventFilter struct {
+	Type      string   `query:"type"`
+	Entity    string   `query:"entity"`
+	Side      string   `query:"side"`
+	FromFrame *int     `query:"from_frame"`
+	ToFrame   *int     `query:"to_frame"`
+	FromTime  *float64 `query:"from_time"`
+	ToTime    *float64 `query:"to_time"`
+	Limit     int      `query:"limit"`
+	Offset    int      `query:"offset"`
+}
+
+// EventUnit identifies an entity taking part in an event.
+type EventUnit struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Side string `json:"side"`
+}
+
+// CaptureEvent is one event of a capture. Which fields are set depends on the
+// type: hit and killed events have Victim, CausedBy and Weapon, connections,
+// captures and terminal hacks have Player, and endMission has Side and
+// Message. Data holds the raw payload of everything but hit and killed
+// events.
+type CaptureEvent struct {
+	Frame    int             `json:"frame"`
+	Time     float64         `json:"time"`
+	Type     string          `json:"type"`
+	Victim   *EventUnit      `json:"victim,omitempty"`
+	CausedBy *EventUnit      `json:"caused_by,omitempty"`
+	Weapon   string          `json:"weapon,omitempty"`
+	Distance *float64        `json:"distance,omitempty"`
+	Player   string          `json:"player,omitempty"`
+	Side     string          `json:"side,omitempty"`
+	Message  string          `json:"message,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+}
+
+// CaptureEventPage is the output of the capture events endpoint.
+type CaptureEventPage struct {
+	Total  int            `json:"total"`
+	Limit  int            `json:"limit"`
+	Offset int            `json:"offset"`
+	Events []CaptureEvent `json:"events"`
+}
+
+// matchEventType reports whether eventType is selected by the comma separated
+// list of types. An empty list selects everything, and "captured" also
+// selects the deprecated "capturedFlag".
+func matchEventType(types, eventType string) bool {
+	if types == "" {
+		return true
+	}
+	for _, t := range strings.Split(types, ",") {
+		t = strings.TrimSpace(t)
+		switch {
+		case t == "":
+		case strings.HasSuffix(t, "*"):
+			if strings.HasPrefix(eventType, strings.TrimSuffix(t, "*")) {
+				return true
+			}
+		case t == eventType, t == "captured" && eventType == "capturedFlag":
+			return true
+		}
+	}
+	return false
+}
+
+// eventPage collects a page of the events of a capture while it is streamed.
+// Events are converted and filtered as they are read, and only those on the
+// page are kept. That needs the entities and the capture delay, which come
+// before the events in captures written by the addon; events of captures
+// laid out otherwise are kept until the end and filtered then.
+type eventPage struct {
+	filter       CaptureEventFilter
+	entities     map[int]capture.Entity
+	captureDelay float64
+	delayKnown   bool
+	ef           *eventFilter // set once events can be filtered as read
+	deferred     bool
+	pending      []capture.Event
+	page         CaptureEventPage
+}
+
+// readCaptureEvents streams the capture at path and returns the page of its
+// events selected by filter.
+func readCaptureEvents(path string, filter CaptureEventFilter) (*CaptureEventPage, error) {
+	p := eventPage{
+		filter:       filter,
+		entities:     make(map[int]capture.Entity),
+		captureDelay: 1,
+		page: CaptureEventPage{
+			Limit:  filter.Limit,
+			Offset: filter.Offset,
+			Events: []CaptureEvent{},
+		},
+	}
+
+	_, err := capture.WalkFile(path, capture.Visitor{
+		Header: func(key string, h *capture.Header) error {
+			if key == "captureDelay" {
+				p.captureDelay, p.delayKnown = h.CaptureDelay, true
+			}
+			return nil
+		},
+		Entity: func(_ int, e *capture.Entity) error {
+			p.entities[e.ID] = *e
+			return nil
+		},
+		Event: func(_ int, e *capture.Event) error {
+			if len(e.Fields) == 0 || !matchEventType(filter.Type, e.Type) {
+				return nil
+			}
+			if p.ef == nil && !p.deferred {
+				if len(p.entities) > 0 && p.delayKnown {
+					p.ef = newEventFilter(filter, p.entities)
+				} else {
+					p.deferred = true
+				}
+			}
+			if p.deferred {
+				p.pending = append(p.pending, *e)
+				return nil
+			}
+			p.add(e)
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if p.deferred {
+		p.ef = newEventFilter(filter, p.entities)
+		for i := range p.pending {
+			p.add(&p.pending[i])
+		}
+	}
+	return &p.page, nil
+}
+
+// add counts ev if it is selected, keeping it if it falls on the page.
+func (p *eventPage) add(ev *capture.Event) {
+	out, ok := captureEvent(ev, p.entities, p.captureDelay)
+	if !ok || !p.ef.match(&out) {
+		return
+	}
+	if p.page.Total >= p.page.Offset && len(p.page.Events) < p.page.Limit {
+		p.page.Events = append(p.page.Events, out)
+	}
+	p.page.Total++
+}
+
+// eventUnit returns the entity with the given ID, or nil if there is none.
+func eventUnit(entities map[int]capture.Entity, id int) *EventUnit {
+	e, ok := entities[id]
+	if !ok {
+		return nil
+	}
+	return &EventUnit{ID: e.ID, Name: e.Name, Side: e.Side}
+}
+
+// captureEvent converts a raw event into its output form. It reports false
+// for hit and killed events whose payload cannot be read.
+func captureEvent(ev *capture.Event, entities map[int]capture.Entity, captureDelay float64) (CaptureEvent, bool) {
+	out := CaptureEvent{
+		Frame: ev.Frame,
+		Time:  float64(ev.Frame) * captureDelay,
+		Type:  ev.Type,
+	}
+	payload := ev.Fields[0]
+
+	switch ev.Type {
+	case capture.EventHit, capture.EventKilled:
+		hk, ok := parseHitKilledEvent(ev)
+		if !ok {
+			return out, false
+		}
+		out.Victim = eventUnit(entities, hk.VictimID)
+		out.CausedBy = eventUnit(entities, hk.CausedByID)
+		out.Weapon = hk.Weapon
+		if hk.HasDistance {
+			d := hk.Distance
+			out.Distance = &d
+		}
+		return out, true
+
+	case capture.EventConnected, capture.EventDisconnected:
+		out.Player, _ = ev.Connection()
+
+	case capture.EventEndMission:
+		if end, err := ev.EndMission(); err == nil {
+			out.Side = normaliseSide(end.Side)
+			out.Message = end.Message
+		}
+
+	default:
+		// Captures are [type, unit, ...], the deprecated capturedFlag and
+		// terminal hacks [unit, ...].
+		var fields []json.RawMessage
+		if json.Unmarshal(payload, &fields) == nil {
+			i := 0
+			if ev.Type == capture.EventCaptured {
+				i = 1
+			}
+			if i < len(fields) {
+				_ = json.Unmarshal(fields[i], &out.Player)
+			}
+		}
+	}
+
+	out.Data = payload
+	return out, true
+}
+
+// eventFilter selects events by entity, side, frame and time.
+type eventFilter struct {
+	CaptureEventFilter
+	entityID  int
+	isID      bool
+	nameSides map[string]string // unit name -> side
+}
+
+func newEventFilter(f CaptureEventFilter, entities map[int]capture.Entity) *eventFilter {
+	ef := &eventFilter{
+		CaptureEventFilter: f,
+		nameSides:          make(map[string]string),
+	}
+	ef.Side = normaliseSide(strings.TrimSpace(f.Side))
+	ef.Entity = strings.TrimSpace(f.Entity)
+	if id, err := strconv.Atoi(ef.Entity); err == nil {
+		ef.entityID, ef.isID = id, true
+	}
+	for _, e := range entities {
+		if e.Type == "unit" {
+			ef.nameSides[e.Name] = e.Side
+		}
+	}
+	return ef
+}
+
+func (ef *eventFilter) match(ev *CaptureEvent) bool {
+	if ef.FromFrame != nil && ev.Frame < *ef.FromFrame {
+		return false
+	}
+	if ef.ToFrame != nil && ev.Frame > *ef.ToFrame {
+		return false
+	}
+	if ef.FromTime != nil && ev.Time < *ef.FromTime {
+		return false
+	}
+	if ef.ToTime != nil && ev.Time > *ef.ToTime {
+		return false
+	}
+
+	units := []*EventUnit{ev.Victim, ev.CausedBy}
+
+	if ef.Entity != "" {
+		found := false
+		for _, u := range units {
+			if u == nil {
+				continue
+			}
+			if ef.isID && u.ID == ef.entityID || strings.EqualFold(u.Name, ef.Entity) {
+				found = true
+			}
+		}
+		if ev.Player != "" && strings.EqualFold(ev.Player, ef.Entity) {
+			found = true
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if ef.Side != "" {
+		found := ev.Side == ef.Side
+		for _, u := range units {
+			if u != nil && u.Side == ef.Side {
+				found = true
+			}
+		}
+		if side, ok := ef.nameSides[ev.Player]; ok && ev.Player != "" && side == ef.Side {
+			found = true
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// GetCaptureEvents handles GET /api/v1/captures/:name/events
+// It returns a paginated list of the events of a capture, in the order they
+// were recorded, optionally filtered by type, entity, side, frame and time.
+func (h *Handler) GetCaptureEvents(c echo.Context) error {
+	filter := CaptureEventFilter{}
+	if err := c.Bind(&filter); err != nil {
+		return err
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = eventsDefaultLimit
+	}
+	if filter.Limit > eventsMaxLimit {
+		filter.Limit = eventsMaxLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	path, err := h.capturePath(c)
+	if err != nil {
+		return err
+	}
+
+	page, err := readCaptureEvents(path, filter)
+	if err != nil {
+		return fmt.Errorf("read capture events: %w", err)
+	}
+
+	return c.JSONPretty(http.StatusOK, page, "\t")
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCaptureEvents(t *testing.T) {
+	dir := t.TempDir()
+	writeCapture(t, dir, "op", testCapture)
+	hdlr := Handler{setting: Setting{Data: dir}}
+
+	get := func(query string) CaptureEventPage {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("name")
+		c.SetParamValues("op")
+		require.NoError(t, hdlr.GetCaptureEvents(c))
+
+		var page CaptureEventPage
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+		return page
+	}
+
+	frames := func(events []CaptureEvent) []int {
+		result := make([]int, 0, len(events))
+		for _, ev := range events {
+			result = append(result, ev.Frame)
+		}
+		return result
+	}
+
+	page := get("")
+	assert.Equal(t, 16, page.Total)
+	assert.Equal(t, eventsDefaultLimit, page.Limit)
+
+	page = get("type=killed&side=EAST")
+	assert.Equal(t, []int{10, 20, 40, 50, 60, 70}, frames(page.Events))
+
+	page = get("entity=Bravo")
+	assert.Equal(t, []int{3, 5, 7, 9, 30, 80}, frames(page.Events))
+	assert.Equal(t, "Bravo", page.Events[0].Player)
+	assert.Equal(t, &EventUnit{ID: 1, Name: "Bravo", Side: "WEST"}, page.Events[5].CausedBy)
+
+	page = get("type=endMission&from_frame=85")
+	require.Len(t, page.Events, 2)
+	assert.Equal(t, "GUER", page.Events[0].Side)
+	assert.Equal(t, "Independent wins", page.Events[0].Message)
+
+	page = get("type=connected,disc*&limit=2&offset=1")
+	assert.Equal(t, 3, page.Total)
+	assert.Equal(t, []int{5, 7}, frames(page.Events))
+
+	page = get("type=hit&to_time=8.5")
+	require.Len(t, page.Events, 1)
+	assert.Equal(t, "MX", page.Events[0].Weapon)
+	assert.Equal(t, 120.0, *page.Events[0].Distance)
+}
+
+func TestReadCaptureEventsLayout(t *testing.T) {
+	// Events before the entities and the capture delay are filtered once
+	// the whole capture has been read.
+	path := writeCapture(t, t.TempDir(), "op", `{
+		"events": [
+			[1, "hit", 0, [1, "MX"], 10],
+			[2, "killed", 0, [1, "MX"], 10],
+			[3, "killed", 1, ["null"], 0],
+			[4, "connected", "Bravo"]
+		],
+		"entities": [
+			{"type": "unit", "id": 0, "name": "Alpha", "side": "WEST", "isPlayer": 1, "startFrameNum": 0},
+			{"type": "unit", "id": 1, "name": "Bravo", "side": "EAST", "isPlayer": 1, "startFrameNum": 0}
+		],
+		"captureDelay": 2
+	}`)
+
+	toTime := 6.0
+	page, err := readCaptureEvents(path, CaptureEventFilter{Entity: "Bravo", ToTime: &toTime, Limit: 1, Offset: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 3, page.Total)
+	require.Len(t, page.Events, 1)
+	assert.Equal(t, 2, page.Events[0].Frame)
+	assert.Equal(t, 4.0, page.Events[0].Time)
+	assert.Equal(t, &EventUnit{ID: 1, Name: "Bravo", Side: "EAST"}, page.Events[0].CausedBy)
+}
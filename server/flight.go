@@ -0,0 +1,42 @@
+package server
+
+import "sync"
+
+// flightGroup runs at most one call per key at a time. Callers asking for a
+// key while a call for it is in flight wait for that call and share its
+// result instead of repeating the work. The zero value is ready to use.
+type flightGroup[T any] struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall[T]
+}
+
+type flightCall[T any] struct {
+	done chan struct{}
+	val  T
+	err  error
+}
+
+// do calls fn for key, or waits for the call already in flight.
+func (g *flightGroup[T]) do(key string, fn func() (T, error)) (T, error) {
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-c.done
+		return c.val, c.err
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall[T])
+	}
+	c := &flightCall[T]{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.val, c.err = fn()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	close(c.done)
+
+	return c.val, c.err
+}
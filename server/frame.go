@@ -0,0 +1,433 @@
+package server
+
+import (
+	"compress/gzip"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/OCAP2/web/capture"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// frameWindowDefault is the number of frames returned when no end frame
+	// is given, and frameWindowMax the most returned by one request.
+	frameWindowDefault = 300
+	frameWindowMax     = 1000
+	// frameIndexCacheSize is the number of capture frame indexes kept in
+	// memory.
+	frameIndexCacheSize = 4
+)
+
+// EntityInfo is the metadata of an entity in a capture.
+type EntityInfo struct {
+	ID            int    `json:"id"`
+	Type          string `json:"type"`
+	Name          string `json:"name"`
+	Side          string `json:"side,omitempty"`
+	Group         string `json:"group,omitempty"`
+	Role          string `json:"role,omitempty"`
+	Class         string `json:"class,omitempty"`
+	IsPlayer      bool   `json:"is_player"`
+	StartFrameNum int    `json:"start_frame"`
+}
+
+// EntityState is the state of an entity at one frame. InVehicle and Name
+// only apply to units, Crew to vehicles.
+type EntityState struct {
+	X         float64 `json:"x"`
+	Y         float64 `json:"y"`
+	Direction float64 `json:"direction"`
+	Alive     int     `json:"alive"`
+	InVehicle bool    `json:"in_vehicle,omitempty"`
+	Crew      []int   `json:"crew,omitempty"`
+	Name      string  `json:"name,omitempty"`
+	IsPlayer  bool    `json:"is_player,omitempty"`
+}
+
+// EntityFrames holds the states of one entity for consecutive frames, the
+// first being StartFrame. A state is null for frames in which a vehicle
+// recorded with frame ranges has no position.
+type EntityFrames struct {
+	ID         int            `json:"id"`
+	StartFrame int            `json:"start_frame"`
+	States     []*EntityState `json:"states"`
+}
+
+// FrameWindow is the output of the frames endpoint: the entity metadata of
+// a capture and the states of the entities present in [From, To].
+type FrameWindow struct {
+	WorldName    string         `json:"world_name"`
+	MissionName  string         `json:"mission_name"`
+	CaptureDelay float64        `json:"capture_delay"`
+	EndFrame     int            `json:"end_frame"`
+	From         int            `json:"from"`
+	To           int            `json:"to"`
+	Entities     []EntityInfo   `json:"entities"`
+	Frames       []EntityFrames `json:"frames"`
+}
+
+// FrameWindowFilter holds the query parameters of the frames endpoint. To is
+// inclusive and defaults to a window of frameWindowDefault frames.
+type FrameWindowFilter struct {
+	From int  `query:"from"`
+	To   *int `query:"to"`
+}
+
+// frameState is the compact in-memory form of an EntityState.
+type frameState struct {
+	x, y, dir float32
+	alive     int8
+	inVehicle bool
+	isPlayer  bool
+	crew      []int
+	name      string
+}
+
+// frameTrack holds every state of one entity. Units and most vehicles have
+// one state per frame from start; vehicles recorded with frame ranges have
+// one state per range, starting at the frames in starts and ending at ends
+// (inclusive).
+type frameTrack struct {
+	start  int
+	states []frameState
+	starts []int
+	ends   []int
+}
+
+func (t *frameTrack) ranged() bool {
+	return t.starts != nil
+}
+
+// lastFrame returns the last frame with a state.
+func (t *frameTrack) lastFrame() int {
+	if t.ranged() {
+		if len(t.ends) == 0 {
+			return -1
+		}
+		return t.ends[len(t.ends)-1]
+	}
+	return t.start + len(t.states) - 1
+}
+
+// at returns the state at frame, or nil if the entity has none.
+func (t *frameTrack) at(frame int) *frameState {
+	if !t.ranged() {
+		i := frame - t.start
+		if i < 0 || i >= len(t.states) {
+			return nil
+		}
+		return &t.states[i]
+	}
+
+	i := sort.Search(len(t.starts), func(i int) bool {
+		return t.starts[i] > frame
+	}) - 1
+	if i < 0 || frame > t.ends[i] {
+		return nil
+	}
+	return &t.states[i]
+}
+
+// frameIndex holds the states of every entity of a capture, so that windows
+// of frames can be served without reading the capture again.
+type frameIndex struct {
+	worldName    string
+	missionName  string
+	captureDelay float64
+	endFrame     int
+	entities     []EntityInfo
+	tracks       map[int]*frameTrack
+	modTime      time.Time
+}
+
+// buildFrameIndex streams a capture into a frame index.
+func buildFrameIndex(path string) (*frameIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	idx := &frameIndex{
+		tracks:  make(map[int]*frameTrack),
+		modTime: info.ModTime(),
+	}
+
+	var scan entityScan
+	track := &frameTrack{}
+	scan.onPosition = func(_ int, p *capture.Position) {
+		track.add(p)
+	}
+	walked, err := capture.Walk(gz, scanEntities(&scan, func(scan *entityScan) error {
+		e := scan.meta
+		track.start = e.StartFrameNum
+		idx.tracks[e.ID] = track
+		track = &frameTrack{}
+		idx.entities = append(idx.entities, EntityInfo{
+			ID:            e.ID,
+			Type:          e.Type,
+			Name:          e.Name,
+			Side:          e.Side,
+			Group:         e.Group,
+			Role:          e.Role,
+			Class:         e.Class,
+			IsPlayer:      e.IsPlayer == 1,
+			StartFrameNum: e.StartFrameNum,
+		})
+		return nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+	idx.worldName = walked.WorldName
+	idx.missionName = walked.MissionName
+	idx.captureDelay = walked.CaptureDelay
+	idx.endFrame = walked.EndFrame
+
+	sort.Slice(idx.entities, func(i, j int) bool {
+		return idx.entities[i].ID < idx.entities[j].ID
+	})
+
+	return idx, nil
+}
+
+// add appends the next position of the entity.
+func (t *frameTrack) add(p *capture.Position) {
+	s := frameState{
+		x:         float32(p.X),
+		y:         float32(p.Y),
+		dir:       float32(p.Direction),
+		alive:     int8(p.Alive),
+		inVehicle: p.InVehicle,
+		isPlayer:  p.IsPlayer == 1,
+		name:      p.Name,
+	}
+	if len(p.Crew) > 0 {
+		s.crew = append([]int(nil), p.Crew...)
+	}
+	// Names rarely change, so share the previous string when they don't.
+	if n := len(t.states); n > 0 && t.states[n-1].name == s.name {
+		s.name = t.states[n-1].name
+	}
+
+	if p.Frames[0] >= 0 && p.Frames[1] >= p.Frames[0] {
+		if t.starts == nil {
+			t.starts = []int{}
+		}
+		t.starts = append(t.starts, p.Frames[0])
+		t.ends = append(t.ends, p.Frames[1])
+	}
+	t.states = append(t.states, s)
+}
+
+// window returns the states of every entity present between from and to.
+func (idx *frameIndex) window(from, to int) []EntityFrames {
+	result := []EntityFrames{}
+	for _, e := range idx.entities {
+		t := idx.tracks[e.ID]
+		if t == nil || len(t.states) == 0 {
+			continue
+		}
+
+		first := from
+		if t.ranged() {
+			if t.starts[0] > first {
+				first = t.starts[0]
+			}
+		} else if t.start > first {
+			first = t.start
+		}
+		last := to
+		if l := t.lastFrame(); l < last {
+			last = l
+		}
+		if first > last {
+			continue
+		}
+
+		frames := EntityFrames{
+			ID:         e.ID,
+			StartFrame: first,
+			States:     make([]*EntityState, 0, last-first+1),
+		}
+		for frame := first; frame <= last; frame++ {
+			s := t.at(frame)
+			if s == nil {
+				frames.States = append(frames.States, nil)
+				continue
+			}
+			frames.States = append(frames.States, &EntityState{
+				X:         float64(s.x),
+				Y:         float64(s.y),
+				Direction: float64(s.dir),
+				Alive:     int(s.alive),
+				InVehicle: s.inVehicle,
+				Crew:      s.crew,
+				Name:      s.name,
+				IsPlayer:  s.isPlayer,
+			})
+		}
+		result = append(result, frames)
+	}
+	return result
+}
+
+// FrameIndexCache keeps the frame indexes of the most recently requested
+// captures. An index is rebuilt when its capture file changes; requests for a
+// capture whose index is being built wait for it rather than build it again.
+type FrameIndexCache struct {
+	mu      sync.Mutex
+	indexes map[string]*frameIndex
+	order   []string // least recently used first
+	size    int
+	builds  flightGroup[*frameIndex]
+}
+
+// NewFrameIndexCache creates a cache holding at most size indexes.
+func NewFrameIndexCache(size int) *FrameIndexCache {
+	return &FrameIndexCache{
+		indexes: make(map[string]*frameIndex),
+		size:    size,
+	}
+}
+
+// Get returns the frame index of the capture at path, building it if it is
+// not cached or the file has changed since.
+func (c *FrameIndexCache) Get(path string) (*frameIndex, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if idx, ok := c.cached(path, info.ModTime()); ok {
+		return idx, nil
+	}
+
+	return c.builds.do(path, func() (*frameIndex, error) {
+		// The index may have been built since it was looked up.
+		if idx, ok := c.cached(path, info.ModTime()); ok {
+			return idx, nil
+		}
+		return c.build(path)
+	})
+}
+
+// cached returns the cached index of the capture at path, if it was built
+// from the file as modified at modTime, and marks it as the most recently
+// used.
+func (c *FrameIndexCache) cached(path string, modTime time.Time) (*frameIndex, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	idx, ok := c.indexes[path]
+	if !ok || !idx.modTime.Equal(modTime) {
+		return nil, false
+	}
+	c.touch(path)
+	return idx, true
+}
+
+// touch moves path to the end of the eviction order. c.mu must be held.
+func (c *FrameIndexCache) touch(path string) {
+	for i, p := range c.order {
+		if p == path {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	c.order = append(c.order, path)
+}
+
+// build builds the frame index of the capture at path and caches it.
+func (c *FrameIndexCache) build(path string) (*frameIndex, error) {
+	log.Printf("[frame-index] building index for %s...", path)
+	start := time.Now()
+
+	idx, err := buildFrameIndex(path)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[frame-index] built %d entities in %s", len(idx.entities), time.Since(start))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.touch(path)
+	c.indexes[path] = idx
+	for len(c.order) > c.size {
+		delete(c.indexes, c.order[0])
+		c.order = c.order[1:]
+	}
+
+	return idx, nil
+}
+
+// GetCaptureFrames handles GET /api/v1/captures/:name/frames?from=&to=
+// It returns the entity metadata of a capture and the state of every entity
+// for a window of frames, so that playback can start before the whole
+// capture has been downloaded.
+func (h *Handler) GetCaptureFrames(c echo.Context) error {
+	filter := FrameWindowFilter{}
+	if err := c.Bind(&filter); err != nil {
+		return err
+	}
+
+	path, err := h.capturePath(c)
+	if err != nil {
+		return err
+	}
+
+	idx, err := h.frameIndex.Get(path)
+	if err != nil {
+		return fmt.Errorf("build frame index: %w", err)
+	}
+
+	from := filter.From
+	if from < 0 {
+		from = 0
+	}
+	to := from + frameWindowDefault - 1
+	if filter.To != nil {
+		to = *filter.To
+	}
+	if to < from {
+		return echo.ErrBadRequest
+	}
+	if to-from+1 > frameWindowMax {
+		to = from + frameWindowMax - 1
+	}
+
+	window := FrameWindow{
+		WorldName:    idx.worldName,
+		MissionName:  idx.missionName,
+		CaptureDelay: idx.captureDelay,
+		EndFrame:     idx.endFrame,
+		From:         from,
+		To:           to,
+		Entities:     idx.entities,
+		Frames:       idx.window(from, to),
+	}
+	if window.Entities == nil {
+		window.Entities = []EntityInfo{}
+	}
+
+	return c.JSONPretty(http.StatusOK, window, "\t")
+}
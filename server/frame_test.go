@@ -0,0 +1,92 @@
+package server
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrameIndex(t *testing.T) {
+	dir := t.TempDir()
+	path := writeCapture(t, dir, "op", testCapture)
+
+	cache := NewFrameIndexCache(1)
+	idx, err := cache.Get(path)
+	require.NoError(t, err)
+	assert.Len(t, idx.entities, 7)
+
+	again, err := cache.Get(path)
+	require.NoError(t, err)
+	assert.Same(t, idx, again)
+
+	frames := idx.window(10, 60)
+	require.Len(t, frames, 3)
+
+	// Bravo has positions for frames 2-11.
+	assert.Equal(t, 1, frames[0].ID)
+	assert.Equal(t, 10, frames[0].StartFrame)
+	require.Len(t, frames[0].States, 2)
+	assert.Equal(t, &EntityState{X: 1, Y: 1, Alive: 0, Name: "Bravo"}, frames[0].States[0])
+	assert.Equal(t, &EntityState{X: 1, Y: 1, Alive: 1, Name: "Bravo", IsPlayer: true}, frames[0].States[1])
+
+	// The car appears at frame 59.
+	assert.Equal(t, 4, frames[1].ID)
+	assert.Equal(t, 59, frames[1].StartFrame)
+	require.Len(t, frames[1].States, 2)
+	assert.Equal(t, []int{2}, frames[1].States[0].Crew)
+
+	// The helicopter's single position covers frames 10-14.
+	assert.Equal(t, 6, frames[2].ID)
+	assert.Equal(t, 10, frames[2].StartFrame)
+	require.Len(t, frames[2].States, 5)
+	assert.Equal(t, []int{0}, frames[2].States[4].Crew)
+
+	assert.Empty(t, idx.window(100, 200))
+}
+
+func TestFrameIndexConcurrent(t *testing.T) {
+	path := writeCapture(t, t.TempDir(), "op", testCapture)
+	cache := NewFrameIndexCache(1)
+
+	// Requests arriving together share a single build.
+	const n = 8
+	indexes := make([]*frameIndex, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			idx, err := cache.Get(path)
+			assert.NoError(t, err)
+			indexes[i] = idx
+		}(i)
+	}
+	wg.Wait()
+
+	for _, idx := range indexes[1:] {
+		assert.Same(t, indexes[0], idx)
+	}
+}
+
+func TestFrameIndexEviction(t *testing.T) {
+	dir := t.TempDir()
+	watched := writeCapture(t, dir, "watched", testCapture)
+	cache := NewFrameIndexCache(2)
+
+	idx, err := cache.Get(watched)
+	require.NoError(t, err)
+
+	// An index that keeps being requested outlives the builds of others.
+	for _, name := range []string{"op_0", "op_1", "op_2", "op_3"} {
+		_, err := cache.Get(writeCapture(t, dir, name, testCapture))
+		require.NoError(t, err)
+		again, err := cache.Get(watched)
+		require.NoError(t, err)
+		assert.Same(t, idx, again, name)
+	}
+	assert.Len(t, cache.indexes, 2)
+	assert.Equal(t, []string{filepath.Join(dir, "op_3.gz"), watched}, cache.order)
+}
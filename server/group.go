@@ -0,0 +1,188 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/OCAP2/web/capture"
+	"github.com/labstack/echo/v4"
+)
+
+// GroupStat holds the performance of one group (squad). Casualties counts
+// members killed at least once and Survivors those still alive at the end of
+// the mission; both rates are relative to Members. Operations is only set
+// across captures.
+type GroupStat struct {
+	Name         string  `json:"name"`
+	Side         string  `json:"side"`
+	Operations   int     `json:"operations,omitempty"`
+	Members      int     `json:"members"`
+	Players      int     `json:"players"`
+	Kills        int     `json:"kills"`
+	Deaths       int     `json:"deaths"`
+	Casualties   int     `json:"casualties"`
+	CasualtyRate float64 `json:"casualty_rate"`
+	Survivors    int     `json:"survivors"`
+	SurvivalRate float64 `json:"survival_rate"`
+}
+
+// groupAcc accumulates one group's statistics within a single capture.
+type groupAcc struct {
+	GroupStat
+	killed  map[int]bool // IDs of members killed at least once
+	dead    map[int]bool // IDs of members dead in their last frame
+	unknown map[int]bool // IDs of members without positions
+}
+
+// groupKey identifies a group within a capture; the same group name may be
+// used on both sides.
+type groupKey struct {
+	side, name string
+}
+
+// onUnit adds a unit entity to its group. lastAlive is the unit's alive state
+// in its last recorded frame, or aliveUnknown if it has none.
+func (cp *captureParser) onUnit(e capture.Entity, lastAlive int) {
+	if e.Group == "" {
+		return
+	}
+
+	key := groupKey{side: e.Side, name: e.Group}
+	g, ok := cp.groups[key]
+	if !ok {
+		g = &groupAcc{
+			GroupStat: GroupStat{Name: e.Group, Side: e.Side},
+			killed:    make(map[int]bool),
+			dead:      make(map[int]bool),
+			unknown:   make(map[int]bool),
+		}
+		cp.groups[key] = g
+	}
+
+	g.Members++
+	if e.IsPlayer == 1 {
+		g.Players++
+	}
+	switch lastAlive {
+	case capture.StateDead:
+		g.dead[e.ID] = true
+	case aliveUnknown:
+		g.unknown[e.ID] = true
+	}
+	cp.unitGroups[e.ID] = g
+}
+
+// onGroupKill credits a kill to the killer's group and a death to the
+// victim's group.
+func (cp *captureParser) onGroupKill(ev hitKilledEvent) {
+	if g, ok := cp.unitGroups[ev.CausedByID]; ok && ev.CausedByID != ev.VictimID {
+		g.Kills++
+	}
+	if g, ok := cp.unitGroups[ev.VictimID]; ok {
+		g.Deaths++
+		g.killed[ev.VictimID] = true
+	}
+}
+
+// applyGroupRates fills in the casualty and survival rates of g.
+func applyGroupRates(g *GroupStat) {
+	g.CasualtyRate = ratio(g.Casualties, g.Members)
+	g.SurvivalRate = ratio(g.Survivors, g.Members)
+}
+
+// sortGroups orders groups by kills, then side and name.
+func sortGroups(groups []GroupStat) {
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Kills != groups[j].Kills {
+			return groups[i].Kills > groups[j].Kills
+		}
+		if groups[i].Side != groups[j].Side {
+			return groups[i].Side < groups[j].Side
+		}
+		return groups[i].Name < groups[j].Name
+	})
+}
+
+// groupStats returns the capture's groups.
+func (cp *captureParser) groupStats() []GroupStat {
+	groups := make([]GroupStat, 0, len(cp.groups))
+	for _, g := range cp.groups {
+		g.Casualties = len(g.killed)
+		// Without positions, a member survived unless they were killed.
+		g.Survivors = g.Members - len(g.dead)
+		for id := range g.unknown {
+			if g.killed[id] {
+				g.Survivors--
+			}
+		}
+		applyGroupRates(&g.GroupStat)
+		groups = append(groups, g.GroupStat)
+	}
+	sortGroups(groups)
+	return groups
+}
+
+// mergeGroups adds the player groups of one capture to merged, keyed by side
+// and group name. AI groups are left out: their names are reused by every mission and
+// say nothing about a standing squad.
+func mergeGroups(merged map[groupKey]*GroupStat, groups []GroupStat) {
+	for _, g := range groups {
+		if g.Players == 0 {
+			continue
+		}
+
+		key := groupKey{side: g.Side, name: g.Name}
+		m, ok := merged[key]
+		if !ok {
+			m = &GroupStat{Name: g.Name, Side: g.Side}
+			merged[key] = m
+		}
+		m.Operations++
+		m.Members += g.Members
+		m.Players += g.Players
+		m.Kills += g.Kills
+		m.Deaths += g.Deaths
+		m.Casualties += g.Casualties
+		m.Survivors += g.Survivors
+	}
+}
+
+// groupSlice converts merged groups into a sorted slice with their rates.
+func groupSlice(merged map[groupKey]*GroupStat) []GroupStat {
+	groups := make([]GroupStat, 0, len(merged))
+	for _, g := range merged {
+		applyGroupRates(g)
+		groups = append(groups, *g)
+	}
+	sortGroups(groups)
+	return groups
+}
+
+// GetGroupStats handles GET /api/v1/groups
+// It returns statistics for every group that included players, aggregated
+// across all captures by side and group name.
+func (h *Handler) GetGroupStats(c echo.Context) error {
+	groups, err := h.playerCache.GetGroups()
+	if err != nil {
+		return fmt.Errorf("process group stats: %w", err)
+	}
+
+	return c.JSONPretty(http.StatusOK, groups, "\t")
+}
+
+// GetCaptureGroupStats handles GET /api/v1/captures/:name/groups
+// It returns statistics for every group in a single capture.
+func (h *Handler) GetCaptureGroupStats(c echo.Context) error {
+	path, err := h.capturePath(c)
+	if err != nil {
+		return err
+	}
+
+	stats, err := processCapture(path)
+	if err != nil {
+		return fmt.Errorf("process group stats: %w", err)
+	}
+
+	return c.JSONPretty(http.StatusOK, stats.Groups, "\t")
+}
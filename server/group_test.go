@@ -0,0 +1,86 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupStats(t *testing.T) {
+	stats := processFixture(t, `{
+		"worldName": "Altis", "missionName": "Op", "endFrame": 10, "captureDelay": 1,
+		"entities": [
+			{"type": "unit", "id": 0, "name": "Alpha", "side": "WEST", "group": "Alpha 1-1", "isPlayer": 1, "startFrameNum": 0,
+				"positions": [[[0, 0], 0, 1, 0, "Alpha", 1]]},
+			{"type": "unit", "id": 1, "name": "Bravo", "side": "WEST", "group": "Alpha 1-1", "isPlayer": 1, "startFrameNum": 0,
+				"positions": [[[0, 0], 0, 1, 0, "Bravo", 1], [[0, 0], 0, 0, 0, "Bravo", 1]]},
+			{"type": "unit", "id": 2, "name": "Medic", "side": "WEST", "group": "Alpha 1-1", "isPlayer": 0, "startFrameNum": 0},
+			{"type": "unit", "id": 3, "name": "Rifleman", "side": "WEST", "group": "Alpha 1-1", "isPlayer": 0, "startFrameNum": 0},
+			{"type": "unit", "id": 4, "name": "Charlie", "side": "EAST", "group": "Alpha 1-1", "isPlayer": 1, "startFrameNum": 0,
+				"positions": [[[0, 0], 0, 1, 0, "Charlie", 1]]},
+			{"type": "unit", "id": 5, "name": "Loner", "side": "EAST", "group": "", "isPlayer": 0, "startFrameNum": 0},
+			{"type": "unit", "id": 6, "name": "Patrol", "side": "EAST", "group": "Bravo 2-1", "isPlayer": 0, "startFrameNum": 0}
+		],
+		"events": [
+			[1, "killed", 1, [4, "AK-12"], 10],
+			[2, "killed", 2, [4, "AK-12"], 10],
+			[3, "killed", 5, [0, "MX"], 10],
+			[4, "killed", 4, [4, "Grenade"], 0]
+		]
+	}`)
+
+	// The same group name on two sides is two groups, and units without a
+	// group are left out. A member without positions survived unless killed,
+	// and killing oneself is not a kill for the group.
+	require.Len(t, stats.Groups, 3)
+	assert.Equal(t, GroupStat{
+		Name: "Alpha 1-1", Side: "EAST", Members: 1, Players: 1, Kills: 2, Deaths: 1,
+		Casualties: 1, CasualtyRate: 1, Survivors: 1, SurvivalRate: 1,
+	}, stats.Groups[0])
+	assert.Equal(t, GroupStat{
+		Name: "Alpha 1-1", Side: "WEST", Members: 4, Players: 2, Kills: 1, Deaths: 2,
+		Casualties: 2, CasualtyRate: 0.5, Survivors: 2, SurvivalRate: 0.5,
+	}, stats.Groups[1])
+	assert.Equal(t, GroupStat{
+		Name: "Bravo 2-1", Side: "EAST", Members: 1, Survivors: 1, SurvivalRate: 1,
+	}, stats.Groups[2])
+
+	bravo := playerByName(stats.Players, "Bravo")
+	require.NotNil(t, bravo)
+	assert.Equal(t, "Alpha 1-1", bravo.Group)
+}
+
+func TestMergeGroups(t *testing.T) {
+	merged := make(map[groupKey]*GroupStat)
+	mergeGroups(merged, []GroupStat{
+		{Name: "Alpha 1-1", Side: "WEST", Members: 4, Players: 2, Kills: 3, Casualties: 2, Survivors: 2},
+		{Name: "Bravo 2-1", Side: "EAST", Members: 6, Kills: 9},
+	})
+	mergeGroups(merged, []GroupStat{
+		{Name: "Alpha 1-1", Side: "WEST", Members: 4, Players: 4, Kills: 1, Casualties: 4},
+	})
+
+	// Groups of AI only are left out.
+	assert.Equal(t, []GroupStat{{
+		Name: "Alpha 1-1", Side: "WEST", Operations: 2, Members: 8, Players: 6, Kills: 4,
+		Casualties: 6, CasualtyRate: 0.75, Survivors: 2, SurvivalRate: 0.25,
+	}}, groupSlice(merged))
+}
+
+func TestMergeGroupsSides(t *testing.T) {
+	// Both sides often use the default group names.
+	merged := make(map[groupKey]*GroupStat)
+	mergeGroups(merged, []GroupStat{
+		{Name: "Alpha 1-1", Side: "WEST", Members: 4, Players: 4, Kills: 3, Deaths: 1, Casualties: 1, Survivors: 3},
+		{Name: "Alpha 1-1", Side: "EAST", Members: 2, Players: 2, Kills: 1, Deaths: 2, Casualties: 2},
+	})
+
+	assert.Equal(t, []GroupStat{{
+		Name: "Alpha 1-1", Side: "WEST", Operations: 1, Members: 4, Players: 4, Kills: 3, Deaths: 1,
+		Casualties: 1, CasualtyRate: 0.25, Survivors: 3, SurvivalRate: 0.75,
+	}, {
+		Name: "Alpha 1-1", Side: "EAST", Operations: 1, Members: 2, Players: 2, Kills: 1, Deaths: 2,
+		Casualties: 2, CasualtyRate: 1,
+	}}, groupSlice(merged))
+}
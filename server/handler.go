@@ -13,6 +13,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/OCAP2/web/ocapbin"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
@@ -29,6 +30,7 @@ type Handler struct {
 	repoMarker    *RepoMarker
 	repoAmmo      *RepoAmmo
 	playerCache   *PlayerCache
+	frameIndex    *FrameIndexCache
 	setting       Setting
 }
 
@@ -44,6 +46,7 @@ func NewHandler(
 		repoMarker:    repoMarker,
 		repoAmmo:      repoAmmo,
 		playerCache:   NewPlayerCache(setting.Data, setting.OperationTypeBlacklist),
+		frameIndex:    NewFrameIndexCache(frameIndexCacheSize),
 		setting:       setting,
 	}
 
@@ -72,14 +75,122 @@ func NewHandler(
 		"/api/v1/players",
 		hdlr.GetAllPlayerStats,
 	)
+	g.GET(
+		"/api/v1/players/search",
+		hdlr.GetPlayerSearch,
+	)
 	g.GET(
 		"/api/v1/players/:name",
 		hdlr.GetPlayerStatsByName,
 	)
+	g.GET(
+		"/api/v1/players/:name/attendance",
+		hdlr.GetPlayerAttendance,
+	)
+	g.GET(
+		"/api/v1/players/:name/profile",
+		hdlr.GetPlayerProfile,
+	)
+	g.GET(
+		"/api/v1/players/:name/victims",
+		hdlr.GetPlayerVictims,
+	)
+	g.GET(
+		"/api/v1/players/:name/nemesis",
+		hdlr.GetPlayerNemesis,
+	)
+	g.GET(
+		"/api/v1/players/:name/versus/:other",
+		hdlr.GetPlayerVersus,
+	)
+	g.GET(
+		"/api/v1/weapons",
+		hdlr.GetWeaponStats,
+	)
+	g.GET(
+		"/api/v1/stats/sides",
+		hdlr.GetSideStats,
+	)
+	g.GET(
+		"/api/v1/teamkills",
+		hdlr.GetTeamKills,
+	)
+	g.GET(
+		"/api/v1/groups",
+		hdlr.GetGroupStats,
+	)
+	g.GET(
+		"/api/v1/roles",
+		hdlr.GetRoleStats,
+	)
+	g.GET(
+		"/api/v1/vehicles",
+		hdlr.GetVehicleStats,
+	)
+	g.GET(
+		"/api/v1/movement",
+		hdlr.GetMovementStats,
+	)
+	g.POST(
+		"/api/v1/captures/validate",
+		hdlr.ValidateCapture,
+	)
+	g.POST(
+		"/api/v1/captures/merge",
+		hdlr.MergeOperations,
+	)
+	g.POST(
+		"/api/v1/captures/:name/trim",
+		hdlr.TrimOperation,
+	)
+	g.POST(
+		"/api/v1/captures/:name/anonymize",
+		hdlr.AnonymizeOperation,
+	)
+	g.GET(
+		"/api/v1/captures/:name/anonymized",
+		hdlr.GetAnonymizedCapture,
+	)
 	g.GET(
 		"/api/v1/captures/:name/players",
 		hdlr.GetPlayerEvents,
 	)
+	g.GET(
+		"/api/v1/captures/:name/weapons",
+		hdlr.GetCaptureWeaponStats,
+	)
+	g.GET(
+		"/api/v1/captures/:name/groups",
+		hdlr.GetCaptureGroupStats,
+	)
+	g.GET(
+		"/api/v1/captures/:name/roles",
+		hdlr.GetCaptureRoleStats,
+	)
+	g.GET(
+		"/api/v1/captures/:name/vehicles",
+		hdlr.GetCaptureVehicleStats,
+	)
+	g.GET(
+		"/api/v1/captures/:name/lives",
+		hdlr.GetCaptureLives,
+	)
+	g.GET(
+		"/api/v1/captures/:name/movement",
+		hdlr.GetCaptureMovement,
+	)
+	g.GET(
+		"/api/v1/captures/:name/summary",
+		hdlr.GetCaptureSummary,
+	)
+	g.GET(
+		"/api/v1/captures/:name/events",
+		hdlr.GetCaptureEvents,
+	)
+	g.GET(
+		"/api/v1/captures/:name/frames",
+		hdlr.GetCaptureFrames,
+	)
 	g.GET(
 		"/data/:name",
 		hdlr.GetCapture,
@@ -141,6 +252,8 @@ func (h *Handler) errorHandler(next echo.HandlerFunc) echo.HandlerFunc {
 			switch true {
 			case errors.Is(err, ErrNotFound):
 				return c.NoContent(http.StatusNotFound)
+			case errors.Is(err, ErrExists):
+				return c.NoContent(http.StatusConflict)
 			default:
 				return err
 			}
@@ -202,14 +315,6 @@ func (h *Handler) StoreOperation(c echo.Context) error {
 		// Support old extension version tag or type
 		Tag: c.FormValue("tag") + c.FormValue("type"),
 	}
-	op.MissionDuration, err = strconv.ParseFloat(c.FormValue("missionDuration"), 64)
-	if err != nil {
-		return err
-	}
-
-	if err = h.repoOperation.Store(ctx, &op); err != nil {
-		return err
-	}
 
 	form, err := c.FormFile("file")
 	if err != nil {
@@ -221,6 +326,33 @@ func (h *Handler) StoreOperation(c echo.Context) error {
 	}
 	defer file.Close()
 
+	// A dry run only validates the capture.
+	dryRun := c.FormValue("dryRun") == "true"
+	if dryRun || h.setting.ValidateUploads {
+		report, err := validateCapture(file)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if dryRun {
+			return c.JSONPretty(http.StatusOK, report, "\t")
+		}
+		if !report.Valid() {
+			return c.JSONPretty(http.StatusUnprocessableEntity, report, "\t")
+		}
+		if _, err = file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	op.MissionDuration, err = strconv.ParseFloat(c.FormValue("missionDuration"), 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid missionDuration: "+err.Error())
+	}
+
+	if err = h.repoOperation.Store(ctx, &op); err != nil {
+		return err
+	}
+
 	writer, err := os.Create(filepath.Join(h.setting.Data, filename+".gz"))
 	if err != nil {
 		return err
@@ -243,6 +375,21 @@ func (h *Handler) GetCapture(c echo.Context) error {
 
 	upath := filepath.Join(h.setting.Data, filepath.Base(name+".gz"))
 
+	c.Response().Header().Set("Vary", "Accept")
+
+	// Clients that can decode the binary format ask for it explicitly.
+	if acceptsBinary(c.Request().Header.Get("Accept")) {
+		bpath, err := binaryCapture(upath)
+		if os.IsNotExist(err) {
+			return echo.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		c.Response().Header().Set("Content-Type", ocapbin.MediaType)
+		return c.File(bpath)
+	}
+
 	c.Response().Header().Set("Content-Encoding", "gzip")
 	c.Response().Header().Set("Content-Type", "application/json")
 
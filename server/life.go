@@ -0,0 +1,170 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Life is one life of a player's unit, from spawning or respawning until
+// death or the end of the mission. Frames are absolute. Duration is the
+// length of the life in seconds, and DeathTime the time of death in seconds
+// since the start of the mission, only set if the life ended in death.
+type Life struct {
+	StartFrame int      `json:"start_frame"`
+	EndFrame   int      `json:"end_frame"`
+	Duration   float64  `json:"duration"`
+	Kills      int      `json:"kills"`
+	Died       bool     `json:"died"`
+	DeathTime  *float64 `json:"death_time,omitempty"`
+}
+
+// SideLifeStat holds the life expectancy of players on one side. AverageLife
+// is in seconds and includes lives that lasted until the end of the mission.
+type SideLifeStat struct {
+	Side        string  `json:"side"`
+	Lives       int     `json:"lives"`
+	Deaths      int     `json:"deaths"`
+	AverageLife float64 `json:"average_life"`
+
+	lifeSeconds float64
+}
+
+// PlayerLives lists the lives of one player in a capture.
+type PlayerLives struct {
+	Name        string  `json:"name"`
+	Side        string  `json:"side"`
+	AverageLife float64 `json:"average_life"`
+	Lives       []Life  `json:"lives"`
+}
+
+// LifeReport is the output of the per-capture lives endpoint.
+type LifeReport struct {
+	Sides   []SideLifeStat `json:"sides"`
+	Players []PlayerLives  `json:"players"`
+}
+
+// lives converts a unit's life runs into lives with absolute frames and
+// credits each of killFrames to the life it happened in.
+func lives(runs []lifeRun, startFrame int, killFrames []int, captureDelay float64) []Life {
+	result := make([]Life, 0, len(runs))
+	for _, r := range runs {
+		l := Life{
+			StartFrame: startFrame + r.Start,
+			EndFrame:   startFrame + r.End,
+			Died:       r.Died,
+		}
+		l.Duration = float64(l.EndFrame-l.StartFrame) * captureDelay
+		if r.Died {
+			t := float64(l.EndFrame) * captureDelay
+			l.DeathTime = &t
+		}
+		result = append(result, l)
+	}
+
+	// A kill can be logged on the frame the killer dies, so each life owns
+	// the frames up to and including its end.
+	for _, frame := range killFrames {
+		i := sort.Search(len(result), func(i int) bool {
+			return result[i].EndFrame >= frame
+		})
+		if i < len(result) && result[i].StartFrame <= frame {
+			result[i].Kills++
+		}
+	}
+
+	return result
+}
+
+// applyLives sets the life count and expectancy of p from its lives.
+func applyLives(p *PlayerEventSummary) {
+	p.LifeCount = len(p.Lives)
+	p.lifeSeconds = 0
+	for _, l := range p.Lives {
+		p.lifeSeconds += l.Duration
+	}
+	p.AverageLife = ratioFloat(p.lifeSeconds, p.LifeCount)
+}
+
+// ratioFloat returns n divided by d, or 0 when d is zero.
+func ratioFloat(n float64, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return n / float64(d)
+}
+
+// sideLives accumulates life expectancy per side.
+type sideLives map[string]*SideLifeStat
+
+func (s sideLives) add(side string, lives, deaths int, seconds float64) {
+	st, ok := s[side]
+	if !ok {
+		st = &SideLifeStat{Side: side}
+		s[side] = st
+	}
+	st.Lives += lives
+	st.Deaths += deaths
+	st.lifeSeconds += seconds
+}
+
+func (s sideLives) stats() []SideLifeStat {
+	result := make([]SideLifeStat, 0, len(s))
+	for _, st := range s {
+		st.AverageLife = ratioFloat(st.lifeSeconds, st.Lives)
+		result = append(result, *st)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Side < result[j].Side
+	})
+	return result
+}
+
+// captureSideLives computes life expectancy per side from a capture's
+// players.
+func captureSideLives(players []PlayerEventSummary) []SideLifeStat {
+	s := sideLives{}
+	for i := range players {
+		p := &players[i]
+		deaths := 0
+		for _, l := range p.Lives {
+			if l.Died {
+				deaths++
+			}
+		}
+		s.add(p.Side, p.LifeCount, deaths, p.lifeSeconds)
+	}
+	return s.stats()
+}
+
+// GetCaptureLives handles GET /api/v1/captures/:name/lives
+// It returns every player's lives in a single capture, with life expectancy
+// per side.
+func (h *Handler) GetCaptureLives(c echo.Context) error {
+	path, err := h.capturePath(c)
+	if err != nil {
+		return err
+	}
+
+	stats, err := processCapture(path)
+	if err != nil {
+		return fmt.Errorf("process player lives: %w", err)
+	}
+
+	report := LifeReport{
+		Sides:   stats.SideLives,
+		Players: make([]PlayerLives, 0, len(stats.Players)),
+	}
+	for _, p := range stats.Players {
+		report.Players = append(report.Players, PlayerLives{
+			Name:        p.Name,
+			Side:        p.Side,
+			AverageLife: p.AverageLife,
+			Lives:       p.Lives,
+		})
+	}
+
+	return c.JSONPretty(http.StatusOK, report, "\t")
+}
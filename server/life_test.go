@@ -0,0 +1,71 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlayerLives(t *testing.T) {
+	stats := processFixture(t, `{
+		"worldName": "Altis", "missionName": "Op", "endFrame": 20, "captureDelay": 2,
+		"entities": [
+			{"type": "unit", "id": 0, "name": "Alpha", "side": "WEST", "isPlayer": 1, "startFrameNum": 5,
+				"positions": [[[0, 0], 0, 1, 0, "Alpha", 1], [[0, 0], 0, 1, 0, "Alpha", 1], [[0, 0], 0, 0, 0, "Alpha", 1],
+					[[0, 0], 0, 0, 0, "Alpha", 1], [[0, 0], 0, 1, 0, "Alpha", 1], [[0, 0], 0, 1, 0, "Alpha", 1]]},
+			{"type": "unit", "id": 1, "name": "Bravo", "side": "EAST", "isPlayer": 1, "startFrameNum": 0,
+				"positions": [[[0, 0], 0, 1, 0, "Bravo", 1], [[0, 0], 0, 1, 0, "Bravo", 1], [[0, 0], 0, 1, 0, "Bravo", 1],
+					[[0, 0], 0, 1, 0, "Bravo", 1], [[0, 0], 0, 1, 0, "Bravo", 1], [[0, 0], 0, 1, 0, "Bravo", 1],
+					[[0, 0], 0, 1, 0, "Bravo", 1], [[0, 0], 0, 0, 0, "Bravo", 1]]},
+			{"type": "unit", "id": 2, "name": "Charlie", "side": "EAST", "isPlayer": 1, "startFrameNum": 0}
+		],
+		"events": [
+			[7, "killed", 1, [0, "MX"], 10],
+			[10, "killed", 2, [0, "MX"], 10]
+		]
+	}`)
+
+	// Alpha respawned; the kill on the frame of death belongs to the first
+	// life.
+	alpha := playerByName(stats.Players, "Alpha")
+	require.NotNil(t, alpha)
+	deathTime := 14.0
+	assert.Equal(t, []Life{
+		{StartFrame: 5, EndFrame: 7, Duration: 4, Kills: 1, Died: true, DeathTime: &deathTime},
+		{StartFrame: 9, EndFrame: 11, Duration: 4, Kills: 1},
+	}, alpha.Lives)
+	assert.Equal(t, 2, alpha.LifeCount)
+	assert.Equal(t, 4.0, alpha.AverageLife)
+
+	bravo := playerByName(stats.Players, "Bravo")
+	require.NotNil(t, bravo)
+	assert.Equal(t, []Life{
+		{StartFrame: 0, EndFrame: 7, Duration: 14, Died: true, DeathTime: &deathTime},
+	}, bravo.Lives)
+	assert.Equal(t, 14.0, bravo.AverageLife)
+
+	// A unit without positions has no lives.
+	charlie := playerByName(stats.Players, "Charlie")
+	require.NotNil(t, charlie)
+	assert.Empty(t, charlie.Lives)
+	assert.Equal(t, 0.0, charlie.AverageLife)
+
+	assert.Equal(t, []SideLifeStat{
+		{Side: "EAST", Lives: 1, Deaths: 1, AverageLife: 14, lifeSeconds: 14},
+		{Side: "WEST", Lives: 2, Deaths: 1, AverageLife: 4, lifeSeconds: 8},
+	}, stats.SideLives)
+}
+
+func TestLivesKills(t *testing.T) {
+	runs := []lifeRun{{Start: 0, End: 10, Died: true}, {Start: 15, End: 30}}
+
+	got := lives(runs, 100, []int{105, 110, 112, 120, 140}, 2)
+	require.Len(t, got, 2)
+	// The kill on the frame of death still belongs to the first life.
+	assert.Equal(t, 2, got[0].Kills)
+	assert.Equal(t, 20.0, got[0].Duration)
+	assert.Equal(t, 220.0, *got[0].DeathTime)
+	assert.Equal(t, 1, got[1].Kills)
+	assert.Nil(t, got[1].DeathTime)
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/OCAP2/web/capture"
+	"github.com/labstack/echo/v4"
+)
+
+// MergeCaptures merges the stored captures names, split by a server restart,
+// into a single capture registered as one operation. The operation takes the
+// details of the earliest capture, and its filename unless filename is set.
+// The merged captures are archived and their operations removed.
+func MergeCaptures(ctx context.Context, repo *RepoOperation, dataDir string, names []string, filename string) (*Operation, error) {
+	if len(names) < 2 {
+		return nil, fmt.Errorf("%w: merge needs at least two captures", capture.ErrMismatch)
+	}
+
+	bases := make([]string, len(names))
+	for i, name := range names {
+		bases[i] = filepath.Base(name)
+	}
+	names = bases
+
+	if filename != "" {
+		filename = filepath.Base(filename)
+		if captureExists(dataDir, filename) && !contains(names, filename) {
+			return nil, fmt.Errorf("capture %s: %w", filename, ErrExists)
+		}
+	}
+
+	ops := make([]*Operation, len(names))
+	sources := make([]capture.Source, len(names))
+	for i, name := range names {
+		if contains(names[:i], name) {
+			return nil, fmt.Errorf("%w: capture %s given twice", capture.ErrMismatch, name)
+		}
+		if !captureExists(dataDir, name) {
+			return nil, fmt.Errorf("capture %s: %w", name, ErrNotFound)
+		}
+		op, err := storedOperation(ctx, repo, name)
+		if err != nil {
+			return nil, fmt.Errorf("capture %s: %w", name, err)
+		}
+		ops[i] = op
+
+		path := filepath.Join(dataDir, name+".gz")
+		sources[i] = func() (io.ReadCloser, error) {
+			return capture.Open(path)
+		}
+	}
+
+	var result *capture.MergeResult
+	tmp, err := createCapture(dataDir, func(w io.Writer) (err error) {
+		result, err = capture.Merge(w, sources)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("merge captures: %w", err)
+	}
+	defer os.Remove(tmp)
+
+	merged := *ops[result.Order[0]]
+	merged.ID = 0
+	merged.MissionDuration = float64(result.Header.EndFrame) * result.Header.CaptureDelay
+	if filename != "" {
+		merged.Filename = filename
+	}
+
+	// The merged capture is registered before the captures it replaces are
+	// removed, so that a failure leaves them in place rather than losing
+	// them. When it takes the name of one of them, that one is archived
+	// first and its operation updated instead.
+	var replaced *Operation
+	for _, op := range ops {
+		if op.Filename == merged.Filename {
+			replaced = op
+		}
+	}
+	if replaced != nil {
+		archived, err := archiveCapture(dataDir, replaced.Filename)
+		if err != nil {
+			return nil, fmt.Errorf("archive capture: %w", err)
+		}
+		if err := os.Rename(tmp, filepath.Join(dataDir, merged.Filename+".gz")); err != nil {
+			restoreCapture(dataDir, replaced.Filename, archived)
+			return nil, err
+		}
+		merged.ID = replaced.ID
+		if err := repo.Update(ctx, &merged); err != nil {
+			restoreCapture(dataDir, replaced.Filename, archived)
+			return nil, fmt.Errorf("update operation: %w", err)
+		}
+	} else {
+		if err := os.Rename(tmp, filepath.Join(dataDir, merged.Filename+".gz")); err != nil {
+			return nil, err
+		}
+		if err := repo.Store(ctx, &merged); err != nil {
+			os.Remove(filepath.Join(dataDir, merged.Filename+".gz"))
+			return nil, fmt.Errorf("store operation: %w", err)
+		}
+	}
+
+	for _, op := range ops {
+		if op == replaced {
+			continue
+		}
+		if _, err := archiveCapture(dataDir, op.Filename); err != nil {
+			return nil, fmt.Errorf("archive capture: %w", err)
+		}
+		if err := repo.Delete(ctx, op.ID); err != nil {
+			return nil, fmt.Errorf("delete operation: %w", err)
+		}
+	}
+	return &merged, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// MergeOperations handles POST /api/v1/captures/merge
+// It merges the captures named by the repeated name form value into one
+// operation, optionally named by filename, and archives them. It requires
+// the upload secret.
+func (h *Handler) MergeOperations(c echo.Context) error {
+	if c.FormValue("secret") != h.setting.Secret {
+		return echo.ErrForbidden
+	}
+
+	form, err := c.FormParams()
+	if err != nil {
+		return err
+	}
+
+	op, err := MergeCaptures(c.Request().Context(), h.repoOperation, h.setting.Data, form["name"], c.FormValue("filename"))
+	if errors.Is(err, capture.ErrMismatch) {
+		return echo.ErrBadRequest
+	}
+	if err != nil {
+		return err
+	}
+
+	h.playerCache.Invalidate()
+
+	return c.JSONPretty(http.StatusOK, op, "\t")
+}
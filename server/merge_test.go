@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/OCAP2/web/capture"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeCaptures(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// The capture after the restart has the same players.
+	restarted := strings.Replace(testCapture, "2024-03-09T19:00:00.000", "2024-03-09T21:00:00.000", 1)
+	writeCapture(t, dir, "op_1", restarted)
+	writeCapture(t, dir, "op_0", testCapture)
+	single, err := processCapture(filepath.Join(dir, "op_0.gz"))
+	require.NoError(t, err)
+	h := newAdminHandler(t, dir, "op_1", "op_0")
+	repo := h.repoOperation
+
+	form := url.Values{"secret": {"secret"}, "name": {"op_1", "op_0"}}
+	c, rec := formContext("/api/v1/captures/merge", "", form)
+	require.NoError(t, h.MergeOperations(c))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var op Operation
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &op))
+	// Named after the earliest capture.
+	assert.Equal(t, "op_0", op.Filename)
+	assert.Equal(t, 201.0, op.MissionDuration)
+
+	ops, err := repo.SelectByFilenames(ctx, []string{"op_0", "op_1"})
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, "op_0", ops[0].Filename)
+	assert.NoFileExists(t, filepath.Join(dir, "op_1.gz"))
+	archived, err := filepath.Glob(filepath.Join(dir, archiveDir, "*.gz"))
+	require.NoError(t, err)
+	assert.Len(t, archived, 2)
+
+	report, err := capture.ValidateFile(filepath.Join(dir, "op_0.gz"))
+	require.NoError(t, err)
+	assert.Empty(t, report.Problems)
+	assert.Equal(t, 201, report.Info.EndFrame)
+	// Alpha, Bravo and Charlie played in both.
+	assert.Equal(t, 14-3, report.Info.Entities)
+
+	// Players keep a single unit, with the kills of both captures.
+	stats, err := processCapture(filepath.Join(dir, "op_0.gz"))
+	require.NoError(t, err)
+	assert.Len(t, stats.Players, len(single.Players))
+	for i, p := range stats.Players {
+		assert.Equal(t, 2*single.Players[i].KillCount, p.KillCount, p.Name)
+	}
+
+	_, err = MergeCaptures(ctx, repo, dir, []string{"op_0"}, "")
+	assert.ErrorIs(t, err, capture.ErrMismatch)
+}
+
+func TestMergeCapturesNames(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	restarted := strings.Replace(testCapture, "2024-03-09T19:00:00.000", "2024-03-09T21:00:00.000", 1)
+	writeCapture(t, dir, "op_1", restarted)
+	writeCapture(t, dir, "op_0", testCapture)
+	repo := newAdminHandler(t, dir, "op_1", "op_0").repoOperation
+
+	// Names are compared without their directories.
+	_, err := MergeCaptures(ctx, repo, dir, []string{"../op_0", "op_0"}, "")
+	assert.ErrorIs(t, err, capture.ErrMismatch)
+
+	// The original captures stay when the merged operation cannot be
+	// registered.
+	_, err = repo.db.Exec(`CREATE TRIGGER no_update BEFORE UPDATE ON operations BEGIN SELECT RAISE(FAIL, 'read only'); END`)
+	require.NoError(t, err)
+	_, err = MergeCaptures(ctx, repo, dir, []string{"op_1", "op_0"}, "sub/op_1")
+	require.Error(t, err)
+	report, err := capture.ValidateFile(filepath.Join(dir, "op_1.gz"))
+	require.NoError(t, err)
+	assert.Equal(t, 100, report.Info.EndFrame)
+	assert.FileExists(t, filepath.Join(dir, "op_0.gz"))
+	ops, err := repo.SelectByFilenames(ctx, []string{"op_0", "op_1"})
+	require.NoError(t, err)
+	assert.Len(t, ops, 2)
+
+	_, err = repo.db.Exec(`DROP TRIGGER no_update`)
+	require.NoError(t, err)
+	op, err := MergeCaptures(ctx, repo, dir, []string{"op_1", "op_0"}, "sub/op_1")
+	require.NoError(t, err)
+	assert.Equal(t, "op_1", op.Filename)
+	ops, err = repo.SelectByFilenames(ctx, []string{"op_0", "op_1"})
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, 201.0, ops[0].MissionDuration)
+	assert.NoFileExists(t, filepath.Join(dir, "op_0.gz"))
+}
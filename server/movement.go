@@ -0,0 +1,203 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/OCAP2/web/capture"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// stationaryDistance is the distance in metres under which a unit is
+	// considered not to have moved between two frames.
+	stationaryDistance = 0.5
+	// teleportDistance is the distance in metres between two frames above
+	// which a move is treated as a teleport and not counted.
+	teleportDistance = 2000
+)
+
+// PlayerMovement is the movement of one player in a capture.
+type PlayerMovement struct {
+	Name              string  `json:"name"`
+	Side              string  `json:"side"`
+	DistanceOnFoot    float64 `json:"distance_on_foot"`
+	DistanceInVehicle float64 `json:"distance_in_vehicle"`
+	AverageSpeed      float64 `json:"average_speed"`
+	MinutesStationary float64 `json:"minutes_stationary"`
+}
+
+// SideMovement aggregates the movement of the players of one side. Distances
+// are totals in metres; AverageDistance is per player.
+type SideMovement struct {
+	Side              string  `json:"side"`
+	Players           int     `json:"players"`
+	DistanceOnFoot    float64 `json:"distance_on_foot"`
+	DistanceInVehicle float64 `json:"distance_in_vehicle"`
+	AverageDistance   float64 `json:"average_distance"`
+	AverageSpeed      float64 `json:"average_speed"`
+	MinutesStationary float64 `json:"minutes_stationary"`
+
+	aliveSeconds float64
+}
+
+// MovementReport is the output of the movement endpoints. Players is only
+// set for a single capture.
+type MovementReport struct {
+	Sides   []SideMovement   `json:"sides"`
+	Players []PlayerMovement `json:"players,omitempty"`
+}
+
+// movementTrack measures how far a unit moved while its positions are
+// streamed. Moves out of a dead state (respawns) are not counted.
+type movementTrack struct {
+	hasPrev          bool
+	prevX, prevY     float64
+	prevAlive        int
+	onFoot           float64
+	inVehicle        float64
+	aliveFrames      int
+	stationaryFrames int
+}
+
+func (m *movementTrack) reset() {
+	*m = movementTrack{}
+}
+
+// add records the next position.
+func (m *movementTrack) add(p *capture.Position) {
+	if p.Alive != capture.StateDead {
+		m.aliveFrames++
+	}
+
+	if m.hasPrev && m.prevAlive != capture.StateDead && p.Alive != capture.StateDead {
+		d := math.Hypot(p.X-m.prevX, p.Y-m.prevY)
+		if d <= teleportDistance {
+			if p.InVehicle {
+				m.inVehicle += d
+			} else {
+				m.onFoot += d
+			}
+			if d < stationaryDistance {
+				m.stationaryFrames++
+			}
+		}
+	}
+
+	m.hasPrev = true
+	m.prevX, m.prevY = p.X, p.Y
+	m.prevAlive = p.Alive
+}
+
+// applyMovement fills in p's movement from a unit's track.
+func applyMovement(p *PlayerEventSummary, m *movementTrack, captureDelay float64) {
+	p.DistanceOnFoot = m.onFoot
+	p.DistanceInVehicle = m.inVehicle
+	p.MinutesStationary = float64(m.stationaryFrames) * captureDelay / 60
+	p.aliveSeconds = float64(m.aliveFrames) * captureDelay
+	p.AverageSpeed = averageSpeed(p.DistanceOnFoot+p.DistanceInVehicle, p.aliveSeconds)
+}
+
+// averageSpeed returns distance divided by seconds, or 0.
+func averageSpeed(distance, seconds float64) float64 {
+	if seconds == 0 {
+		return 0
+	}
+	return distance / seconds
+}
+
+// sideMovements accumulates movement per side.
+type sideMovements map[string]*SideMovement
+
+func (s sideMovements) add(m *SideMovement) {
+	st, ok := s[m.Side]
+	if !ok {
+		st = &SideMovement{Side: m.Side}
+		s[m.Side] = st
+	}
+	st.Players += m.Players
+	st.DistanceOnFoot += m.DistanceOnFoot
+	st.DistanceInVehicle += m.DistanceInVehicle
+	st.MinutesStationary += m.MinutesStationary
+	st.aliveSeconds += m.aliveSeconds
+}
+
+func (s sideMovements) stats() []SideMovement {
+	result := make([]SideMovement, 0, len(s))
+	for _, st := range s {
+		total := st.DistanceOnFoot + st.DistanceInVehicle
+		st.AverageDistance = ratioFloat(total, st.Players)
+		st.AverageSpeed = averageSpeed(total, st.aliveSeconds)
+		result = append(result, *st)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Side < result[j].Side
+	})
+	return result
+}
+
+// captureSideMovements aggregates the movement of a capture's players per
+// side.
+func captureSideMovements(players []PlayerEventSummary) []SideMovement {
+	s := sideMovements{}
+	for i := range players {
+		p := &players[i]
+		s.add(&SideMovement{
+			Side:              p.Side,
+			Players:           1,
+			DistanceOnFoot:    p.DistanceOnFoot,
+			DistanceInVehicle: p.DistanceInVehicle,
+			MinutesStationary: p.MinutesStationary,
+			aliveSeconds:      p.aliveSeconds,
+		})
+	}
+	return s.stats()
+}
+
+// GetMovementStats handles GET /api/v1/movement
+// It returns player movement per side across all captures.
+func (h *Handler) GetMovementStats(c echo.Context) error {
+	sides, err := h.playerCache.GetSideMovements()
+	if err != nil {
+		return fmt.Errorf("process movement stats: %w", err)
+	}
+	if sides == nil {
+		sides = []SideMovement{}
+	}
+
+	return c.JSONPretty(http.StatusOK, MovementReport{Sides: sides}, "\t")
+}
+
+// GetCaptureMovement handles GET /api/v1/captures/:name/movement
+// It returns how far and how fast every player moved in a single capture,
+// with totals per side.
+func (h *Handler) GetCaptureMovement(c echo.Context) error {
+	path, err := h.capturePath(c)
+	if err != nil {
+		return err
+	}
+
+	stats, err := processCapture(path)
+	if err != nil {
+		return fmt.Errorf("process movement stats: %w", err)
+	}
+
+	report := MovementReport{
+		Sides:   stats.SideMovements,
+		Players: make([]PlayerMovement, 0, len(stats.Players)),
+	}
+	for _, p := range stats.Players {
+		report.Players = append(report.Players, PlayerMovement{
+			Name:              p.Name,
+			Side:              p.Side,
+			DistanceOnFoot:    p.DistanceOnFoot,
+			DistanceInVehicle: p.DistanceInVehicle,
+			AverageSpeed:      p.AverageSpeed,
+			MinutesStationary: p.MinutesStationary,
+		})
+	}
+
+	return c.JSONPretty(http.StatusOK, report, "\t")
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/OCAP2/web/capture"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlayerMovement(t *testing.T) {
+	stats := processFixture(t, `{
+		"worldName": "Altis", "missionName": "Op", "endFrame": 10, "captureDelay": 1,
+		"entities": [
+			{"type": "unit", "id": 0, "name": "Alpha", "side": "WEST", "isPlayer": 1, "startFrameNum": 0,
+				"positions": [[[0, 0], 0, 1, 0, "Alpha", 1], [[3, 4], 0, 1, 0, "Alpha", 1], [[3, 4], 0, 1, 0, "Alpha", 1],
+					[[3, 104], 0, 1, 1, "Alpha", 1], [[3, 3000], 0, 1, 0, "Alpha", 1]]},
+			{"type": "unit", "id": 1, "name": "Bravo", "side": "WEST", "isPlayer": 1, "startFrameNum": 0,
+				"positions": [[[0, 0], 0, 1, 0, "Bravo", 1], [[6, 8], 0, 1, 0, "Bravo", 1]]},
+			{"type": "unit", "id": 2, "name": "Charlie", "side": "EAST", "isPlayer": 1, "startFrameNum": 0}
+		]
+	}`)
+
+	// The jump to the last position is a teleport.
+	alpha := playerByName(stats.Players, "Alpha")
+	require.NotNil(t, alpha)
+	assert.Equal(t, 5.0, alpha.DistanceOnFoot)
+	assert.Equal(t, 100.0, alpha.DistanceInVehicle)
+	assert.Equal(t, 1.0/60, alpha.MinutesStationary)
+	assert.Equal(t, 21.0, alpha.AverageSpeed)
+
+	bravo := playerByName(stats.Players, "Bravo")
+	require.NotNil(t, bravo)
+	assert.Equal(t, 10.0, bravo.DistanceOnFoot)
+	assert.Equal(t, 5.0, bravo.AverageSpeed)
+
+	// Players without positions count towards their side, without moving.
+	assert.Equal(t, []SideMovement{
+		{Side: "EAST", Players: 1},
+		{Side: "WEST", Players: 2, DistanceOnFoot: 15, DistanceInVehicle: 100, AverageDistance: 57.5,
+			AverageSpeed: 115.0 / 7, MinutesStationary: 1.0 / 60, aliveSeconds: 7},
+	}, stats.SideMovements)
+}
+
+func TestMovementTrack(t *testing.T) {
+	var m movementTrack
+	for _, p := range []capture.Position{
+		{X: 0, Y: 0, Alive: 1},
+		{X: 3, Y: 4, Alive: 1},
+		{X: 3, Y: 4, Alive: 1},
+		{X: 3, Y: 104, Alive: 1, InVehicle: true},
+		{X: 3, Y: 104, Alive: 0},
+		// Respawn far away: not counted.
+		{X: 900, Y: 900, Alive: 1},
+		{X: 900, Y: 910, Alive: 1},
+		// Teleported: not counted.
+		{X: 900, Y: 5000, Alive: 1},
+	} {
+		p := p
+		m.add(&p)
+	}
+
+	var s PlayerEventSummary
+	applyMovement(&s, &m, 2)
+	assert.Equal(t, 15.0, s.DistanceOnFoot)
+	assert.Equal(t, 100.0, s.DistanceInVehicle)
+	assert.Equal(t, 2.0/60, s.MinutesStationary)
+	assert.Equal(t, 115.0/14, s.AverageSpeed)
+}
@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -155,6 +157,39 @@ func (r *RepoOperation) Store(ctx context.Context, operation *Operation) error {
 	return nil
 }
 
+// Update saves every field of an operation stored before.
+func (r *RepoOperation) Update(ctx context.Context, operation *Operation) error {
+	query := `
+		UPDATE operations SET
+			world_name = $1,
+			mission_name = $2,
+			mission_duration = $3,
+			filename = $4,
+			date = $5,
+			tag = $6
+		WHERE
+			id = $7
+	`
+	_, err := r.db.ExecContext(
+		ctx,
+		query,
+		operation.WorldName,
+		operation.MissionName,
+		operation.MissionDuration,
+		operation.Filename,
+		operation.Date,
+		operation.Tag,
+		operation.ID,
+	)
+	return err
+}
+
+// Delete removes the operation with the given ID.
+func (r *RepoOperation) Delete(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM operations WHERE id = $1`, id)
+	return err
+}
+
 func (r *RepoOperation) Select(ctx context.Context, filter Filter) ([]Operation, error) {
 	query := `
 		SELECT
@@ -183,6 +218,57 @@ func (r *RepoOperation) Select(ctx context.Context, filter Filter) ([]Operation,
 	return r.scan(ctx, rows)
 }
 
+// filenameBatch is the number of filenames SelectByFilenames looks up per
+// query, well below SQLite's limit on the number of query parameters.
+const filenameBatch = 500
+
+// SelectByFilenames returns the operations stored for the given capture
+// filenames (without .gz), in the order they were stored.
+func (r *RepoOperation) SelectByFilenames(ctx context.Context, filenames []string) ([]Operation, error) {
+	ops := []Operation{}
+
+	for len(filenames) > 0 {
+		n := len(filenames)
+		if n > filenameBatch {
+			n = filenameBatch
+		}
+
+		args := make([]any, n)
+		for i, f := range filenames[:n] {
+			args[i] = f
+		}
+		filenames = filenames[n:]
+
+		query := `
+			SELECT
+				*
+			FROM
+				operations
+			WHERE
+				filename IN (?` + strings.Repeat(", ?", n-1) + `)
+			ORDER BY
+				id
+		`
+		rows, err := r.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		batchOps, err := r.scan(ctx, rows)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, batchOps...)
+	}
+
+	// Each batch is in order, but a later batch may hold earlier rows.
+	sort.Slice(ops, func(i, j int) bool {
+		return ops[i].ID < ops[j].ID
+	})
+	return ops, nil
+}
+
 func (*RepoOperation) scan(ctx context.Context, rows *sql.Rows) ([]Operation, error) {
 	var (
 		o   = Operation{}
@@ -1,11 +1,14 @@
 package server
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMigration(t *testing.T) {
@@ -16,3 +19,44 @@ func TestMigration(t *testing.T) {
 	_, err := NewRepoOperation(db)
 	assert.NoError(t, err)
 }
+
+func TestSelectByFilenames(t *testing.T) {
+	ctx := context.Background()
+	repo, err := NewRepoOperation(path.Join(t.TempDir(), "data.db"))
+	require.NoError(t, err)
+
+	for _, name := range []string{"op_a", "op_b", "op_c"} {
+		require.NoError(t, repo.Store(ctx, &Operation{WorldName: "Altis", MissionName: name, Filename: name, Date: "2024-03-09"}))
+	}
+
+	// Operations come in the order they were stored.
+	ops, err := repo.SelectByFilenames(ctx, []string{"op_c", "missing", "op_a"})
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+	assert.Equal(t, "op_a", ops[0].Filename)
+	assert.Equal(t, "op_c", ops[1].Filename)
+}
+
+func TestSelectByFilenamesBatches(t *testing.T) {
+	ctx := context.Background()
+	repo, err := NewRepoOperation(path.Join(t.TempDir(), "data.db"))
+	require.NoError(t, err)
+
+	// More filenames than fit in one query, with stored ones in every batch.
+	filenames := make([]string, 2*filenameBatch+1)
+	for i := range filenames {
+		filenames[i] = fmt.Sprintf("op_%d", i)
+	}
+	// Stored in the reverse order of the batches.
+	stored := []string{filenames[2*filenameBatch], filenames[filenameBatch], filenames[0]}
+	for _, name := range stored {
+		require.NoError(t, repo.Store(ctx, &Operation{WorldName: "Altis", MissionName: name, Filename: name, Date: "2024-03-09"}))
+	}
+
+	ops, err := repo.SelectByFilenames(ctx, filenames)
+	require.NoError(t, err)
+	require.Len(t, ops, 3)
+	for i, op := range ops {
+		assert.Equal(t, stored[i], op.Filename)
+	}
+}
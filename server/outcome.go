@@ -0,0 +1,192 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CaptureOutcome records how a single capture ended and which player sides
+// took part in it.
+type CaptureOutcome struct {
+	Filename    string   `json:"filename"`
+	WorldName   string   `json:"world_name"`
+	MissionName string   `json:"mission_name"`
+	Winner      string   `json:"winner"`
+	Message     string   `json:"message"`
+	Sides       []string `json:"sides"`
+}
+
+// SideRecord holds the win/loss record of one side.
+type SideRecord struct {
+	Side    string  `json:"side"`
+	Played  int     `json:"played"`
+	Wins    int     `json:"wins"`
+	Losses  int     `json:"losses"`
+	Draws   int     `json:"draws"`
+	WinRate float64 `json:"win_rate"`
+}
+
+// SideBreakdown groups side records under a world or mission name.
+type SideBreakdown struct {
+	Name  string       `json:"name"`
+	Sides []SideRecord `json:"sides"`
+}
+
+// SideStats is the output of the side statistics endpoint.
+type SideStats struct {
+	Sides      []SideRecord     `json:"sides"`
+	Worlds     []SideBreakdown  `json:"worlds"`
+	Missions   []SideBreakdown  `json:"missions"`
+	Operations []CaptureOutcome `json:"operations"`
+	Lives      []SideLifeStat   `json:"lives"`
+}
+
+// newCaptureOutcome builds the outcome of a processed capture. It reports
+// false when the capture has no endMission event.
+func newCaptureOutcome(stats *CaptureStats) (CaptureOutcome, bool) {
+	if stats.EndMission == nil {
+		return CaptureOutcome{}, false
+	}
+
+	// Only sides with players count as participants; ambient AI such as
+	// civilians would otherwise collect a loss in nearly every mission.
+	seen := make(map[string]bool)
+	sides := []string{}
+	for _, p := range stats.Players {
+		if !seen[p.Side] {
+			seen[p.Side] = true
+			sides = append(sides, p.Side)
+		}
+	}
+	sort.Strings(sides)
+
+	return CaptureOutcome{
+		Filename:    stats.Filename,
+		WorldName:   stats.WorldName,
+		MissionName: stats.MissionName,
+		Winner:      stats.EndMission.Side,
+		Message:     stats.EndMission.Message,
+		Sides:       sides,
+	}, true
+}
+
+// sideTally accumulates side records keyed by side name.
+type sideTally map[string]*SideRecord
+
+func (t sideTally) add(o *CaptureOutcome) {
+	for _, side := range o.Sides {
+		r, ok := t[side]
+		if !ok {
+			r = &SideRecord{Side: side}
+			t[side] = r
+		}
+		r.Played++
+		switch o.Winner {
+		case "":
+			r.Draws++
+		case side:
+			r.Wins++
+		default:
+			r.Losses++
+		}
+	}
+}
+
+func (t sideTally) records() []SideRecord {
+	records := make([]SideRecord, 0, len(t))
+	for _, r := range t {
+		if r.Played > 0 {
+			r.WinRate = float64(r.Wins) / float64(r.Played)
+		}
+		records = append(records, *r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Side < records[j].Side
+	})
+	return records
+}
+
+// aggregateSideStats computes win rates per side overall, per world and per
+// mission name. World and mission names are compared case-insensitively, so
+// that the same mission uploaded with different casing is counted once; each
+// is listed under the first spelling seen.
+func aggregateSideStats(outcomes []CaptureOutcome) SideStats {
+	overall := sideTally{}
+	worlds := make(map[string]sideTally)
+	worldNames := make(map[string]string)
+	missions := make(map[string]sideTally)
+	missionNames := make(map[string]string)
+
+	for i := range outcomes {
+		o := &outcomes[i]
+		overall.add(o)
+
+		world := breakdownKey(o.WorldName)
+		if worlds[world] == nil {
+			worlds[world] = sideTally{}
+			worldNames[world] = strings.TrimSpace(o.WorldName)
+		}
+		worlds[world].add(o)
+
+		mission := breakdownKey(o.MissionName)
+		if missions[mission] == nil {
+			missions[mission] = sideTally{}
+			missionNames[mission] = strings.TrimSpace(o.MissionName)
+		}
+		missions[mission].add(o)
+	}
+
+	return SideStats{
+		Sides:      overall.records(),
+		Worlds:     sideBreakdowns(worlds, worldNames),
+		Missions:   sideBreakdowns(missions, missionNames),
+		Operations: outcomes,
+	}
+}
+
+// breakdownKey normalises a world or mission name for grouping.
+func breakdownKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// sideBreakdowns lists tallies under the names to show for their keys.
+func sideBreakdowns(tallies map[string]sideTally, names map[string]string) []SideBreakdown {
+	breakdowns := make([]SideBreakdown, 0, len(tallies))
+	for key, t := range tallies {
+		breakdowns = append(breakdowns, SideBreakdown{Name: names[key], Sides: t.records()})
+	}
+	sort.Slice(breakdowns, func(i, j int) bool {
+		return breakdowns[i].Name < breakdowns[j].Name
+	})
+	return breakdowns
+}
+
+// GetSideStats handles GET /api/v1/stats/sides
+// It reports win rates per side, per world and per mission name, together
+// with the recorded result of every operation and player life expectancy per
+// side.
+func (h *Handler) GetSideStats(c echo.Context) error {
+	outcomes, err := h.playerCache.GetOutcomes()
+	if err != nil {
+		return fmt.Errorf("process capture outcomes: %w", err)
+	}
+
+	if outcomes == nil {
+		outcomes = []CaptureOutcome{}
+	}
+
+	stats := aggregateSideStats(outcomes)
+	stats.Lives, err = h.playerCache.GetSideLives()
+	if err != nil {
+		return fmt.Errorf("process side lives: %w", err)
+	}
+	if stats.Lives == nil {
+		stats.Lives = []SideLifeStat{}
+	}
+
+	return c.JSONPretty(http.StatusOK, stats, "\t")
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaptureOutcome(t *testing.T) {
+	const units = `
+		{"type": "unit", "id": 0, "name": "Alpha", "side": "WEST", "isPlayer": 1, "startFrameNum": 0},
+		{"type": "unit", "id": 1, "name": "Delta", "side": "GUER", "isPlayer": 1, "startFrameNum": 0},
+		{"type": "unit", "id": 2, "name": "Citizen", "side": "CIV", "isPlayer": 0, "startFrameNum": 0}`
+
+	t.Run("last endMission wins", func(t *testing.T) {
+		stats := processFixture(t, `{
+			"worldName": "Altis", "missionName": "Op", "endFrame": 10, "captureDelay": 1,
+			"entities": [`+units+`],
+			"events": [[5, "endMission", ["EAST", "Too early"]], [9, "endMission", ["IND", "Independent wins"]]]
+		}`)
+
+		// IND is the side entities call GUER.
+		assert.Equal(t, &EndMission{Side: "GUER", Message: "Independent wins"}, stats.EndMission)
+		alpha := playerByName(stats.Players, "Alpha")
+		require.NotNil(t, alpha)
+		assert.Equal(t, 0, alpha.Wins)
+		assert.Equal(t, 1, alpha.Losses)
+		delta := playerByName(stats.Players, "Delta")
+		require.NotNil(t, delta)
+		assert.Equal(t, 1, delta.Wins)
+		assert.Equal(t, 0, delta.Losses)
+
+		// Civilians are AI only, so they take no part.
+		outcome, ok := newCaptureOutcome(stats)
+		require.True(t, ok)
+		assert.Equal(t, CaptureOutcome{
+			Filename: "op", WorldName: "Altis", MissionName: "Op",
+			Winner: "GUER", Message: "Independent wins", Sides: []string{"GUER", "WEST"},
+		}, outcome)
+	})
+
+	t.Run("draw", func(t *testing.T) {
+		stats := processFixture(t, `{
+			"worldName": "Altis", "missionName": "Op", "endFrame": 10, "captureDelay": 1,
+			"entities": [`+units+`],
+			"events": [[9, "endMission", ["", "Nobody wins"]]]
+		}`)
+
+		for _, p := range stats.Players {
+			assert.Zero(t, p.Wins, p.Name)
+			assert.Zero(t, p.Losses, p.Name)
+		}
+		outcome, ok := newCaptureOutcome(stats)
+		require.True(t, ok)
+		assert.Empty(t, outcome.Winner)
+	})
+
+	t.Run("no endMission", func(t *testing.T) {
+		stats := processFixture(t, `{
+			"worldName": "Altis", "missionName": "Op", "endFrame": 10, "captureDelay": 1,
+			"entities": [`+units+`],
+			"events": []
+		}`)
+
+		assert.Nil(t, stats.EndMission)
+		_, ok := newCaptureOutcome(stats)
+		assert.False(t, ok)
+	})
+}
+
+func TestAggregateSideStats(t *testing.T) {
+	outcomes := []CaptureOutcome{
+		{Filename: "a", WorldName: "Altis", MissionName: "M1", Winner: "WEST", Sides: []string{"EAST", "WEST"}},
+		{Filename: "b", WorldName: "altis", MissionName: "M2", Winner: "EAST", Sides: []string{"EAST", "WEST"}},
+		{Filename: "c", WorldName: "Stratis", MissionName: "M1", Winner: "", Sides: []string{"WEST"}},
+		{Filename: "d", WorldName: "Stratis", MissionName: "m1 ", Winner: "WEST", Sides: []string{"WEST"}},
+	}
+
+	stats := aggregateSideStats(outcomes)
+
+	assert.Equal(t, []SideRecord{
+		{Side: "EAST", Played: 2, Wins: 1, Losses: 1, WinRate: 0.5},
+		{Side: "WEST", Played: 4, Wins: 2, Losses: 1, Draws: 1, WinRate: 0.5},
+	}, stats.Sides)
+	require.Len(t, stats.Worlds, 2)
+	// Worlds are shown as first spelled, not by their internal key.
+	assert.Equal(t, "Altis", stats.Worlds[0].Name)
+	assert.Equal(t, "Stratis", stats.Worlds[1].Name)
+	// Mission names differing only in case and spacing are the same mission.
+	require.Len(t, stats.Missions, 2)
+	assert.Equal(t, "M1", stats.Missions[0].Name)
+	assert.Equal(t, []SideRecord{
+		{Side: "EAST", Played: 1, Losses: 1},
+		{Side: "WEST", Played: 3, Wins: 2, Draws: 1, WinRate: 2.0 / 3},
+	}, stats.Missions[0].Sides)
+}
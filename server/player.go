@@ -2,7 +2,6 @@ package server
 
 import (
 	"compress/gzip"
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -16,205 +15,684 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/OCAP2/web/capture"
 	"github.com/labstack/echo/v4"
 )
 
-// captureEntityMeta holds only the fields needed for player statistics.
-// Unrecognised JSON fields (group, role, framesFired) are silently skipped
-// by the decoder, avoiding large allocations for data we never use.
-type captureEntityMeta struct {
-	Type     string `json:"type"`
-	ID       int    `json:"id"`
-	Name     string `json:"name"`
-	Side     string `json:"side"`
-	IsPlayer int    `json:"isPlayer"`
-}
-
 // ---- Output structures ----
 
-// PlayerWeaponStat holds kill count per weapon for a player.
+// PlayerWeaponStat holds kill and hit counts per weapon for a player.
 type PlayerWeaponStat struct {
-	Weapon string `json:"weapon"`
-	Kills  int    `json:"kills"`
+	Weapon              string  `json:"weapon"`
+	Kills               int     `json:"kills"`
+	Hits                int     `json:"hits"`
+	HitsPerKill         float64 `json:"hits_per_kill"`
+	LongestKill         float64 `json:"longest_kill"`
+	AverageKillDistance float64 `json:"average_kill_distance"`
+	MedianKillDistance  float64 `json:"median_kill_distance"`
+	ShotsFired          int     `json:"shots_fired"`
+	Accuracy            float64 `json:"accuracy"`
+	RoundsPerKill       float64 `json:"rounds_per_kill"`
+
+	killDistances []float64 // raw distances, kept so captures can be merged
 }
 
 // PlayerEventSummary is the per-player output returned by the endpoint.
 type PlayerEventSummary struct {
-	ID            int                `json:"id"`
-	Name          string             `json:"name"`
-	Side          string             `json:"side"`
-	KillCount     int                `json:"kill_count"`
-	DeathCount    int                `json:"death_count"`
-	TeamKillCount int                `json:"team_kill_count"`
-	WeaponStats   []PlayerWeaponStat `json:"weapon_stats"`
+	ID            int    `json:"id"`
+	Name          string `json:"name"`
+	Side          string `json:"side"`
+	KillCount     int    `json:"kill_count"`
+	DeathCount    int    `json:"death_count"`
+	TeamKillCount int    `json:"team_kill_count"`
+
+	// Kills broken down by victim: PlayerKills + AIKills + VehicleKills +
+	// CivilianKills + Suicides == KillCount. Killing oneself has always
+	// counted in KillCount and still does, so that totals and rankings are
+	// unchanged, but it is only broken down as a suicide.
+	PlayerKills   int `json:"player_kills"`
+	AIKills       int `json:"ai_kills"`
+	VehicleKills  int `json:"vehicle_kills"`
+	CivilianKills int `json:"civilian_kills"`
+
+	// Deaths broken down by killer, summing to DeathCount. Deaths with no
+	// known killing unit (collisions, fire, falling) count as environment.
+	DeathsByPlayer    int `json:"deaths_by_player"`
+	DeathsByAI        int `json:"deaths_by_ai"`
+	Suicides          int `json:"suicides"`
+	EnvironmentDeaths int `json:"environment_deaths"`
+
+	// Hits from "hit" events. FriendlyHits counts hits on players of the
+	// same side; HitsPerKill is HitsDealt / KillCount.
+	HitsDealt    int     `json:"hits_dealt"`
+	HitsTaken    int     `json:"hits_taken"`
+	FriendlyHits int     `json:"friendly_hits"`
+	HitsPerKill  float64 `json:"hits_per_kill"`
+
+	// Kill distances in metres, from kills whose event records one.
+	LongestKill           float64          `json:"longest_kill"`
+	AverageKillDistance   float64          `json:"average_kill_distance"`
+	MedianKillDistance    float64          `json:"median_kill_distance"`
+	KillDistanceHistogram []DistanceBucket `json:"kill_distance_histogram"`
+
+	// Rounds fired, from framesFired. Accuracy is HitsDealt / ShotsFired and
+	// only an estimate: explosive hits have no matching shot, so it can
+	// exceed 1 for grenadiers and AT gunners.
+	ShotsFired    int     `json:"shots_fired"`
+	Accuracy      float64 `json:"accuracy"`
+	RoundsPerKill float64 `json:"rounds_per_kill"`
+
+	Wins        int                `json:"wins"`
+	Losses      int                `json:"losses"`
+	WeaponStats []PlayerWeaponStat `json:"weapon_stats"`
+
+	// Unconscious state from unit positions: times knocked unconscious,
+	// revived, and killed while unconscious (bled out or finished off).
+	TimesDowned       int `json:"times_downed"`
+	Revives           int `json:"revives"`
+	DeathsAfterDowned int `json:"deaths_after_downed"`
+
+	// Lives from spawn or respawn to death. AverageLife is in seconds;
+	// Lives is only set for a single capture.
+	LifeCount   int     `json:"life_count"`
+	AverageLife float64 `json:"average_life"`
+	Lives       []Life  `json:"lives,omitempty"`
+
+	// Movement while alive: distances in metres, AverageSpeed in metres
+	// per second of life.
+	DistanceOnFoot    float64 `json:"distance_on_foot"`
+	DistanceInVehicle float64 `json:"distance_in_vehicle"`
+	AverageSpeed      float64 `json:"average_speed"`
+	MinutesStationary float64 `json:"minutes_stationary"`
+
+	// Attendance. Dates are YYYY-MM-DD; Presence is only set for a single
+	// capture and lists the frames during which the player was connected.
+	OperationsAttended int                `json:"operations_attended"`
+	MinutesPlayed      float64            `json:"minutes_played"`
+	FirstSeen          string             `json:"first_seen"`
+	LastSeen           string             `json:"last_seen"`
+	Presence           []PresenceInterval `json:"presence,omitempty"`
+
+	// Role and group of the player's unit; only set for a single capture.
+	Role  string `json:"role,omitempty"`
+	Group string `json:"group,omitempty"`
+	// Roles lists every role played with its record.
+	Roles []RoleRecord `json:"roles"`
+	// Vehicles lists the vehicle classes crewed, most used first.
+	Vehicles []PlayerVehicleStat `json:"vehicles"`
+
+	killDistances []float64     // raw distances, kept so captures can be merged
+	notableKills  []NotableKill // kept for the player profile
+	lifeSeconds   float64       // total length of all lives
+	aliveSeconds  float64       // time alive, for the average speed
 }
 
-// ---- Core logic ----
+// EndMission is the result announced by the last "endMission" event of a
+// capture. Side is empty when the mission ended without a winner.
+type EndMission struct {
+	Side    string `json:"side"`
+	Message string `json:"message"`
+}
 
-// processPlayerEvents reads a gzip-compressed capture file using a streaming
-// JSON decoder. Only one entity or event is in memory at a time, avoiding the
-// need to deserialise the entire (often huge) capture into a single struct.
-func processPlayerEvents(path string) ([]PlayerEventSummary, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, fmt.Errorf("open capture file: %w", err)
+// CaptureStats is the per-capture output of processCapture.
+// Date is taken from the first "times" entry, or the file's modification
+// time for captures that do not record one.
+type CaptureStats struct {
+	Filename      string
+	WorldName     string
+	MissionName   string
+	Date          string
+	CaptureDelay  float64 // seconds per frame
+	EndFrame      int
+	EndMission    *EndMission
+	Players       []PlayerEventSummary
+	TeamKills     []TeamKillIncident
+	Duels         []DuelKill // kills of players by other players
+	Groups        []GroupStat
+	Vehicles      VehicleReport
+	SideLives     []SideLifeStat
+	SideMovements []SideMovement
+	Summary       *CaptureSummary
+	Anonymized    bool // a public copy of another capture
+}
+
+// normaliseSide maps the side names used by endMission events onto the
+// names used by entities, so that both can be compared directly.
+func normaliseSide(side string) string {
+	side = strings.ToUpper(side)
+	if side == "IND" {
+		return "GUER"
 	}
-	defer f.Close()
+	return side
+}
 
-	gz, err := gzip.NewReader(f)
+// ---- Core logic ----
+
+// hitKilledEvent is a decoded "hit" or "killed" event.
+type hitKilledEvent struct {
+	Frame int
+	Type  string
+	capture.HitKilled
+}
+
+// parseHitKilledEvent decodes a hit or killed event. It reports false when
+// the victim cannot be identified.
+func parseHitKilledEvent(e *capture.Event) (hitKilledEvent, bool) {
+	hk, err := e.HitKilled()
 	if err != nil {
-		return nil, fmt.Errorf("create gzip reader: %w", err)
+		return hitKilledEvent{}, false
 	}
-	defer gz.Close()
+	return hitKilledEvent{Frame: e.Frame, Type: e.Type, HitKilled: hk}, true
+}
 
-	dec := json.NewDecoder(gz)
+// playerAcc accumulates one player's statistics within a single capture.
+type playerAcc struct {
+	PlayerEventSummary
+	weaponMap  map[string]*PlayerWeaponStat
+	shotFrames []int
+	weaponUses []weaponUse
+	lastAlive  int // alive state in the unit's last frame, or aliveUnknown
+	vehicleMap map[string]*PlayerVehicleStat
+	startFrame int
+	lifeRuns   []lifeRun
+	killFrames []int
+	move       movementTrack
+}
 
-	// Read opening '{'.
-	if _, err := dec.Token(); err != nil {
-		return nil, fmt.Errorf("read opening brace: %w", err)
+func newPlayerAcc(e capture.Entity) *playerAcc {
+	return &playerAcc{
+		PlayerEventSummary: PlayerEventSummary{
+			ID:    e.ID,
+			Name:  e.Name,
+			Side:  e.Side,
+			Role:  roleName(e.Role),
+			Group: e.Group,
+		},
+		weaponMap:  make(map[string]*PlayerWeaponStat),
+		vehicleMap: make(map[string]*PlayerVehicleStat),
 	}
+}
 
-	type playerAcc struct {
-		PlayerEventSummary
-		weaponMap map[string]int
+// weapon returns the stat entry for the named weapon, creating it if needed.
+func (p *playerAcc) weapon(name string) *PlayerWeaponStat {
+	ws, ok := p.weaponMap[name]
+	if !ok {
+		ws = &PlayerWeaponStat{Weapon: name}
+		p.weaponMap[name] = ws
 	}
-	playerMap := make(map[int]*playerAcc)
+	return ws
+}
 
-	for dec.More() {
-		tok, err := dec.Token()
-		if err != nil {
-			return nil, fmt.Errorf("read key: %w", err)
-		}
-		key, ok := tok.(string)
-		if !ok {
-			continue
-		}
+// captureParser holds the state built up while streaming one capture.
+type captureParser struct {
+	stats    *CaptureStats
+	entities map[int]capture.Entity
+	players  map[int]*playerAcc
 
-		switch key {
-		case "entities":
-			// Read opening '['.
-			if _, err := dec.Token(); err != nil {
-				return nil, fmt.Errorf("read entities start: %w", err)
-			}
-			// Stream one entity at a time — each is decoded, inspected, then discarded.
-			for dec.More() {
-				var e captureEntityMeta
-				if err := dec.Decode(&e); err != nil {
-					return nil, fmt.Errorf("decode entity: %w", err)
-				}
-				if e.Type != "unit" || e.IsPlayer != 1 {
-					continue
-				}
+	groups     map[groupKey]*groupAcc
+	unitGroups map[int]*groupAcc // unit ID -> group
 
-				playerMap[e.ID] = &playerAcc{
-					PlayerEventSummary: PlayerEventSummary{
-						ID:   e.ID,
-						Name: e.Name,
-						Side: e.Side,
-					},
-					weaponMap: make(map[string]int),
-				}
-			}
-			// Read closing ']'.
-			if _, err := dec.Token(); err != nil {
-				return nil, fmt.Errorf("read entities end: %w", err)
-			}
+	vehicles *vehicleTally
+	crewRuns map[int][]crewRun // unit ID -> vehicles crewed
 
-		case "events":
-			// Read opening '['.
-			if _, err := dec.Token(); err != nil {
-				return nil, fmt.Errorf("read events start: %w", err)
-			}
-			for dec.More() {
-				var rawEvent []json.RawMessage
-				if err := dec.Decode(&rawEvent); err != nil {
-					return nil, fmt.Errorf("decode event: %w", err)
-				}
-				if len(rawEvent) < 4 {
-					continue
-				}
+	// Frames of "connected" and "disconnected" events, keyed by player name.
+	connects    map[string][]int
+	disconnects map[string][]int
 
-				var eventType string
-				if err := json.Unmarshal(rawEvent[1], &eventType); err != nil || eventType != "killed" {
-					continue
-				}
+	summary *summaryTally
+}
 
-				var victimID int
-				if err := json.Unmarshal(rawEvent[2], &victimID); err != nil {
-					continue
-				}
+// onConnection records a connected or disconnected event.
+func (cp *captureParser) onConnection(e *capture.Event) {
+	name, err := e.Connection()
+	if err != nil {
+		return
+	}
 
-				var causedByInfo []json.RawMessage
-				if err := json.Unmarshal(rawEvent[3], &causedByInfo); err != nil || len(causedByInfo) < 2 {
-					continue
-				}
+	if e.Type == capture.EventConnected {
+		cp.connects[name] = append(cp.connects[name], e.Frame)
+	} else {
+		cp.disconnects[name] = append(cp.disconnects[name], e.Frame)
+	}
+}
 
-				var killerID int
-				if err := json.Unmarshal(causedByInfo[0], &killerID); err != nil {
-					continue
-				}
+func (cp *captureParser) onKilled(ev hitKilledEvent) {
+	killerMeta, killerKnown := cp.entities[ev.CausedByID]
+	victimMeta := cp.entities[ev.VictimID]
 
-				weapon := "N/A"
-				if err := json.Unmarshal(causedByInfo[1], &weapon); err != nil {
-					weapon = "N/A"
-				}
+	cp.onGroupKill(ev)
+	cp.onVehicleKill(ev, killerMeta, victimMeta, killerKnown)
+	cp.onSummaryKill(ev, killerMeta, victimMeta, killerKnown)
 
-				killer, killerIsPlayer := playerMap[killerID]
-				victim, victimIsPlayer := playerMap[victimID]
+	killer, killerIsPlayer := cp.players[ev.CausedByID]
+	victim, victimIsPlayer := cp.players[ev.VictimID]
 
-				if killerIsPlayer {
-					killer.KillCount++
-					killer.weaponMap[weapon]++
+	// Killing oneself counts towards the total and the weapon used, as it
+	// always has, but in none of the kill categories.
+	if killerIsPlayer && ev.CausedByID == ev.VictimID {
+		killer.KillCount++
+		killer.weapon(ev.Weapon).Kills++
+	}
+	if killerIsPlayer && ev.CausedByID != ev.VictimID {
+		killer.KillCount++
+		killer.killFrames = append(killer.killFrames, ev.Frame)
+		killer.weaponUses = append(killer.weaponUses, weaponUse{frame: ev.Frame, weapon: ev.Weapon})
+		ws := killer.weapon(ev.Weapon)
+		ws.Kills++
+		if ev.HasDistance {
+			killer.killDistances = append(killer.killDistances, ev.Distance)
+			ws.killDistances = append(ws.killDistances, ev.Distance)
+		}
 
-					if victimIsPlayer && killerID != victimID && killer.Side == victim.Side {
-						killer.TeamKillCount++
-					}
-				}
+		if kill, ok := cp.notableKill(ev, victimMeta); ok {
+			killer.notableKills = append(killer.notableKills, kill)
+		}
 
-				if victimIsPlayer {
-					victim.DeathCount++
-				}
-			}
-			// Read closing ']'.
-			if _, err := dec.Token(); err != nil {
-				return nil, fmt.Errorf("read events end: %w", err)
-			}
+		switch {
+		case victimMeta.Type == "vehicle":
+			killer.VehicleKills++
+		case victimMeta.IsPlayer == 1:
+			killer.PlayerKills++
+		case victimMeta.Side == "CIV":
+			killer.CivilianKills++
+		default:
+			killer.AIKills++
+		}
 
+		if victimIsPlayer {
+			cp.stats.Duels = append(cp.stats.Duels, DuelKill{
+				Frame:    ev.Frame,
+				Killer:   killer.Name,
+				Victim:   victim.Name,
+				Weapon:   ev.Weapon,
+				Distance: ev.Distance,
+			})
+		}
+
+		if victimIsPlayer && killer.Side == victim.Side {
+			killer.TeamKillCount++
+			cp.onFriendlyFire(ev, killer, victim)
+		}
+	}
+
+	if victimIsPlayer {
+		victim.DeathCount++
+
+		switch {
+		case ev.CausedByID == ev.VictimID:
+			victim.Suicides++
+		case !killerKnown || killerMeta.Type != "unit":
+			victim.EnvironmentDeaths++
+		case killerMeta.IsPlayer == 1:
+			victim.DeathsByPlayer++
 		default:
-			// Skip unknown top-level fields (worldName, missionName, etc.).
-			var discard json.RawMessage
-			if err := dec.Decode(&discard); err != nil {
-				return nil, fmt.Errorf("skip field %s: %w", key, err)
-			}
+			victim.DeathsByAI++
 		}
 	}
+}
 
-	// Collect results: convert weapon maps to sorted slices.
-	players := make([]PlayerEventSummary, 0, len(playerMap))
-	for _, p := range playerMap {
-		ws := make([]PlayerWeaponStat, 0, len(p.weaponMap))
-		for weapon, kills := range p.weaponMap {
-			ws = append(ws, PlayerWeaponStat{Weapon: weapon, Kills: kills})
+func (cp *captureParser) onHit(ev hitKilledEvent) {
+	shooter, shooterIsPlayer := cp.players[ev.CausedByID]
+	victim, victimIsPlayer := cp.players[ev.VictimID]
+
+	if shooterIsPlayer && ev.CausedByID != ev.VictimID {
+		shooter.HitsDealt++
+		shooter.weaponUses = append(shooter.weaponUses, weaponUse{frame: ev.Frame, weapon: ev.Weapon})
+		shooter.weapon(ev.Weapon).Hits++
+
+		if victimIsPlayer && shooter.Side == victim.Side {
+			shooter.FriendlyHits++
+			cp.onFriendlyFire(ev, shooter, victim)
 		}
-		sort.Slice(ws, func(i, j int) bool {
+	}
+
+	if victimIsPlayer {
+		victim.HitsTaken++
+	}
+}
+
+// ratio returns n divided by d, or 0 when d is zero.
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
+// weaponStatSlice converts a weapon map into a slice sorted by kills and
+// fills in the derived ratios.
+func weaponStatSlice(weaponMap map[string]*PlayerWeaponStat) []PlayerWeaponStat {
+	ws := make([]PlayerWeaponStat, 0, len(weaponMap))
+	for _, w := range weaponMap {
+		w.HitsPerKill = ratio(w.Hits, w.Kills)
+		w.LongestKill, w.AverageKillDistance, w.MedianKillDistance = summariseDistances(w.killDistances)
+		w.Accuracy = ratio(w.Hits, w.ShotsFired)
+		w.RoundsPerKill = ratio(w.ShotsFired, w.Kills)
+		ws = append(ws, *w)
+	}
+	sort.Slice(ws, func(i, j int) bool {
+		if ws[i].Kills != ws[j].Kills {
 			return ws[i].Kills > ws[j].Kills
-		})
-		p.WeaponStats = ws
+		}
+		return ws[i].Weapon < ws[j].Weapon
+	})
+	return ws
+}
+
+// applyDerivedStats fills in the ratios and distance statistics that are
+// computed from a player's counters rather than accumulated directly.
+func applyDerivedStats(p *PlayerEventSummary) {
+	p.HitsPerKill = ratio(p.HitsDealt, p.KillCount)
+	p.Accuracy = ratio(p.HitsDealt, p.ShotsFired)
+	p.RoundsPerKill = ratio(p.ShotsFired, p.KillCount)
+	applyKillDistances(p)
+}
+
+// finish converts the accumulated players into the capture's summaries.
+func (cp *captureParser) finish() {
+	for _, frames := range cp.connects {
+		sort.Ints(frames)
+	}
+	for _, frames := range cp.disconnects {
+		sort.Ints(frames)
+	}
+
+	cp.applyCrewTime()
+
+	players := make([]PlayerEventSummary, 0, len(cp.players))
+	for _, p := range cp.players {
+		p.attributeShots()
+		p.WeaponStats = weaponStatSlice(p.weaponMap)
+		p.Vehicles = vehicleStatSlice(p.vehicleMap)
+		applyDerivedStats(&p.PlayerEventSummary)
+
+		p.Presence = clipPresence(p.Presence, cp.disconnects[p.Name], cp.connects[p.Name])
+		p.MinutesPlayed = presenceMinutes(p.Presence, cp.stats.CaptureDelay)
+		p.OperationsAttended = 1
+		p.Lives = lives(p.lifeRuns, p.startFrame, p.killFrames, cp.stats.CaptureDelay)
+		applyLives(&p.PlayerEventSummary)
+		applyMovement(&p.PlayerEventSummary, &p.move, cp.stats.CaptureDelay)
+		survived := p.lastAlive != capture.StateDead && (p.lastAlive != aliveUnknown || p.DeathCount == 0)
+		p.Roles = captureRoles(&p.PlayerEventSummary, survived)
+		p.FirstSeen = cp.stats.Date
+		p.LastSeen = cp.stats.Date
+		for i := range p.notableKills {
+			p.notableKills[i].Date = cp.stats.Date
+		}
+
+		if end := cp.stats.EndMission; end != nil && end.Side != "" {
+			if p.Side == end.Side {
+				p.Wins = 1
+			} else {
+				p.Losses = 1
+			}
+		}
+
 		players = append(players, p.PlayerEventSummary)
 	}
 
 	sort.Slice(players, func(i, j int) bool {
 		return players[i].KillCount > players[j].KillCount
 	})
+	cp.stats.Players = players
+	cp.stats.Groups = cp.groupStats()
+	cp.stats.SideLives = captureSideLives(players)
+	cp.stats.SideMovements = captureSideMovements(players)
+	cp.stats.Vehicles = cp.vehicles.report()
+	cp.stats.Summary = cp.buildSummary()
+
+	// The capture's date may only be known once every field has been read.
+	for i := range cp.stats.TeamKills {
+		inc := &cp.stats.TeamKills[i]
+		inc.Filename = cp.stats.Filename
+		inc.WorldName = cp.stats.WorldName
+		inc.MissionName = cp.stats.MissionName
+		inc.Date = cp.stats.Date
+		inc.Time = float64(inc.Frame) * cp.stats.CaptureDelay
+	}
+	for i := range cp.stats.Duels {
+		d := &cp.stats.Duels[i]
+		d.Filename = cp.stats.Filename
+		d.WorldName = cp.stats.WorldName
+		d.MissionName = cp.stats.MissionName
+		d.Date = cp.stats.Date
+	}
+}
+
+// onEntity records a streamed unit or vehicle entity.
+func (cp *captureParser) onEntity(scan *entityScan) {
+	e := scan.meta
+	cp.entities[e.ID] = e
+	cp.summary.addEntity(e)
+	switch e.Type {
+	case "unit":
+		cp.onUnit(e, scan.track.lastAlive)
+	case "vehicle":
+		cp.onVehicle(e, scan.track.crewRuns(e.ID, e.StartFrameNum))
+	}
+	if e.Type != "unit" || e.IsPlayer != 1 {
+		return
+	}
 
-	return players, nil
+	acc := newPlayerAcc(e)
+	acc.ShotsFired = len(scan.shots)
+	acc.shotFrames = append([]int(nil), scan.shots...)
+	acc.Presence = scan.track.presence(e.StartFrameNum)
+	acc.lastAlive = scan.track.lastAlive
+	acc.TimesDowned = scan.track.downed
+	acc.Revives = scan.track.revived
+	acc.DeathsAfterDowned = scan.track.diedDowned
+	acc.startFrame = e.StartFrameNum
+	acc.lifeRuns = append([]lifeRun(nil), scan.track.lives...)
+	acc.move = scan.track.move
+	cp.players[e.ID] = acc
 }
 
-// processAllPlayerEvents iterates every .gz file in dataDir concurrently,
-// processes player events for each, and merges results by player name.
+// onEvent records a streamed event.
+func (cp *captureParser) onEvent(e *capture.Event) {
+	switch e.Type {
+	case capture.EventEndMission:
+		if end, err := e.EndMission(); err == nil {
+			cp.stats.EndMission = &EndMission{Side: normaliseSide(end.Side), Message: end.Message}
+		}
+
+	case capture.EventConnected, capture.EventDisconnected:
+		cp.onConnection(e)
+
+	case capture.EventKilled, capture.EventHit:
+		ev, ok := parseHitKilledEvent(e)
+		if !ok {
+			return
+		}
+		if e.Type == capture.EventKilled {
+			cp.onKilled(ev)
+		} else {
+			cp.onHit(ev)
+		}
+	}
+}
+
+// processCapture reads a gzip-compressed capture file with capture.Walk.
+// Only one entity or event is in memory at a time, avoiding the need to
+// deserialise the entire (often huge) capture into a single struct.
+func processCapture(path string) (*CaptureStats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open capture file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat capture file: %w", err)
+	}
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("create gzip reader: %w", err)
+	}
+	defer gz.Close()
+
+	cp := &captureParser{
+		stats: &CaptureStats{
+			Filename: strings.TrimSuffix(filepath.Base(path), ".gz"),
+		},
+		entities:    make(map[int]capture.Entity),
+		players:     make(map[int]*playerAcc),
+		groups:      make(map[groupKey]*groupAcc),
+		unitGroups:  make(map[int]*groupAcc),
+		vehicles:    newVehicleTally(),
+		crewRuns:    make(map[int][]crewRun),
+		connects:    make(map[string][]int),
+		disconnects: make(map[string][]int),
+		summary:     newSummaryTally(),
+	}
+	stats := cp.stats
+
+	// Each entity is inspected once it has been streamed, then discarded.
+	var scan entityScan
+	v := scanEntities(&scan, func(scan *entityScan) error {
+		cp.onEntity(scan)
+		return nil
+	})
+	v.Time = func(i int, t *capture.Time) error {
+		if i == 0 {
+			cp.summary.firstTime = *t
+			if len(t.SystemTimeUTC) >= 10 {
+				stats.Date = t.SystemTimeUTC[:10]
+			}
+		}
+		cp.summary.lastTime = *t
+		return nil
+	}
+	v.Event = func(_ int, e *capture.Event) error {
+		cp.onEvent(e)
+		return nil
+	}
+
+	walked, err := capture.Walk(gz, v)
+	if err != nil {
+		return nil, err
+	}
+	stats.WorldName = walked.WorldName
+	stats.MissionName = walked.MissionName
+	stats.CaptureDelay = walked.CaptureDelay
+	stats.EndFrame = walked.EndFrame
+	stats.Anonymized = walked.Anonymized
+	cp.summary.markers = walked.Markers
+
+	if stats.Date == "" {
+		stats.Date = info.ModTime().UTC().Format("2006-01-02")
+	}
+
+	cp.finish()
+
+	return stats, nil
+}
+
+// archiveStats is the result of processing every capture in the data directory.
+type archiveStats struct {
+	players   []PlayerEventSummary
+	outcomes  []CaptureOutcome
+	teamKills []TeamKillIncident
+	duels     []DuelKill
+	groups    []GroupStat // player groups, merged by name
+	vehicles  VehicleReport
+	sideLives []SideLifeStat
+	movements []SideMovement
+	// appearances holds the operations each player attended, sorted by
+	// date, keyed by lowercased player name.
+	appearances map[string][]PlayerAppearance
+}
+
+// mergedPlayer accumulates one player's statistics across captures.
+type mergedPlayer struct {
+	PlayerEventSummary
+	weaponMap   map[string]*PlayerWeaponStat
+	roleMap     map[string]*roleAcc
+	vehicleMap  map[string]*PlayerVehicleStat
+	appearances map[string]*PlayerAppearance // keyed by capture filename
+}
+
+// add folds a single capture's summary for the same player into m. A player
+// who used several units in one capture still attended it only once.
+func (m *mergedPlayer) add(p *PlayerEventSummary, capture *CaptureStats) {
+	a, ok := m.appearances[capture.Filename]
+	if !ok {
+		a = &PlayerAppearance{
+			Filename:     capture.Filename,
+			WorldName:    capture.WorldName,
+			MissionName:  capture.MissionName,
+			Date:         capture.Date,
+			Side:         p.Side,
+			captureDelay: capture.CaptureDelay,
+		}
+		m.appearances[capture.Filename] = a
+	}
+	if a.Role == "" {
+		a.Role = p.Role
+		a.Group = p.Group
+	}
+	a.Presence = append(a.Presence, p.Presence...)
+	a.Kills += p.KillCount
+	a.Deaths += p.DeathCount
+	a.notableKills = append(a.notableKills, p.notableKills...)
+	addRoles(m.roleMap, p.Roles, capture.Filename)
+	for _, vs := range p.Vehicles {
+		v, ok := m.vehicleMap[vs.Class]
+		if !ok {
+			v = &PlayerVehicleStat{Class: vs.Class}
+			m.vehicleMap[vs.Class] = v
+		}
+		v.Minutes += vs.Minutes
+		v.Kills += vs.Kills
+	}
+
+	m.KillCount += p.KillCount
+	m.DeathCount += p.DeathCount
+	m.TeamKillCount += p.TeamKillCount
+	m.PlayerKills += p.PlayerKills
+	m.AIKills += p.AIKills
+	m.VehicleKills += p.VehicleKills
+	m.CivilianKills += p.CivilianKills
+	m.DeathsByPlayer += p.DeathsByPlayer
+	m.DeathsByAI += p.DeathsByAI
+	m.Suicides += p.Suicides
+	m.EnvironmentDeaths += p.EnvironmentDeaths
+	m.HitsDealt += p.HitsDealt
+	m.HitsTaken += p.HitsTaken
+	m.FriendlyHits += p.FriendlyHits
+	m.ShotsFired += p.ShotsFired
+	m.TimesDowned += p.TimesDowned
+	m.Revives += p.Revives
+	m.DeathsAfterDowned += p.DeathsAfterDowned
+	m.LifeCount += p.LifeCount
+	m.lifeSeconds += p.lifeSeconds
+	m.DistanceOnFoot += p.DistanceOnFoot
+	m.DistanceInVehicle += p.DistanceInVehicle
+	m.MinutesStationary += p.MinutesStationary
+	m.aliveSeconds += p.aliveSeconds
+	m.killDistances = append(m.killDistances, p.killDistances...)
+	m.Wins += p.Wins
+	m.Losses += p.Losses
+	for _, ws := range p.WeaponStats {
+		w, ok := m.weaponMap[ws.Weapon]
+		if !ok {
+			w = &PlayerWeaponStat{Weapon: ws.Weapon}
+			m.weaponMap[ws.Weapon] = w
+		}
+		w.Kills += ws.Kills
+		w.Hits += ws.Hits
+		w.ShotsFired += ws.ShotsFired
+		w.killDistances = append(w.killDistances, ws.killDistances...)
+	}
+}
+
+// processAllCaptures iterates every .gz file in dataDir concurrently,
+// processes each capture, and merges player results by player name.
 // Results are merged incrementally under a mutex so that per-file summaries
 // can be garbage-collected as soon as they are folded in.
-func processAllPlayerEvents(dataDir string, blacklist []string) ([]PlayerEventSummary, error) {
+func processAllCaptures(dataDir string, blacklist []string) (*archiveStats, error) {
 	allFiles, err := filepath.Glob(filepath.Join(dataDir, "*.gz"))
 	if err != nil {
 		return nil, fmt.Errorf("glob data dir: %w", err)
@@ -239,13 +717,16 @@ func processAllPlayerEvents(dataDir string, blacklist []string) ([]PlayerEventSu
 	totalFiles := len(files)
 	log.Printf("[player-cache] processing %d capture files using %d workers", totalFiles, runtime.NumCPU())
 
-	// Shared merge map — each worker merges its results immediately.
-	type mergedPlayer struct {
-		PlayerEventSummary
-		weaponMap map[string]int
-	}
+	// Shared merge state — each worker merges its results immediately.
 	var mu sync.Mutex
 	merged := make(map[string]*mergedPlayer)
+	var outcomes []CaptureOutcome
+	var teamKills []TeamKillIncident
+	var duels []DuelKill
+	groups := make(map[groupKey]*GroupStat)
+	vehicles := newVehicleTally()
+	lifeTally := sideLives{}
+	moveTally := sideMovements{}
 
 	var wg sync.WaitGroup
 	var processed atomic.Int64
@@ -258,42 +739,52 @@ func processAllPlayerEvents(dataDir string, blacklist []string) ([]PlayerEventSu
 			sem <- struct{}{}
 			defer func() { <-sem }()
 
-			players, err := processPlayerEvents(filePath)
+			stats, err := processCapture(filePath)
 			if err != nil {
 				log.Printf("[player-cache] error processing %s: %v", filepath.Base(filePath), err)
 				processed.Add(1)
 				return
 			}
+			// Anonymized copies would count the players of their original
+			// twice, under other names.
+			if stats.Anonymized {
+				processed.Add(1)
+				return
+			}
 
-			// Merge into shared map immediately so per-file data can be freed.
+			// Merge into shared state immediately so per-file data can be freed.
 			mu.Lock()
-			for i := range players {
-				p := &players[i]
+			for i := range stats.Players {
+				p := &stats.Players[i]
 				acc, exists := merged[p.Name]
 				if !exists {
-					wm := make(map[string]int, len(p.WeaponStats))
-					for _, ws := range p.WeaponStats {
-						wm[ws.Weapon] = ws.Kills
-					}
-					merged[p.Name] = &mergedPlayer{
+					acc = &mergedPlayer{
 						PlayerEventSummary: PlayerEventSummary{
-							ID:            p.ID,
-							Name:          p.Name,
-							Side:          p.Side,
-							KillCount:     p.KillCount,
-							DeathCount:    p.DeathCount,
-							TeamKillCount: p.TeamKillCount,
+							ID:   p.ID,
+							Name: p.Name,
+							Side: p.Side,
 						},
-						weaponMap: wm,
-					}
-				} else {
-					acc.KillCount += p.KillCount
-					acc.DeathCount += p.DeathCount
-					acc.TeamKillCount += p.TeamKillCount
-					for _, ws := range p.WeaponStats {
-						acc.weaponMap[ws.Weapon] += ws.Kills
+						weaponMap:   make(map[string]*PlayerWeaponStat, len(p.WeaponStats)),
+						roleMap:     make(map[string]*roleAcc),
+						vehicleMap:  make(map[string]*PlayerVehicleStat),
+						appearances: make(map[string]*PlayerAppearance),
 					}
+					merged[p.Name] = acc
 				}
+				acc.add(p, stats)
+			}
+			if outcome, ok := newCaptureOutcome(stats); ok {
+				outcomes = append(outcomes, outcome)
+			}
+			teamKills = append(teamKills, stats.TeamKills...)
+			duels = append(duels, stats.Duels...)
+			mergeGroups(groups, stats.Groups)
+			vehicles.add(&stats.Vehicles, stats.Players)
+			for _, sl := range stats.SideLives {
+				lifeTally.add(sl.Side, sl.Lives, sl.Deaths, sl.lifeSeconds)
+			}
+			for i := range stats.SideMovements {
+				moveTally.add(&stats.SideMovements[i])
 			}
 			mu.Unlock()
 
@@ -306,15 +797,26 @@ func processAllPlayerEvents(dataDir string, blacklist []string) ([]PlayerEventSu
 	wg.Wait()
 
 	result := make([]PlayerEventSummary, 0, len(merged))
+	appearances := make(map[string][]PlayerAppearance, len(merged))
 	for _, m := range merged {
-		ws := make([]PlayerWeaponStat, 0, len(m.weaponMap))
-		for weapon, kills := range m.weaponMap {
-			ws = append(ws, PlayerWeaponStat{Weapon: weapon, Kills: kills})
+		m.WeaponStats = weaponStatSlice(m.weaponMap)
+		m.Roles = roleSlice(m.roleMap)
+		m.Vehicles = vehicleStatSlice(m.vehicleMap)
+		m.AverageLife = ratioFloat(m.lifeSeconds, m.LifeCount)
+		m.AverageSpeed = averageSpeed(m.DistanceOnFoot+m.DistanceInVehicle, m.aliveSeconds)
+		applyDerivedStats(&m.PlayerEventSummary)
+
+		ops := m.appearanceSlice()
+		m.OperationsAttended = len(ops)
+		for _, op := range ops {
+			m.MinutesPlayed += op.Minutes
 		}
-		sort.Slice(ws, func(i, j int) bool {
-			return ws[i].Kills > ws[j].Kills
-		})
-		m.WeaponStats = ws
+		if len(ops) > 0 {
+			m.FirstSeen = ops[0].Date
+			m.LastSeen = ops[len(ops)-1].Date
+		}
+		appearances[strings.ToLower(m.Name)] = ops
+
 		result = append(result, m.PlayerEventSummary)
 	}
 
@@ -322,7 +824,41 @@ func processAllPlayerEvents(dataDir string, blacklist []string) ([]PlayerEventSu
 		return result[i].KillCount > result[j].KillCount
 	})
 
-	return result, nil
+	// Workers finish in arbitrary order; keep outcomes stable for callers.
+	sort.Slice(outcomes, func(i, j int) bool {
+		return outcomes[i].Filename < outcomes[j].Filename
+	})
+	sortDuelKills(duels)
+
+	return &archiveStats{
+		players:     result,
+		outcomes:    outcomes,
+		teamKills:   teamKills,
+		duels:       duels,
+		groups:      groupSlice(groups),
+		vehicles:    vehicles.report(),
+		sideLives:   lifeTally.stats(),
+		movements:   moveTally.stats(),
+		appearances: appearances,
+	}, nil
+}
+
+// appearanceSlice returns m's appearances sorted by date, with the presence
+// of every unit the player used in a capture merged together.
+func (m *mergedPlayer) appearanceSlice() []PlayerAppearance {
+	ops := make([]PlayerAppearance, 0, len(m.appearances))
+	for _, a := range m.appearances {
+		a.Presence = mergePresence(a.Presence)
+		a.Minutes = presenceMinutes(a.Presence, a.captureDelay)
+		ops = append(ops, *a)
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].Date != ops[j].Date {
+			return ops[i].Date < ops[j].Date
+		}
+		return ops[i].Filename < ops[j].Filename
+	})
+	return ops
 }
 
 // ---- Player Cache ----
@@ -333,9 +869,18 @@ type PlayerCache struct {
 	mu        sync.RWMutex
 	allStats  []PlayerEventSummary
 	byName    map[string]*PlayerEventSummary // lowercased full name -> summary
-	built     bool
-	dataDir   string
-	blacklist []string
+	outcomes  []CaptureOutcome
+	teamKills []TeamKillIncident
+	kills     *killMatrix
+	groups    []GroupStat
+	vehicles  VehicleReport
+	sideLives []SideLifeStat
+	movements []SideMovement
+	// appearances maps lowercased full names to the operations attended.
+	appearances map[string][]PlayerAppearance
+	built       bool
+	dataDir     string
+	blacklist   []string
 }
 
 // NewPlayerCache creates an empty cache for the given data directory.
@@ -366,11 +911,12 @@ func (c *PlayerCache) ensureBuilt() error {
 	log.Println("[player-cache] building cache...")
 	start := time.Now()
 
-	stats, err := processAllPlayerEvents(c.dataDir, c.blacklist)
+	archive, err := processAllCaptures(c.dataDir, c.blacklist)
 	if err != nil {
 		return err
 	}
 
+	stats := archive.players
 	byName := make(map[string]*PlayerEventSummary, len(stats))
 	for i := range stats {
 		byName[strings.ToLower(stats[i].Name)] = &stats[i]
@@ -378,6 +924,14 @@ func (c *PlayerCache) ensureBuilt() error {
 
 	c.allStats = stats
 	c.byName = byName
+	c.outcomes = archive.outcomes
+	c.teamKills = archive.teamKills
+	c.kills = newKillMatrix(archive.duels)
+	c.groups = archive.groups
+	c.vehicles = archive.vehicles
+	c.sideLives = archive.sideLives
+	c.movements = archive.movements
+	c.appearances = archive.appearances
 	c.built = true
 
 	log.Printf("[player-cache] cache built in %s — %d unique players", time.Since(start).Round(time.Millisecond), len(stats))
@@ -394,8 +948,10 @@ func (c *PlayerCache) GetAll() ([]PlayerEventSummary, error) {
 	return c.allStats, nil
 }
 
-// GetByName returns aggregated stats for a single player (case-insensitive
-// substring match). Returns nil if no player matches.
+// GetByName returns aggregated stats for a single player. An exact
+// (case-insensitive) name wins; otherwise the best ranked prefix or substring
+// match is used, so the same query always resolves to the same player.
+// Returns nil if no player matches.
 func (c *PlayerCache) GetByName(playerName string) (*PlayerEventSummary, error) {
 	if err := c.ensureBuilt(); err != nil {
 		return nil, err
@@ -410,14 +966,103 @@ func (c *PlayerCache) GetByName(playerName string) (*PlayerEventSummary, error)
 		return p, nil
 	}
 
-	// Fall back to substring match.
-	for key, p := range c.byName {
-		if strings.Contains(key, normalised) {
-			return p, nil
-		}
+	// Fall back to the best search result, ignoring fuzzy matches.
+	results := rankPlayers(c.allStats, playerName)
+	if len(results) == 0 || results[0].match == matchFuzzy {
+		return nil, nil
 	}
+	return c.byName[strings.ToLower(results[0].Name)], nil
+}
 
-	return nil, nil
+// Search returns the players whose name matches query, best match first.
+func (c *PlayerCache) Search(query string) ([]PlayerSearchResult, error) {
+	if err := c.ensureBuilt(); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return rankPlayers(c.allStats, query), nil
+}
+
+// GetOutcomes returns the endMission result of every capture that has one.
+func (c *PlayerCache) GetOutcomes() ([]CaptureOutcome, error) {
+	if err := c.ensureBuilt(); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.outcomes, nil
+}
+
+// GetTeamKills returns every team kill and friendly hit between players.
+func (c *PlayerCache) GetTeamKills() ([]TeamKillIncident, error) {
+	if err := c.ensureBuilt(); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.teamKills, nil
+}
+
+// GetKillMatrix returns the killer to victim matrix of every player kill.
+func (c *PlayerCache) GetKillMatrix() (*killMatrix, error) {
+	if err := c.ensureBuilt(); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.kills, nil
+}
+
+// GetGroups returns the player groups aggregated across captures.
+func (c *PlayerCache) GetGroups() ([]GroupStat, error) {
+	if err := c.ensureBuilt(); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.groups, nil
+}
+
+// GetVehicles returns vehicle statistics across captures.
+func (c *PlayerCache) GetVehicles() (VehicleReport, error) {
+	if err := c.ensureBuilt(); err != nil {
+		return VehicleReport{}, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.vehicles, nil
+}
+
+// GetSideLives returns the life expectancy of players per side.
+func (c *PlayerCache) GetSideLives() ([]SideLifeStat, error) {
+	if err := c.ensureBuilt(); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.sideLives, nil
+}
+
+// GetSideMovements returns player movement per side across captures.
+func (c *PlayerCache) GetSideMovements() ([]SideMovement, error) {
+	if err := c.ensureBuilt(); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.movements, nil
+}
+
+// GetAppearances returns the operations attended by the player with the given
+// full name (case-insensitive), sorted by date.
+func (c *PlayerCache) GetAppearances(playerName string) ([]PlayerAppearance, error) {
+	if err := c.ensureBuilt(); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.appearances[strings.ToLower(playerName)], nil
 }
 
 // Invalidate marks the cache as stale so the next request triggers a rebuild.
@@ -426,6 +1071,14 @@ func (c *PlayerCache) Invalidate() {
 	c.built = false
 	c.allStats = nil
 	c.byName = nil
+	c.outcomes = nil
+	c.teamKills = nil
+	c.kills = nil
+	c.groups = nil
+	c.vehicles = VehicleReport{}
+	c.sideLives = nil
+	c.movements = nil
+	c.appearances = nil
 	c.mu.Unlock()
 	log.Println("[player-cache] cache invalidated")
 }
@@ -433,7 +1086,7 @@ func (c *PlayerCache) Invalidate() {
 // ---- HTTP handler ----
 
 // GetAllPlayerStats handles GET /api/v1/players
-// It aggregates kill/death/weapon statistics for every player across all captures.
+// It aggregates kill/death/hit/weapon statistics for every player across all captures.
 func (h *Handler) GetAllPlayerStats(c echo.Context) error {
 	players, err := h.playerCache.GetAll()
 	if err != nil {
@@ -465,20 +1118,31 @@ func (h *Handler) GetPlayerStatsByName(c echo.Context) error {
 // GetPlayerEvents handles GET /api/v1/captures/:name/players
 // It returns a JSON array of PlayerEventSummary for every player in the capture.
 func (h *Handler) GetPlayerEvents(c echo.Context) error {
-	name, err := url.PathUnescape(c.Param("name"))
+	path, err := h.capturePath(c)
 	if err != nil {
 		return err
 	}
 
-	path := filepath.Join(h.setting.Data, filepath.Base(name+".gz"))
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return echo.ErrNotFound
+	stats, err := processCapture(path)
+	if err != nil {
+		return fmt.Errorf("process player events: %w", err)
 	}
 
-	players, err := processPlayerEvents(path)
+	return c.JSONPretty(http.StatusOK, stats.Players, "\t")
+}
+
+// capturePath resolves the :name route parameter to the path of an existing
+// capture file, or echo.ErrNotFound.
+func (h *Handler) capturePath(c echo.Context) (string, error) {
+	name, err := url.PathUnescape(c.Param("name"))
 	if err != nil {
-		return fmt.Errorf("process player events: %w", err)
+		return "", err
 	}
 
-	return c.JSONPretty(http.StatusOK, players, "\t")
+	path := filepath.Join(h.setting.Data, filepath.Base(name+".gz"))
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return "", echo.ErrNotFound
+	}
+
+	return path, nil
 }
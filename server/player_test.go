@@ -0,0 +1,237 @@
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCapture stores a gzip-compressed capture in dir and returns its path.
+func writeCapture(t *testing.T, dir, name, capture string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name+".gz")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	_, err = gz.Write([]byte(capture))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	return path
+}
+
+const testCapture = `{
+	"worldName": "Altis",
+	"missionName": "Op Test",
+	"endFrame": 100,
+	"captureDelay": 1,
+	"times": [{"frameNum": 0, "systemTimeUTC": "2024-03-09T19:00:00.000", "date": "2035-06-01T05:00:00", "timeMultiplier": 1, "time": 0}],
+	"entities": [
+		{"type": "unit", "id": 0, "name": "Alpha", "side": "WEST", "group": "Alpha 1-1", "role": "Rifleman", "isPlayer": 1, "startFrameNum": 0, "positions": [], "framesFired": []},
+		{"type": "unit", "id": 1, "name": "Bravo", "side": "WEST", "group": "Alpha 1-1", "role": "Medic@Alpha 1-1", "isPlayer": 1, "startFrameNum": 2, "positions": [[[1, 1, 0], 0, 1, 0, "Bravo", 0], [[1, 1, 0], 0, 1, 0, "Bravo", 1], [], [[1, 1, 0], 0, 2, 0, "Bravo", 1], [[1, 1, 0], 0, 1, 0, "Bravo", 1], [[1, 1, 0], 0, 1, 0, "Bravo", 1], [[1, 1, 0], 0, 2, 0, "Bravo", 1], [[1, 1, 0], 0, 0, 0, "Bravo", 1], [[1, 1, 0], 0, 0, 0, "Bravo", 0], [[1, 1, 0], 0, 1, 0, "Bravo", 1]], "framesFired": []},
+		{"framesFired": [[8, [1, 2, 0]], [45, [1, 2, 0]], [50, [1, 2, 0]], [70, [1, 2, 0]]], "type": "unit", "id": 2, "name": "Charlie", "side": "EAST", "group": "Bravo 1-1", "role": "Rifleman", "isPlayer": 1, "startFrameNum": 0, "positions": []},
+		{"type": "unit", "id": 3, "name": "Rifleman", "side": "EAST", "group": "Bravo 1-2", "role": "Rifleman", "isPlayer": 0, "startFrameNum": 0, "positions": [], "framesFired": []},
+		{"type": "vehicle", "id": 4, "name": "Offroad", "class": "car", "startFrameNum": 59, "positions": [[[0, 0, 0], 0, 1, [2]], [[0, 0, 0], 0, 1, [2]], [[0, 0, 0], 0, 1, []]]},
+		{"type": "unit", "id": 5, "name": "Citizen", "side": "CIV", "group": "Civilians", "role": "", "isPlayer": 0, "startFrameNum": 0, "positions": [], "framesFired": []},
+		{"type": "vehicle", "id": 6, "name": "Ghosthawk", "class": "heli", "startFrameNum": 0, "positions": [[[0, 0, 0], 0, 1, [0], [10, 14]]]}
+	],
+	"events": [
+		[3, "connected", "Bravo"],
+		[5, "disconnected", "Bravo"],
+		[7, "connected", "Bravo"],
+		[8, "hit", 2, [0, "MX"], 120],
+		[9, "hit", 1, [0, "MX"], 5],
+		[9, "hit", 0, [2, "AK-12"], 300],
+		[10, "killed", 2, [0, "MX"], 120],
+		[20, "killed", 3, [0, "MX"], 40],
+		[30, "killed", 1, [0, "MX"], 5],
+		[40, "killed", 0, [2, "AK-12"], 300],
+		[50, "killed", 4, [2, "RPG-7"], 200],
+		[60, "killed", 5, [2, "AK-12"], 10],
+		[70, "killed", 2, ["null"], 0],
+		[80, "killed", 1, [1, "Grenade"], 0],
+		[90, "endMission", ["IND", "Independent wins"]],
+		[95, "endMission", ["WEST", "Objective secured"]]
+	],
+	"Markers": [["mil_dot", "Objective", 0, 100, -1, "ColorRed", -1, [[0, [10, 10], 0, 1]], [1, 1], "ICON", "Solid"], ["mil_arrow", "", 10, 100, 0, "ColorBlue", 0, [[10, [20, 20], 90, 1]]]]
+}`
+
+// processFixture processes capture, stored as op, and returns its statistics.
+func processFixture(t *testing.T, capture string) *CaptureStats {
+	t.Helper()
+
+	stats, err := processCapture(writeCapture(t, t.TempDir(), "op", capture))
+	require.NoError(t, err)
+	return stats
+}
+
+// newAdminHandler returns a handler for the captures in dir, with the secret
+// "secret" and an operation stored for each of names.
+func newAdminHandler(t *testing.T, dir string, names ...string) *Handler {
+	t.Helper()
+
+	repo, err := NewRepoOperation(filepath.Join(dir, "data.db"))
+	require.NoError(t, err)
+	for _, name := range names {
+		require.NoError(t, repo.Store(context.Background(), &Operation{WorldName: "Altis", MissionName: "Op Test", MissionDuration: 100, Filename: name, Date: "2024-03-09", Tag: "TvT"}))
+	}
+
+	return &Handler{
+		repoOperation: repo,
+		playerCache:   NewPlayerCache(dir, nil),
+		setting:       Setting{Data: dir, Secret: "secret"},
+	}
+}
+
+// formContext returns a context for a request posting form to target, with
+// name as the capture name parameter when set.
+func formContext(target, name string, form url.Values) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	if name != "" {
+		c.SetParamNames("name")
+		c.SetParamValues(name)
+	}
+	return c, rec
+}
+
+func playerByName(players []PlayerEventSummary, name string) *PlayerEventSummary {
+	for i := range players {
+		if players[i].Name == name {
+			return &players[i]
+		}
+	}
+	return nil
+}
+
+func TestProcessCapture(t *testing.T) {
+	path := writeCapture(t, t.TempDir(), "op_test", testCapture)
+
+	stats, err := processCapture(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, "op_test", stats.Filename)
+	assert.Equal(t, "Altis", stats.WorldName)
+	assert.Equal(t, "Op Test", stats.MissionName)
+	assert.Equal(t, "2024-03-09", stats.Date)
+	assert.Equal(t, 100, stats.EndFrame)
+	require.Len(t, stats.Players, 3)
+
+	alpha := playerByName(stats.Players, "Alpha")
+	require.NotNil(t, alpha)
+	require.Len(t, alpha.WeaponStats, 1)
+	mx := alpha.WeaponStats[0]
+	assert.Equal(t, "MX", mx.Weapon)
+	assert.Equal(t, 3, mx.Kills)
+}
+
+func TestKillCategories(t *testing.T) {
+	stats := processFixture(t, `{
+		"worldName": "Altis", "missionName": "Op", "endFrame": 10, "captureDelay": 1,
+		"entities": [
+			{"type": "unit", "id": 0, "name": "Alpha", "side": "WEST", "isPlayer": 1, "startFrameNum": 0},
+			{"type": "unit", "id": 1, "name": "Bravo", "side": "WEST", "isPlayer": 1, "startFrameNum": 0},
+			{"type": "unit", "id": 2, "name": "Charlie", "side": "EAST", "isPlayer": 1, "startFrameNum": 0},
+			{"type": "unit", "id": 3, "name": "Rifleman", "side": "EAST", "isPlayer": 0, "startFrameNum": 0},
+			{"type": "unit", "id": 4, "name": "Citizen", "side": "CIV", "isPlayer": 0, "startFrameNum": 0},
+			{"type": "vehicle", "id": 5, "name": "Offroad", "class": "car", "startFrameNum": 0}
+		],
+		"events": [
+			[1, "killed", 3, [0, "MX"], 10],
+			[2, "killed", 4, [0, "MX"], 10],
+			[3, "killed", 5, [0, "MX"], 10],
+			[4, "killed", 2, [0, "MX"], 10],
+			[5, "killed", 1, [0, "MX"], 10],
+			[6, "killed", 0, [3, "AK-12"], 10],
+			[7, "killed", 2, ["null"], 0],
+			[8, "killed", 1, [5, "Offroad"], 0],
+			[9, "killed", 2, [2, "Grenade"], 0]
+		]
+	}`)
+
+	alpha := playerByName(stats.Players, "Alpha")
+	require.NotNil(t, alpha)
+	assert.Equal(t, 5, alpha.KillCount)
+	assert.Equal(t, 2, alpha.PlayerKills)
+	assert.Equal(t, 1, alpha.AIKills)
+	assert.Equal(t, 1, alpha.CivilianKills)
+	assert.Equal(t, 1, alpha.VehicleKills)
+	assert.Equal(t, 1, alpha.TeamKillCount)
+	assert.Equal(t, 1, alpha.DeathCount)
+	assert.Equal(t, 1, alpha.DeathsByAI)
+
+	// A unit killed by a vehicle, not by its crew, died to the environment.
+	bravo := playerByName(stats.Players, "Bravo")
+	require.NotNil(t, bravo)
+	assert.Equal(t, 0, bravo.KillCount)
+	assert.Equal(t, 2, bravo.DeathCount)
+	assert.Equal(t, 1, bravo.DeathsByPlayer)
+	assert.Equal(t, 1, bravo.EnvironmentDeaths)
+
+	// Killing oneself counts as a kill, but only in the total and for the
+	// weapon.
+	charlie := playerByName(stats.Players, "Charlie")
+	require.NotNil(t, charlie)
+	assert.Equal(t, 1, charlie.KillCount)
+	assert.Equal(t, []PlayerWeaponStat{{Weapon: "Grenade", Kills: 1}}, charlie.WeaponStats)
+	assert.Zero(t, charlie.PlayerKills+charlie.AIKills+charlie.CivilianKills+charlie.VehicleKills)
+	assert.Equal(t, 3, charlie.DeathCount)
+	assert.Equal(t, 1, charlie.DeathsByPlayer)
+	assert.Equal(t, 1, charlie.EnvironmentDeaths)
+	assert.Equal(t, 1, charlie.Suicides)
+}
+
+func TestHitStats(t *testing.T) {
+	stats := processFixture(t, `{
+		"worldName": "Altis", "missionName": "Op", "endFrame": 10, "captureDelay": 1,
+		"entities": [
+			{"type": "unit", "id": 0, "name": "Alpha", "side": "WEST", "isPlayer": 1, "startFrameNum": 0},
+			{"type": "unit", "id": 1, "name": "Bravo", "side": "WEST", "isPlayer": 1, "startFrameNum": 0},
+			{"type": "unit", "id": 2, "name": "Charlie", "side": "EAST", "isPlayer": 1, "startFrameNum": 0},
+			{"type": "unit", "id": 3, "name": "Rifleman", "side": "EAST", "isPlayer": 0, "startFrameNum": 0}
+		],
+		"events": [
+			[1, "hit", 2, [0, "MX"], 50],
+			[2, "hit", 2, [0, "MX"], 50],
+			[3, "hit", 1, [0, "M4"], 5],
+			[4, "hit", 0, [0, "Grenade"], 0],
+			[5, "hit", 0, [3, "AK-12"], 100],
+			[6, "killed", 2, [0, "MX"], 50],
+			[7, "hit", 3, ["null"], 0]
+		]
+	}`)
+
+	// Hitting oneself is taken, not dealt.
+	alpha := playerByName(stats.Players, "Alpha")
+	require.NotNil(t, alpha)
+	assert.Equal(t, 3, alpha.HitsDealt)
+	assert.Equal(t, 2, alpha.HitsTaken)
+	assert.Equal(t, 1, alpha.FriendlyHits)
+	assert.Equal(t, 3.0, alpha.HitsPerKill)
+	require.Len(t, alpha.WeaponStats, 2)
+	assert.Equal(t, "MX", alpha.WeaponStats[0].Weapon)
+	assert.Equal(t, 2, alpha.WeaponStats[0].Hits)
+	assert.Equal(t, 2.0, alpha.WeaponStats[0].HitsPerKill)
+	// No kills: the ratio is 0 rather than infinite.
+	assert.Equal(t, "M4", alpha.WeaponStats[1].Weapon)
+	assert.Equal(t, 1, alpha.WeaponStats[1].Hits)
+	assert.Zero(t, alpha.WeaponStats[1].HitsPerKill)
+
+	assert.Equal(t, 1, playerByName(stats.Players, "Bravo").HitsTaken)
+	assert.Equal(t, 2, playerByName(stats.Players, "Charlie").HitsTaken)
+}
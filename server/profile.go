@@ -0,0 +1,256 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/OCAP2/web/capture"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// notableKillDistance is the distance in metres from which any kill is
+	// notable, whatever the victim.
+	notableKillDistance = 300
+	// profileRecentKills is the number of notable kills listed in a profile.
+	profileRecentKills = 10
+	// profileFavourites is the number of weapons and worlds listed in a profile.
+	profileFavourites = 5
+)
+
+// NotableKill is a kill worth linking to from a player's profile: a player or
+// vehicle kill, or a long-range one. Filename and Frame locate it in the
+// replay.
+type NotableKill struct {
+	Filename   string  `json:"filename"`
+	Date       string  `json:"date"`
+	Frame      int     `json:"frame"`
+	Victim     string  `json:"victim"`
+	VictimType string  `json:"victim_type"` // player, vehicle, ai or civilian
+	Weapon     string  `json:"weapon"`
+	Distance   float64 `json:"distance"`
+}
+
+// NameCount counts operations per side, role, group or world.
+type NameCount struct {
+	Name       string `json:"name"`
+	Operations int    `json:"operations"`
+}
+
+// MonthlyActivity summarises a player's operations in one calendar month.
+type MonthlyActivity struct {
+	Month      string  `json:"month"` // YYYY-MM
+	Operations int     `json:"operations"`
+	Minutes    float64 `json:"minutes"`
+	Kills      int     `json:"kills"`
+	Deaths     int     `json:"deaths"`
+}
+
+// ProfileOperation is an operation the player appeared in, together with the
+// stored Operation row when there is one.
+type ProfileOperation struct {
+	PlayerAppearance
+	Operation *Operation `json:"operation"`
+}
+
+// PlayerProfile is the output of the player profile endpoint.
+type PlayerProfile struct {
+	Stats            *PlayerEventSummary `json:"stats"`
+	MostPlayedSide   string              `json:"most_played_side"`
+	MostPlayedRole   string              `json:"most_played_role"`
+	MostPlayedGroup  string              `json:"most_played_group"`
+	Sides            []NameCount         `json:"sides"`
+	Roles            []NameCount         `json:"roles"`
+	Groups           []NameCount         `json:"groups"`
+	FavouriteWeapons []PlayerWeaponStat  `json:"favourite_weapons"`
+	FavouriteWorlds  []NameCount         `json:"favourite_worlds"`
+	Monthly          []MonthlyActivity   `json:"monthly"`
+	RecentKills      []NotableKill       `json:"recent_kills"`
+	Operations       []ProfileOperation  `json:"operations"`
+}
+
+// notableKill returns the kill described by ev if it is notable. Its date is
+// filled in by finish.
+func (cp *captureParser) notableKill(ev hitKilledEvent, victim capture.Entity) (NotableKill, bool) {
+	var victimType string
+	switch {
+	case victim.Type == "vehicle":
+		victimType = "vehicle"
+	case victim.IsPlayer == 1:
+		victimType = "player"
+	case victim.Side == "CIV":
+		victimType = "civilian"
+	default:
+		victimType = "ai"
+	}
+
+	longRange := ev.HasDistance && ev.Distance >= notableKillDistance
+	if victimType != "player" && victimType != "vehicle" && !longRange {
+		return NotableKill{}, false
+	}
+
+	return NotableKill{
+		Filename:   cp.stats.Filename,
+		Frame:      ev.Frame,
+		Victim:     victim.Name,
+		VictimType: victimType,
+		Weapon:     ev.Weapon,
+		Distance:   ev.Distance,
+	}, true
+}
+
+// nameCounts counts the non-empty names and sorts them by count, then name.
+func nameCounts(names []string) []NameCount {
+	counts := make(map[string]int)
+	for _, name := range names {
+		if name != "" {
+			counts[name]++
+		}
+	}
+
+	result := make([]NameCount, 0, len(counts))
+	for name, n := range counts {
+		result = append(result, NameCount{Name: name, Operations: n})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Operations != result[j].Operations {
+			return result[i].Operations > result[j].Operations
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// mostPlayed returns the first name of counts, which must be sorted.
+func mostPlayed(counts []NameCount) string {
+	if len(counts) == 0 {
+		return ""
+	}
+	return counts[0].Name
+}
+
+// newPlayerProfile builds a profile from a player's merged statistics and
+// their appearances, which must be sorted by date.
+func newPlayerProfile(player *PlayerEventSummary, appearances []PlayerAppearance, ops []Operation) PlayerProfile {
+	byFilename := make(map[string]*Operation, len(ops))
+	for i := range ops {
+		byFilename[ops[i].Filename] = &ops[i]
+	}
+
+	var (
+		sides, roles, groups, worlds []string
+		kills                        []NotableKill
+		months                       []MonthlyActivity
+	)
+	operations := make([]ProfileOperation, 0, len(appearances))
+
+	for _, a := range appearances {
+		sides = append(sides, a.Side)
+		roles = append(roles, a.Role)
+		groups = append(groups, a.Group)
+		worlds = append(worlds, a.WorldName)
+		kills = append(kills, a.notableKills...)
+
+		if len(a.Date) >= 7 {
+			month := a.Date[:7]
+			if len(months) == 0 || months[len(months)-1].Month != month {
+				months = append(months, MonthlyActivity{Month: month})
+			}
+			m := &months[len(months)-1]
+			m.Operations++
+			m.Minutes += a.Minutes
+			m.Kills += a.Kills
+			m.Deaths += a.Deaths
+		}
+
+		operations = append(operations, ProfileOperation{
+			PlayerAppearance: a,
+			Operation:        byFilename[a.Filename],
+		})
+	}
+
+	// Most recent first.
+	sort.SliceStable(kills, func(i, j int) bool {
+		if kills[i].Date != kills[j].Date {
+			return kills[i].Date > kills[j].Date
+		}
+		if kills[i].Filename != kills[j].Filename {
+			return kills[i].Filename > kills[j].Filename
+		}
+		return kills[i].Frame > kills[j].Frame
+	})
+	if len(kills) > profileRecentKills {
+		kills = kills[:profileRecentKills]
+	}
+	if kills == nil {
+		kills = []NotableKill{}
+	}
+	if months == nil {
+		months = []MonthlyActivity{}
+	}
+
+	weapons := player.WeaponStats
+	if len(weapons) > profileFavourites {
+		weapons = weapons[:profileFavourites]
+	}
+	favouriteWorlds := nameCounts(worlds)
+	if len(favouriteWorlds) > profileFavourites {
+		favouriteWorlds = favouriteWorlds[:profileFavourites]
+	}
+
+	p := PlayerProfile{
+		Stats:            player,
+		Sides:            nameCounts(sides),
+		Roles:            nameCounts(roles),
+		Groups:           nameCounts(groups),
+		FavouriteWeapons: weapons,
+		FavouriteWorlds:  favouriteWorlds,
+		Monthly:          months,
+		RecentKills:      kills,
+		Operations:       operations,
+	}
+	p.MostPlayedSide = mostPlayed(p.Sides)
+	p.MostPlayedRole = mostPlayed(p.Roles)
+	p.MostPlayedGroup = mostPlayed(p.Groups)
+
+	return p
+}
+
+// GetPlayerProfile handles GET /api/v1/players/:name/profile
+// It returns a player's statistics together with the operations they played,
+// their usual side, role and group, favourite weapons and worlds, monthly
+// activity and recent notable kills.
+func (h *Handler) GetPlayerProfile(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	playerName, err := url.PathUnescape(c.Param("name"))
+	if err != nil {
+		return err
+	}
+
+	player, err := h.playerCache.GetByName(playerName)
+	if err != nil {
+		return fmt.Errorf("process player events by name: %w", err)
+	}
+	if player == nil {
+		return echo.ErrNotFound
+	}
+
+	appearances, err := h.playerCache.GetAppearances(player.Name)
+	if err != nil {
+		return fmt.Errorf("process player attendance: %w", err)
+	}
+
+	filenames := make([]string, 0, len(appearances))
+	for _, a := range appearances {
+		filenames = append(filenames, a.Filename)
+	}
+	ops, err := h.repoOperation.SelectByFilenames(ctx, filenames)
+	if err != nil {
+		return fmt.Errorf("select operations: %w", err)
+	}
+
+	return c.JSONPretty(http.StatusOK, newPlayerProfile(player, appearances, ops), "\t")
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotableKills(t *testing.T) {
+	stats := processFixture(t, `{
+		"worldName": "Altis", "missionName": "Op", "endFrame": 10, "captureDelay": 1,
+		"times": [{"frameNum": 0, "systemTimeUTC": "2024-03-09T19:00:00.000"}],
+		"entities": [
+			{"type": "unit", "id": 0, "name": "Alpha", "side": "WEST", "isPlayer": 1, "startFrameNum": 0},
+			{"type": "unit", "id": 1, "name": "Charlie", "side": "EAST", "isPlayer": 1, "startFrameNum": 0},
+			{"type": "unit", "id": 2, "name": "Rifleman", "side": "EAST", "isPlayer": 0, "startFrameNum": 0},
+			{"type": "unit", "id": 3, "name": "Citizen", "side": "CIV", "isPlayer": 0, "startFrameNum": 0},
+			{"type": "vehicle", "id": 4, "name": "Offroad", "class": "car", "startFrameNum": 0}
+		],
+		"events": [
+			[1, "killed", 1, [0, "MX"], 10],
+			[2, "killed", 2, [0, "MX"], 40],
+			[3, "killed", 2, [0, "LRR"], 300],
+			[4, "killed", 4, [0, "RPG-42"], 50],
+			[5, "killed", 3, [0, "LRR"], 299]
+		]
+	}`)
+
+	// Player and vehicle kills are notable at any range, others from 300 m.
+	alpha := playerByName(stats.Players, "Alpha")
+	require.NotNil(t, alpha)
+	assert.Equal(t, []NotableKill{
+		{Filename: "op", Date: "2024-03-09", Frame: 1, Victim: "Charlie", VictimType: "player", Weapon: "MX", Distance: 10},
+		{Filename: "op", Date: "2024-03-09", Frame: 3, Victim: "Rifleman", VictimType: "ai", Weapon: "LRR", Distance: 300},
+		{Filename: "op", Date: "2024-03-09", Frame: 4, Victim: "Offroad", VictimType: "vehicle", Weapon: "RPG-42", Distance: 50},
+	}, alpha.notableKills)
+}
+
+func TestNewPlayerProfile(t *testing.T) {
+	appearances := []PlayerAppearance{
+		{Filename: "a", WorldName: "Altis", Date: "2024-02-10", Side: "WEST", Role: "Medic", Group: "Alpha 1-1", Kills: 1, Minutes: 30,
+			notableKills: []NotableKill{{Filename: "a", Date: "2024-02-10", Frame: 5}}},
+		{Filename: "b", WorldName: "Altis", Date: "2024-03-01", Side: "EAST", Role: "Medic", Group: "Bravo 1-1", Kills: 2, Deaths: 1, Minutes: 10,
+			notableKills: []NotableKill{{Filename: "b", Date: "2024-03-01", Frame: 3}, {Filename: "b", Date: "2024-03-01", Frame: 9}}},
+		{Filename: "c", WorldName: "Stratis", Date: "2024-03-05", Side: "WEST", Role: "Rifleman", Group: "Alpha 1-1", Minutes: 20},
+	}
+	ops := []Operation{{Filename: "b", Tag: "TvT"}}
+
+	p := newPlayerProfile(&PlayerEventSummary{Name: "Alpha"}, appearances, ops)
+	assert.Equal(t, "WEST", p.MostPlayedSide)
+	assert.Equal(t, "Medic", p.MostPlayedRole)
+	assert.Equal(t, "Alpha 1-1", p.MostPlayedGroup)
+	assert.Equal(t, []NameCount{{Name: "Altis", Operations: 2}, {Name: "Stratis", Operations: 1}}, p.FavouriteWorlds)
+	assert.Equal(t, []MonthlyActivity{
+		{Month: "2024-02", Operations: 1, Minutes: 30, Kills: 1},
+		{Month: "2024-03", Operations: 2, Minutes: 30, Kills: 2, Deaths: 1},
+	}, p.Monthly)
+
+	// Most recent first.
+	var frames []int
+	for _, k := range p.RecentKills {
+		frames = append(frames, k.Frame)
+	}
+	assert.Equal(t, []int{9, 3, 5}, frames)
+
+	// Appearances link to their stored operation, if any.
+	require.Len(t, p.Operations, 3)
+	assert.Nil(t, p.Operations[0].Operation)
+	require.NotNil(t, p.Operations[1].Operation)
+	assert.Equal(t, "TvT", p.Operations[1].Operation.Tag)
+}
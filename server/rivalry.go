@@ -0,0 +1,284 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/labstack/echo/v4"
+)
+
+// rivalsDefaultLimit is the number of rivals returned when no limit is given.
+const rivalsDefaultLimit = 10
+
+// DuelKill is one kill of a player by another player. Filename and Frame
+// locate it in the replay.
+type DuelKill struct {
+	Filename    string  `json:"filename"`
+	WorldName   string  `json:"world_name"`
+	MissionName string  `json:"mission_name"`
+	Date        string  `json:"date"`
+	Frame       int     `json:"frame"`
+	Killer      string  `json:"killer"`
+	Victim      string  `json:"victim"`
+	Weapon      string  `json:"weapon"`
+	Distance    float64 `json:"distance"`
+}
+
+// Rival is another player seen from one player's point of view. Kills are
+// the times the player killed the rival, Deaths the times the rival killed
+// the player.
+type Rival struct {
+	Name       string `json:"name"`
+	Kills      int    `json:"kills"`
+	Deaths     int    `json:"deaths"`
+	Operations int    `json:"operations"`
+}
+
+// HeadToHeadOperation is the record between two players in one operation.
+type HeadToHeadOperation struct {
+	Filename    string `json:"filename"`
+	WorldName   string `json:"world_name"`
+	MissionName string `json:"mission_name"`
+	Date        string `json:"date"`
+	Kills       int    `json:"kills"`
+	Deaths      int    `json:"deaths"`
+}
+
+// HeadToHead is the output of the versus endpoint.
+type HeadToHead struct {
+	Player     string                `json:"player"`
+	Opponent   string                `json:"opponent"`
+	Kills      int                   `json:"kills"`
+	Deaths     int                   `json:"deaths"`
+	Operations []HeadToHeadOperation `json:"operations"`
+	Events     []DuelKill            `json:"events"`
+}
+
+// RivalFilter holds the query parameters of the victims and nemesis
+// endpoints.
+type RivalFilter struct {
+	Limit int `query:"limit"`
+}
+
+// killMatrix indexes player kills by killer and by victim. Both indexes share
+// the same slices.
+type killMatrix struct {
+	byKiller map[string]map[string][]DuelKill
+	byVictim map[string]map[string][]DuelKill
+}
+
+// newKillMatrix builds the matrix from kills, which must be sorted.
+func newKillMatrix(kills []DuelKill) *killMatrix {
+	m := &killMatrix{
+		byKiller: make(map[string]map[string][]DuelKill),
+		byVictim: make(map[string]map[string][]DuelKill),
+	}
+
+	for _, k := range kills {
+		if m.byKiller[k.Killer] == nil {
+			m.byKiller[k.Killer] = make(map[string][]DuelKill)
+		}
+		m.byKiller[k.Killer][k.Victim] = append(m.byKiller[k.Killer][k.Victim], k)
+	}
+	for killer, victims := range m.byKiller {
+		for victim, ks := range victims {
+			if m.byVictim[victim] == nil {
+				m.byVictim[victim] = make(map[string][]DuelKill)
+			}
+			m.byVictim[victim][killer] = ks
+		}
+	}
+
+	return m
+}
+
+// rivals lists everyone player killed or was killed by. byKills selects the
+// ordering: most killed first, or most killed by first.
+func (m *killMatrix) rivals(player string, byKills bool) []Rival {
+	names := make(map[string]bool)
+	for name := range m.byKiller[player] {
+		names[name] = true
+	}
+	for name := range m.byVictim[player] {
+		names[name] = true
+	}
+
+	result := make([]Rival, 0, len(names))
+	for name := range names {
+		kills := m.byKiller[player][name]
+		deaths := m.byVictim[player][name]
+
+		operations := make(map[string]bool)
+		for _, k := range kills {
+			operations[k.Filename] = true
+		}
+		for _, k := range deaths {
+			operations[k.Filename] = true
+		}
+
+		result = append(result, Rival{
+			Name:       name,
+			Kills:      len(kills),
+			Deaths:     len(deaths),
+			Operations: len(operations),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if !byKills {
+			a.Kills, a.Deaths = a.Deaths, a.Kills
+			b.Kills, b.Deaths = b.Deaths, b.Kills
+		}
+		if a.Kills != b.Kills {
+			return a.Kills > b.Kills
+		}
+		if a.Deaths != b.Deaths {
+			return a.Deaths < b.Deaths
+		}
+		return a.Name < b.Name
+	})
+
+	return result
+}
+
+// headToHead returns the record of player against opponent.
+func (m *killMatrix) headToHead(player, opponent string) HeadToHead {
+	kills := m.byKiller[player][opponent]
+	deaths := m.byVictim[player][opponent]
+
+	h := HeadToHead{
+		Player:   player,
+		Opponent: opponent,
+		Kills:    len(kills),
+		Deaths:   len(deaths),
+		Events:   make([]DuelKill, 0, len(kills)+len(deaths)),
+	}
+	h.Events = append(h.Events, kills...)
+	h.Events = append(h.Events, deaths...)
+	sortDuelKills(h.Events)
+
+	h.Operations = []HeadToHeadOperation{}
+	for _, e := range h.Events {
+		n := len(h.Operations)
+		if n == 0 || h.Operations[n-1].Filename != e.Filename {
+			h.Operations = append(h.Operations, HeadToHeadOperation{
+				Filename:    e.Filename,
+				WorldName:   e.WorldName,
+				MissionName: e.MissionName,
+				Date:        e.Date,
+			})
+			n++
+		}
+		if e.Killer == player {
+			h.Operations[n-1].Kills++
+		} else {
+			h.Operations[n-1].Deaths++
+		}
+	}
+
+	return h
+}
+
+// sortDuelKills orders kills chronologically.
+func sortDuelKills(kills []DuelKill) {
+	sort.Slice(kills, func(i, j int) bool {
+		if kills[i].Date != kills[j].Date {
+			return kills[i].Date < kills[j].Date
+		}
+		if kills[i].Filename != kills[j].Filename {
+			return kills[i].Filename < kills[j].Filename
+		}
+		return kills[i].Frame < kills[j].Frame
+	})
+}
+
+// getRivals serves the victims and nemesis endpoints.
+func (h *Handler) getRivals(c echo.Context, byKills bool) error {
+	filter := RivalFilter{}
+	if err := c.Bind(&filter); err != nil {
+		return err
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = rivalsDefaultLimit
+	}
+
+	playerName, err := url.PathUnescape(c.Param("name"))
+	if err != nil {
+		return err
+	}
+
+	player, err := h.playerCache.GetByName(playerName)
+	if err != nil {
+		return fmt.Errorf("process player events by name: %w", err)
+	}
+	if player == nil {
+		return echo.ErrNotFound
+	}
+
+	matrix, err := h.playerCache.GetKillMatrix()
+	if err != nil {
+		return fmt.Errorf("process kill matrix: %w", err)
+	}
+
+	rivals := matrix.rivals(player.Name, byKills)
+	// Only keep rivals on the side of the matrix that was asked for.
+	filtered := rivals[:0]
+	for _, r := range rivals {
+		if (byKills && r.Kills > 0) || (!byKills && r.Deaths > 0) {
+			filtered = append(filtered, r)
+		}
+	}
+	if len(filtered) > filter.Limit {
+		filtered = filtered[:filter.Limit]
+	}
+
+	return c.JSONPretty(http.StatusOK, filtered, "\t")
+}
+
+// GetPlayerVictims handles GET /api/v1/players/:name/victims
+// It returns the players most often killed by the named player.
+func (h *Handler) GetPlayerVictims(c echo.Context) error {
+	return h.getRivals(c, true)
+}
+
+// GetPlayerNemesis handles GET /api/v1/players/:name/nemesis
+// It returns the players who most often killed the named player.
+func (h *Handler) GetPlayerNemesis(c echo.Context) error {
+	return h.getRivals(c, false)
+}
+
+// GetPlayerVersus handles GET /api/v1/players/:name/versus/:other
+// It returns the head-to-head record between two players, with every kill
+// between them and the operations where they happened.
+func (h *Handler) GetPlayerVersus(c echo.Context) error {
+	playerName, err := url.PathUnescape(c.Param("name"))
+	if err != nil {
+		return err
+	}
+	otherName, err := url.PathUnescape(c.Param("other"))
+	if err != nil {
+		return err
+	}
+
+	player, err := h.playerCache.GetByName(playerName)
+	if err != nil {
+		return fmt.Errorf("process player events by name: %w", err)
+	}
+	other, err := h.playerCache.GetByName(otherName)
+	if err != nil {
+		return fmt.Errorf("process player events by name: %w", err)
+	}
+	if player == nil || other == nil {
+		return echo.ErrNotFound
+	}
+
+	matrix, err := h.playerCache.GetKillMatrix()
+	if err != nil {
+		return fmt.Errorf("process kill matrix: %w", err)
+	}
+
+	return c.JSONPretty(http.StatusOK, matrix.headToHead(player.Name, other.Name), "\t")
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDuelKills(t *testing.T) {
+	stats := processFixture(t, `{
+		"worldName": "Altis", "missionName": "Op", "endFrame": 10, "captureDelay": 1,
+		"times": [{"frameNum": 0, "systemTimeUTC": "2024-03-09T19:00:00.000"}],
+		"entities": [
+			{"type": "unit", "id": 0, "name": "Alpha", "side": "WEST", "isPlayer": 1, "startFrameNum": 0},
+			{"type": "unit", "id": 1, "name": "Bravo", "side": "WEST", "isPlayer": 1, "startFrameNum": 0},
+			{"type": "unit", "id": 2, "name": "Charlie", "side": "EAST", "isPlayer": 1, "startFrameNum": 0},
+			{"type": "unit", "id": 3, "name": "Rifleman", "side": "EAST", "isPlayer": 0, "startFrameNum": 0}
+		],
+		"events": [
+			[1, "killed", 2, [0, "MX"], 50],
+			[2, "killed", 1, [0, "MX"], 5],
+			[3, "killed", 0, [3, "AK-12"], 20],
+			[4, "killed", 3, [2, "AK-12"], 5],
+			[5, "killed", 2, [2, "Grenade"], 0]
+		]
+	}`)
+
+	// Only kills of players by other players, team kills included.
+	assert.Equal(t, []DuelKill{
+		{Filename: "op", WorldName: "Altis", MissionName: "Op", Date: "2024-03-09", Frame: 1, Killer: "Alpha", Victim: "Charlie", Weapon: "MX", Distance: 50},
+		{Filename: "op", WorldName: "Altis", MissionName: "Op", Date: "2024-03-09", Frame: 2, Killer: "Alpha", Victim: "Bravo", Weapon: "MX", Distance: 5},
+	}, stats.Duels)
+}
+
+func TestKillMatrix(t *testing.T) {
+	kills := []DuelKill{
+		{Filename: "a", Date: "2024-01-01", Frame: 5, Killer: "Alpha", Victim: "Bravo"},
+		{Filename: "a", Date: "2024-01-01", Frame: 9, Killer: "Bravo", Victim: "Alpha"},
+		{Filename: "b", Date: "2024-02-01", Frame: 3, Killer: "Alpha", Victim: "Bravo"},
+		{Filename: "b", Date: "2024-02-01", Frame: 4, Killer: "Alpha", Victim: "Charlie"},
+		{Filename: "b", Date: "2024-02-01", Frame: 7, Killer: "Charlie", Victim: "Alpha"},
+		{Filename: "b", Date: "2024-02-01", Frame: 8, Killer: "Charlie", Victim: "Alpha"},
+	}
+	m := newKillMatrix(kills)
+
+	assert.Equal(t, []Rival{
+		{Name: "Bravo", Kills: 2, Deaths: 1, Operations: 2},
+		{Name: "Charlie", Kills: 1, Deaths: 2, Operations: 1},
+	}, m.rivals("Alpha", true))
+	assert.Equal(t, "Charlie", m.rivals("Alpha", false)[0].Name)
+
+	h := m.headToHead("Alpha", "Bravo")
+	assert.Equal(t, 2, h.Kills)
+	assert.Equal(t, 1, h.Deaths)
+	assert.Equal(t, []HeadToHeadOperation{
+		{Filename: "a", Date: "2024-01-01", Kills: 1, Deaths: 1},
+		{Filename: "b", Date: "2024-02-01", Kills: 1},
+	}, h.Operations)
+	require.Len(t, h.Events, 3)
+	assert.Equal(t, 9, h.Events[1].Frame)
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RoleRecord holds how often a role was played and how it went. Operations
+// counts the captures the role was played in, and Survived those in which the
+// unit was alive at the end. Players is only set when aggregating over
+// players.
+type RoleRecord struct {
+	Role          string  `json:"role"`
+	Players       int     `json:"players,omitempty"`
+	Operations    int     `json:"operations"`
+	Kills         int     `json:"kills"`
+	Deaths        int     `json:"deaths"`
+	Survived      int     `json:"survived"`
+	AverageKills  float64 `json:"average_kills"`
+	AverageDeaths float64 `json:"average_deaths"`
+	SurvivalRate  float64 `json:"survival_rate"`
+}
+
+// roleName strips the "@group" suffix that some missions append to a unit's
+// role description.
+func roleName(role string) string {
+	if i := strings.IndexByte(role, '@'); i != -1 {
+		role = role[:i]
+	}
+	return strings.TrimSpace(role)
+}
+
+// applyRoleRates fills in the per-operation averages of r.
+func applyRoleRates(r *RoleRecord) {
+	r.AverageKills = ratio(r.Kills, r.Operations)
+	r.AverageDeaths = ratio(r.Deaths, r.Operations)
+	r.SurvivalRate = ratio(r.Survived, r.Operations)
+}
+
+// sortRoles orders roles by operations played, then name.
+func sortRoles(roles []RoleRecord) {
+	sort.Slice(roles, func(i, j int) bool {
+		if roles[i].Operations != roles[j].Operations {
+			return roles[i].Operations > roles[j].Operations
+		}
+		return roles[i].Role < roles[j].Role
+	})
+}
+
+// captureRoles returns the role record of a player's unit in one capture.
+// survived reports whether the unit was alive at the end of the mission.
+func captureRoles(p *PlayerEventSummary, survived bool) []RoleRecord {
+	if p.Role == "" {
+		return []RoleRecord{}
+	}
+
+	r := RoleRecord{
+		Role:       p.Role,
+		Operations: 1,
+		Kills:      p.KillCount,
+		Deaths:     p.DeathCount,
+	}
+	if survived {
+		r.Survived = 1
+	}
+	applyRoleRates(&r)
+
+	return []RoleRecord{r}
+}
+
+// roleAcc accumulates one role of a player across captures. A player may use
+// several units with the same role in one capture, which still counts as a
+// single operation; they survived it if any of those units did.
+type roleAcc struct {
+	RoleRecord
+	survived map[string]bool // capture filename -> survived
+}
+
+// addRoles folds the role records of one capture into roles.
+func addRoles(roles map[string]*roleAcc, records []RoleRecord, filename string) {
+	for _, r := range records {
+		acc, ok := roles[r.Role]
+		if !ok {
+			acc = &roleAcc{
+				RoleRecord: RoleRecord{Role: r.Role},
+				survived:   make(map[string]bool),
+			}
+			roles[r.Role] = acc
+		}
+		acc.Kills += r.Kills
+		acc.Deaths += r.Deaths
+		acc.survived[filename] = acc.survived[filename] || r.Survived > 0
+	}
+}
+
+// roleSlice converts accumulated roles into a sorted slice with their rates.
+func roleSlice(roles map[string]*roleAcc) []RoleRecord {
+	result := make([]RoleRecord, 0, len(roles))
+	for _, acc := range roles {
+		acc.Operations = len(acc.survived)
+		acc.Survived = 0
+		for _, survived := range acc.survived {
+			if survived {
+				acc.Survived++
+			}
+		}
+		applyRoleRates(&acc.RoleRecord)
+		result = append(result, acc.RoleRecord)
+	}
+	sortRoles(result)
+	return result
+}
+
+// aggregateRoles merges the role records of every player into one record
+// per role.
+func aggregateRoles(players []PlayerEventSummary) []RoleRecord {
+	roles := make(map[string]*RoleRecord)
+	for i := range players {
+		for _, r := range players[i].Roles {
+			acc, ok := roles[r.Role]
+			if !ok {
+				acc = &RoleRecord{Role: r.Role}
+				roles[r.Role] = acc
+			}
+			acc.Players++
+			acc.Operations += r.Operations
+			acc.Kills += r.Kills
+			acc.Deaths += r.Deaths
+			acc.Survived += r.Survived
+		}
+	}
+
+	result := make([]RoleRecord, 0, len(roles))
+	for _, r := range roles {
+		applyRoleRates(r)
+		result = append(result, *r)
+	}
+	sortRoles(result)
+	return result
+}
+
+// GetRoleStats handles GET /api/v1/roles
+// It returns the performance of players in each role across all captures.
+func (h *Handler) GetRoleStats(c echo.Context) error {
+	players, err := h.playerCache.GetAll()
+	if err != nil {
+		return fmt.Errorf("process all player events: %w", err)
+	}
+
+	return c.JSONPretty(http.StatusOK, aggregateRoles(players), "\t")
+}
+
+// GetCaptureRoleStats handles GET /api/v1/captures/:name/roles
+// It returns the performance of players in each role in a single capture.
+func (h *Handler) GetCaptureRoleStats(c echo.Context) error {
+	path, err := h.capturePath(c)
+	if err != nil {
+		return err
+	}
+
+	stats, err := processCapture(path)
+	if err != nil {
+		return fmt.Errorf("process player events: %w", err)
+	}
+
+	return c.JSONPretty(http.StatusOK, aggregateRoles(stats.Players), "\t")
+}
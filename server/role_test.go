@@ -0,0 +1,67 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleStats(t *testing.T) {
+	stats := processFixture(t, `{
+		"worldName": "Altis", "missionName": "Op", "endFrame": 10, "captureDelay": 1,
+		"entities": [
+			{"type": "unit", "id": 0, "name": "Alpha", "side": "WEST", "role": "Medic@Alpha 1-1", "isPlayer": 1, "startFrameNum": 0,
+				"positions": [[[0, 0], 0, 1, 0, "Alpha", 1]]},
+			{"type": "unit", "id": 1, "name": "Bravo", "side": "EAST", "role": "Rifleman", "isPlayer": 1, "startFrameNum": 0,
+				"positions": [[[0, 0], 0, 1, 0, "Bravo", 1], [[0, 0], 0, 0, 0, "Bravo", 1]]},
+			{"type": "unit", "id": 2, "name": "Charlie", "side": "EAST", "role": "", "isPlayer": 1, "startFrameNum": 0},
+			{"type": "unit", "id": 3, "name": "Delta", "side": "EAST", "role": " Rifleman ", "isPlayer": 1, "startFrameNum": 0}
+		],
+		"events": [
+			[1, "killed", 1, [0, "MX"], 10]
+		]
+	}`)
+
+	// The group suffix is not part of the role.
+	alpha := playerByName(stats.Players, "Alpha")
+	require.NotNil(t, alpha)
+	assert.Equal(t, "Medic", alpha.Role)
+	assert.Equal(t, []RoleRecord{
+		{Role: "Medic", Operations: 1, Kills: 1, Survived: 1, AverageKills: 1, SurvivalRate: 1},
+	}, alpha.Roles)
+
+	// Dead in the last position.
+	bravo := playerByName(stats.Players, "Bravo")
+	require.NotNil(t, bravo)
+	assert.Equal(t, []RoleRecord{
+		{Role: "Rifleman", Operations: 1, Deaths: 1, AverageDeaths: 1},
+	}, bravo.Roles)
+
+	assert.Empty(t, playerByName(stats.Players, "Charlie").Roles)
+
+	// Without positions, a unit that was never killed survived.
+	delta := playerByName(stats.Players, "Delta")
+	require.NotNil(t, delta)
+	assert.Equal(t, []RoleRecord{
+		{Role: "Rifleman", Operations: 1, Survived: 1, SurvivalRate: 1},
+	}, delta.Roles)
+
+	assert.Equal(t, []RoleRecord{
+		{Role: "Rifleman", Players: 2, Operations: 2, Deaths: 1, Survived: 1, AverageDeaths: 0.5, SurvivalRate: 0.5},
+		{Role: "Medic", Players: 1, Operations: 1, Kills: 1, Survived: 1, AverageKills: 1, SurvivalRate: 1},
+	}, aggregateRoles(stats.Players))
+}
+
+func TestAddRoles(t *testing.T) {
+	roles := make(map[string]*roleAcc)
+	// Two units with the same role in one capture are one operation,
+	// survived if either unit survived.
+	addRoles(roles, []RoleRecord{{Role: "Medic", Kills: 1, Deaths: 1}}, "a")
+	addRoles(roles, []RoleRecord{{Role: "Medic", Kills: 2, Survived: 1}}, "a")
+	addRoles(roles, []RoleRecord{{Role: "Medic", Deaths: 1}}, "b")
+
+	assert.Equal(t, []RoleRecord{
+		{Role: "Medic", Operations: 2, Kills: 3, Deaths: 2, Survived: 1, AverageKills: 1.5, AverageDeaths: 1, SurvivalRate: 0.5},
+	}, roleSlice(roles))
+}
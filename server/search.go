@@ -0,0 +1,202 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	searchDefaultLimit = 20
+	searchMaxLimit     = 100
+)
+
+// Match types, from best to worst.
+const (
+	matchExact = iota
+	matchPrefix
+	matchSubstring
+	matchFuzzy
+)
+
+var matchTypeNames = [...]string{"exact", "prefix", "substring", "fuzzy"}
+
+// PlayerSearchFilter holds the query parameters of the search endpoint.
+type PlayerSearchFilter struct {
+	Query  string `query:"q"`
+	Limit  int    `query:"limit"`
+	Offset int    `query:"offset"`
+}
+
+// PlayerSearchResult is one candidate returned by the search endpoint.
+// Distance is the edit distance of a fuzzy match and zero otherwise.
+type PlayerSearchResult struct {
+	Name               string `json:"name"`
+	Match              string `json:"match"`
+	Distance           int    `json:"distance"`
+	KillCount          int    `json:"kill_count"`
+	DeathCount         int    `json:"death_count"`
+	OperationsAttended int    `json:"operations_attended"`
+	LastSeen           string `json:"last_seen"`
+
+	match int
+}
+
+// PlayerSearchPage is the output of the search endpoint.
+type PlayerSearchPage struct {
+	Query   string               `json:"query"`
+	Total   int                  `json:"total"`
+	Limit   int                  `json:"limit"`
+	Offset  int                  `json:"offset"`
+	Results []PlayerSearchResult `json:"results"`
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// levenshtein returns the edit distance between a and b in runes.
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+// maxEdits is the largest edit distance accepted for a fuzzy match, so that
+// short queries do not match every short name.
+func maxEdits(query []rune) int {
+	return minInt(len(query)/4+1, 3)
+}
+
+// matchName classifies how name matches query, both lowercased. It reports
+// false when they do not match at all.
+func matchName(name, query string) (match, distance int, ok bool) {
+	switch {
+	case name == query:
+		return matchExact, 0, true
+	case strings.HasPrefix(name, query):
+		return matchPrefix, 0, true
+	case strings.Contains(name, query):
+		return matchSubstring, 0, true
+	}
+
+	// Compare against the whole name and each of its words, so that a
+	// misspelt clan tag or first name still finds the player.
+	q := []rune(query)
+	best := levenshtein([]rune(name), q)
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		best = minInt(best, levenshtein([]rune(w), q))
+	}
+
+	if best > maxEdits(q) {
+		return 0, 0, false
+	}
+	return matchFuzzy, best, true
+}
+
+// rankPlayers returns the players matching query, best match first. Ties are
+// broken by operations attended and then by name so results are stable.
+func rankPlayers(players []PlayerEventSummary, query string) []PlayerSearchResult {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return []PlayerSearchResult{}
+	}
+
+	results := []PlayerSearchResult{}
+	for i := range players {
+		p := &players[i]
+		match, distance, ok := matchName(strings.ToLower(p.Name), query)
+		if !ok {
+			continue
+		}
+		results = append(results, PlayerSearchResult{
+			Name:               p.Name,
+			Match:              matchTypeNames[match],
+			Distance:           distance,
+			KillCount:          p.KillCount,
+			DeathCount:         p.DeathCount,
+			OperationsAttended: p.OperationsAttended,
+			LastSeen:           p.LastSeen,
+			match:              match,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		a, b := &results[i], &results[j]
+		if a.match != b.match {
+			return a.match < b.match
+		}
+		if a.Distance != b.Distance {
+			return a.Distance < b.Distance
+		}
+		if a.OperationsAttended != b.OperationsAttended {
+			return a.OperationsAttended > b.OperationsAttended
+		}
+		return a.Name < b.Name
+	})
+
+	return results
+}
+
+// GetPlayerSearch handles GET /api/v1/players/search?q=&limit=&offset=
+// It returns a ranked, paginated list of players whose name matches the
+// query exactly, by prefix, as a substring or within a small edit distance.
+func (h *Handler) GetPlayerSearch(c echo.Context) error {
+	filter := PlayerSearchFilter{}
+	if err := c.Bind(&filter); err != nil {
+		return err
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = searchDefaultLimit
+	}
+	if filter.Limit > searchMaxLimit {
+		filter.Limit = searchMaxLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	results, err := h.playerCache.Search(filter.Query)
+	if err != nil {
+		return fmt.Errorf("search players: %w", err)
+	}
+
+	page := PlayerSearchPage{
+		Query:  filter.Query,
+		Total:  len(results),
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	}
+	start := minInt(filter.Offset, len(results))
+	end := minInt(start+filter.Limit, len(results))
+	page.Results = results[start:end]
+
+	return c.JSONPretty(http.StatusOK, page, "\t")
+}
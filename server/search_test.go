@@ -0,0 +1,31 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRankPlayers(t *testing.T) {
+	players := []PlayerEventSummary{
+		{Name: "John", OperationsAttended: 1},
+		{Name: "Jonas", OperationsAttended: 5},
+		{Name: "Jo", OperationsAttended: 2},
+		{Name: "[TAG] Bojo", OperationsAttended: 9},
+		{Name: "Jonny", OperationsAttended: 5},
+		{Name: "Mike"},
+	}
+
+	var names []string
+	for _, r := range rankPlayers(players, "JO") {
+		names = append(names, r.Name)
+	}
+	assert.Equal(t, []string{"Jo", "Jonas", "Jonny", "John", "[TAG] Bojo"}, names)
+
+	results := rankPlayers(players, "johm")
+	require.NotEmpty(t, results)
+	assert.Equal(t, "John", results[0].Name)
+	assert.Equal(t, "fuzzy", results[0].Match)
+	assert.Equal(t, 1, results[0].Distance)
+}
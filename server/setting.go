@@ -20,6 +20,7 @@ type Setting struct {
 	Logger             bool      `json:"logger" yaml:"logger"`
 	Customize          Customize `json:"customize" yaml:"customize"`
 	OperationTypeBlacklist []string `json:"operationTypeBlacklist" yaml:"operationTypeBlacklist"`
+	ValidateUploads bool `json:"validateUploads" yaml:"validateUploads"`
 }
 
 type Customize struct {
@@ -52,10 +53,11 @@ func NewSetting() (setting Setting, err error) {
 	viper.SetDefault("data", "data")
 	viper.SetDefault("static", "static")
 	viper.SetDefault("logger", false)
+	viper.SetDefault("validateUploads", false)
 	viper.SetDefault("customize.websiteLogoSize", "32px")
 
 	// workaround for https://github.com/spf13/viper/issues/761
-	envKeys := []string{"listen", "prefixURL", "secret", "db", "markers", "ammo", "maps", "data", "static", "customize.websiteurl", "customize.websitelogo", "customize.websitelogosize", "customize.disableKillCount"}
+	envKeys := []string{"listen", "prefixURL", "secret", "db", "markers", "ammo", "maps", "data", "static", "customize.websiteurl", "customize.websitelogo", "customize.websitelogosize", "customize.disableKillCount", "validateUploads"}
 	for _, key := range envKeys {
 		env := strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
 		if err = viper.BindEnv(key, env); err != nil {
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/OCAP2/web/capture"
+	"github.com/labstack/echo/v4"
+)
+
+// SideSummary counts the units of one side in a capture and the kills they
+// scored and suffered.
+type SideSummary struct {
+	Side    string `json:"side"`
+	Units   int    `json:"units"`
+	Players int    `json:"players"`
+	AI      int    `json:"ai"`
+	Kills   int    `json:"kills"`
+	Deaths  int    `json:"deaths"`
+}
+
+// CasualtyMinute counts the units killed during one minute of the mission.
+type CasualtyMinute struct {
+	Minute     int            `json:"minute"`
+	Casualties int            `json:"casualties"`
+	Sides      map[string]int `json:"sides"`
+}
+
+// CaptureSummary is the output of the capture summary endpoint. Real times
+// come from systemTimeUTC and in-game times from the date of the first and
+// last "times" entries; they are empty when the capture has none.
+type CaptureSummary struct {
+	Filename     string           `json:"filename"`
+	WorldName    string           `json:"world_name"`
+	MissionName  string           `json:"mission_name"`
+	EndFrame     int              `json:"end_frame"`
+	CaptureDelay float64          `json:"capture_delay"`
+	Duration     float64          `json:"duration"` // seconds
+	RealStart    string           `json:"real_start"`
+	RealEnd      string           `json:"real_end"`
+	GameStart    string           `json:"game_start"`
+	GameEnd      string           `json:"game_end"`
+	Units        int              `json:"units"`
+	Players      int              `json:"players"`
+	AI           int              `json:"ai"`
+	Vehicles     int              `json:"vehicles"`
+	Markers      int              `json:"markers"`
+	Sides        []SideSummary    `json:"sides"`
+	EndMission   *EndMission      `json:"end_mission"`
+	Casualties   []CasualtyMinute `json:"casualties"`
+}
+
+// summaryTally accumulates the parts of a capture summary that are found
+// while streaming entities and events.
+type summaryTally struct {
+	sides     map[string]*SideSummary
+	vehicles  int
+	markers   int
+	deaths    []unitDeath
+	firstTime capture.Time
+	lastTime  capture.Time
+}
+
+// unitDeath is a unit killed at a frame. The minute is only worked out in
+// buildSummary, since captureDelay may follow the events in the file.
+type unitDeath struct {
+	frame int
+	side  string
+}
+
+func newSummaryTally() *summaryTally {
+	return &summaryTally{
+		sides: make(map[string]*SideSummary),
+	}
+}
+
+func (t *summaryTally) side(name string) *SideSummary {
+	s, ok := t.sides[name]
+	if !ok {
+		s = &SideSummary{Side: name}
+		t.sides[name] = s
+	}
+	return s
+}
+
+// addEntity counts a unit or vehicle entity.
+func (t *summaryTally) addEntity(e capture.Entity) {
+	switch e.Type {
+	case "unit":
+		s := t.side(e.Side)
+		s.Units++
+		if e.IsPlayer == 1 {
+			s.Players++
+		} else {
+			s.AI++
+		}
+	case "vehicle":
+		t.vehicles++
+	}
+}
+
+// onSummaryKill counts a killed event for the capture summary.
+func (cp *captureParser) onSummaryKill(ev hitKilledEvent, killerMeta, victimMeta capture.Entity, killerKnown bool) {
+	t := cp.summary
+
+	if killerKnown && killerMeta.Type == "unit" && ev.CausedByID != ev.VictimID {
+		t.side(killerMeta.Side).Kills++
+	}
+
+	if victimMeta.Type != "unit" {
+		return
+	}
+	t.side(victimMeta.Side).Deaths++
+	t.deaths = append(t.deaths, unitDeath{frame: ev.Frame, side: victimMeta.Side})
+}
+
+// buildSummary builds the capture summary once the whole capture has been
+// read.
+func (cp *captureParser) buildSummary() *CaptureSummary {
+	t := cp.summary
+	stats := cp.stats
+
+	s := &CaptureSummary{
+		Filename:     stats.Filename,
+		WorldName:    stats.WorldName,
+		MissionName:  stats.MissionName,
+		EndFrame:     stats.EndFrame,
+		CaptureDelay: stats.CaptureDelay,
+		Duration:     float64(stats.EndFrame) * stats.CaptureDelay,
+		RealStart:    t.firstTime.SystemTimeUTC,
+		RealEnd:      t.lastTime.SystemTimeUTC,
+		GameStart:    t.firstTime.Date,
+		GameEnd:      t.lastTime.Date,
+		Vehicles:     t.vehicles,
+		Markers:      t.markers,
+		Sides:        make([]SideSummary, 0, len(t.sides)),
+		EndMission:   stats.EndMission,
+	}
+
+	for _, side := range t.sides {
+		s.Units += side.Units
+		s.Players += side.Players
+		s.AI += side.AI
+		s.Sides = append(s.Sides, *side)
+	}
+	sort.Slice(s.Sides, func(i, j int) bool {
+		return s.Sides[i].Side < s.Sides[j].Side
+	})
+
+	minutes := make(map[int]*CasualtyMinute)
+	for _, d := range t.deaths {
+		minute := int(float64(d.frame) * stats.CaptureDelay / 60)
+		m, ok := minutes[minute]
+		if !ok {
+			m = &CasualtyMinute{Minute: minute, Sides: make(map[string]int)}
+			minutes[minute] = m
+		}
+		m.Casualties++
+		m.Sides[d.side]++
+	}
+	s.Casualties = make([]CasualtyMinute, 0, len(minutes))
+	for _, m := range minutes {
+		s.Casualties = append(s.Casualties, *m)
+	}
+	sort.Slice(s.Casualties, func(i, j int) bool {
+		return s.Casualties[i].Minute < s.Casualties[j].Minute
+	})
+
+	return s
+}
+
+// GetCaptureSummary handles GET /api/v1/captures/:name/summary
+// It returns the basic facts of a capture without the client having to
+// download it: world, mission, duration, times, unit counts, kills and
+// casualties per side, and how the mission ended.
+func (h *Handler) GetCaptureSummary(c echo.Context) error {
+	path, err := h.capturePath(c)
+	if err != nil {
+		return err
+	}
+
+	stats, err := processCapture(path)
+	if err != nil {
+		return fmt.Errorf("process capture summary: %w", err)
+	}
+
+	return c.JSONPretty(http.StatusOK, stats.Summary, "\t")
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureSummary(t *testing.T) {
+	// captureDelay follows the events, so minutes can only be worked out at
+	// the end.
+	stats := processFixture(t, `{
+		"worldName": "Altis", "missionName": "Op", "endFrame": 60,
+		"entities": [
+			{"type": "unit", "id": 0, "name": "Alpha", "side": "WEST", "isPlayer": 1, "startFrameNum": 0},
+			{"type": "unit", "id": 1, "name": "Bravo", "side": "EAST", "isPlayer": 1, "startFrameNum": 0},
+			{"type": "unit", "id": 2, "name": "Rifleman", "side": "EAST", "isPlayer": 0, "startFrameNum": 0},
+			{"type": "vehicle", "id": 3, "name": "Hunter", "class": "car", "startFrameNum": 0}
+		],
+		"events": [
+			[10, "killed", 2, [0, "MX"], 10],
+			[29, "killed", 1, [0, "MX"], 10],
+			[30, "killed", 0, [0, "Grenade"], 0],
+			[40, "killed", 3, [1, "RPG-7"], 50],
+			[50, "killed", 1, [3, "HMG"], 50],
+			[55, "endMission", ["EAST", "East wins"]]
+		],
+		"Markers": [["mil_dot", "Objective", 0, 60, -1, "ColorRed", -1, [[0, [10, 10], 0, 1]]]],
+		"times": [
+			{"frameNum": 0, "systemTimeUTC": "2024-03-09T19:00:00.000", "date": "2035-06-01T05:00:00", "timeMultiplier": 1, "time": 0},
+			{"frameNum": 60, "systemTimeUTC": "2024-03-09T19:02:00.000", "date": "2035-06-01T05:02:00", "timeMultiplier": 1, "time": 120}
+		],
+		"captureDelay": 2
+	}`)
+
+	// Suicides are deaths but not kills, destroyed vehicles are neither, and
+	// kills by vehicles count for no side.
+	assert.Equal(t, &CaptureSummary{
+		Filename:     "op",
+		WorldName:    "Altis",
+		MissionName:  "Op",
+		EndFrame:     60,
+		CaptureDelay: 2,
+		Duration:     120,
+		RealStart:    "2024-03-09T19:00:00.000",
+		RealEnd:      "2024-03-09T19:02:00.000",
+		GameStart:    "2035-06-01T05:00:00",
+		GameEnd:      "2035-06-01T05:02:00",
+		Units:        3,
+		Players:      2,
+		AI:           1,
+		Vehicles:     1,
+		Markers:      1,
+		Sides: []SideSummary{
+			{Side: "EAST", Units: 2, Players: 1, AI: 1, Kills: 1, Deaths: 3},
+			{Side: "WEST", Units: 1, Players: 1, Kills: 2, Deaths: 1},
+		},
+		EndMission: &EndMission{Side: "EAST", Message: "East wins"},
+		Casualties: []CasualtyMinute{
+			{Minute: 0, Casualties: 2, Sides: map[string]int{"EAST": 2}},
+			{Minute: 1, Casualties: 2, Sides: map[string]int{"EAST": 1, "WEST": 1}},
+		},
+	}, stats.Summary)
+}
+
+func TestCaptureSummaryEmpty(t *testing.T) {
+	stats := processFixture(t, `{"worldName": "Altis", "missionName": "Op", "endFrame": 10, "captureDelay": 1}`)
+
+	// Without times, the times stay empty.
+	assert.Equal(t, &CaptureSummary{
+		Filename:     "op",
+		WorldName:    "Altis",
+		MissionName:  "Op",
+		EndFrame:     10,
+		CaptureDelay: 1,
+		Duration:     10,
+		Sides:        []SideSummary{},
+		Casualties:   []CasualtyMinute{},
+	}, stats.Summary)
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TeamKillIncident is one kill, or hit, of a player by a player of the same
+// side. Time is the number of seconds into the mission; Filename and Frame
+// locate the incident in the replay.
+type TeamKillIncident struct {
+	Filename    string  `json:"filename"`
+	WorldName   string  `json:"world_name"`
+	MissionName string  `json:"mission_name"`
+	Date        string  `json:"date"`
+	Tag         string  `json:"tag"`
+	Type        string  `json:"type"` // killed or hit
+	Frame       int     `json:"frame"`
+	Time        float64 `json:"time"`
+	Killer      string  `json:"killer"`
+	Victim      string  `json:"victim"`
+	Side        string  `json:"side"`
+	Weapon      string  `json:"weapon"`
+	Distance    float64 `json:"distance"`
+}
+
+// TeamKillOffender summarises the incidents caused by one player.
+type TeamKillOffender struct {
+	Name         string `json:"name"`
+	TeamKills    int    `json:"team_kills"`
+	FriendlyHits int    `json:"friendly_hits"`
+	Victims      int    `json:"victims"`
+	Operations   int    `json:"operations"`
+}
+
+// TeamKillReport is the output of the team kill endpoint.
+type TeamKillReport struct {
+	Offenders []TeamKillOffender `json:"offenders"`
+	Incidents []TeamKillIncident `json:"incidents"`
+}
+
+// TeamKillFilter holds the query parameters of the team kill endpoint.
+// Player matches the killer or the victim by case-insensitive substring.
+// Sort is "date" (newest first, the default) or "frequency", which lists the
+// incidents of the most frequent offenders first.
+type TeamKillFilter struct {
+	Player string `query:"player"`
+	Older  string `query:"older"`
+	Newer  string `query:"newer"`
+	Tag    string `query:"tag"`
+	Hits   bool   `query:"hits"`
+	Sort   string `query:"sort"`
+}
+
+// onFriendlyFire records a team kill or friendly hit between two players.
+// Capture-level fields are filled in by finish.
+func (cp *captureParser) onFriendlyFire(ev hitKilledEvent, killer, victim *playerAcc) {
+	cp.stats.TeamKills = append(cp.stats.TeamKills, TeamKillIncident{
+		Type:     ev.Type,
+		Frame:    ev.Frame,
+		Killer:   killer.Name,
+		Victim:   victim.Name,
+		Side:     killer.Side,
+		Weapon:   ev.Weapon,
+		Distance: ev.Distance,
+	})
+}
+
+// match reports whether incident passes f. Dates are compared as YYYY-MM-DD
+// strings, like the operation filter.
+func (f *TeamKillFilter) match(incident *TeamKillIncident) bool {
+	if incident.Type == "hit" && !f.Hits {
+		return false
+	}
+	if f.Older != "" && incident.Date > f.Older {
+		return false
+	}
+	if f.Newer != "" && incident.Date < f.Newer {
+		return false
+	}
+	if f.Tag != "" && !strings.EqualFold(incident.Tag, f.Tag) {
+		return false
+	}
+	if f.Player != "" {
+		player := strings.ToLower(f.Player)
+		if !strings.Contains(strings.ToLower(incident.Killer), player) &&
+			!strings.Contains(strings.ToLower(incident.Victim), player) {
+			return false
+		}
+	}
+	return true
+}
+
+// teamKillOffenders summarises incidents per killer, most team kills first.
+func teamKillOffenders(incidents []TeamKillIncident) []TeamKillOffender {
+	type offenderAcc struct {
+		TeamKillOffender
+		victims    map[string]bool
+		operations map[string]bool
+	}
+	offenders := make(map[string]*offenderAcc)
+
+	for i := range incidents {
+		inc := &incidents[i]
+		o, ok := offenders[inc.Killer]
+		if !ok {
+			o = &offenderAcc{
+				TeamKillOffender: TeamKillOffender{Name: inc.Killer},
+				victims:          make(map[string]bool),
+				operations:       make(map[string]bool),
+			}
+			offenders[inc.Killer] = o
+		}
+		if inc.Type == "killed" {
+			o.TeamKills++
+		} else {
+			o.FriendlyHits++
+		}
+		o.victims[inc.Victim] = true
+		o.operations[inc.Filename] = true
+	}
+
+	result := make([]TeamKillOffender, 0, len(offenders))
+	for _, o := range offenders {
+		o.Victims = len(o.victims)
+		o.Operations = len(o.operations)
+		result = append(result, o.TeamKillOffender)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].TeamKills != result[j].TeamKills {
+			return result[i].TeamKills > result[j].TeamKills
+		}
+		if result[i].FriendlyHits != result[j].FriendlyHits {
+			return result[i].FriendlyHits > result[j].FriendlyHits
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// newTeamKillReport filters incidents and sorts them as f asks. incidents is
+// not modified.
+func newTeamKillReport(incidents []TeamKillIncident, f TeamKillFilter) TeamKillReport {
+	filtered := []TeamKillIncident{}
+	for i := range incidents {
+		if f.match(&incidents[i]) {
+			filtered = append(filtered, incidents[i])
+		}
+	}
+
+	offenders := teamKillOffenders(filtered)
+
+	newestFirst := func(a, b *TeamKillIncident) bool {
+		if a.Date != b.Date {
+			return a.Date > b.Date
+		}
+		if a.Filename != b.Filename {
+			return a.Filename > b.Filename
+		}
+		return a.Frame > b.Frame
+	}
+
+	if f.Sort == "frequency" {
+		rank := make(map[string]int, len(offenders))
+		for i, o := range offenders {
+			rank[o.Name] = i
+		}
+		sort.SliceStable(filtered, func(i, j int) bool {
+			a, b := &filtered[i], &filtered[j]
+			if rank[a.Killer] != rank[b.Killer] {
+				return rank[a.Killer] < rank[b.Killer]
+			}
+			return newestFirst(a, b)
+		})
+	} else {
+		sort.SliceStable(filtered, func(i, j int) bool {
+			return newestFirst(&filtered[i], &filtered[j])
+		})
+	}
+
+	return TeamKillReport{Offenders: offenders, Incidents: filtered}
+}
+
+// GetTeamKills handles GET /api/v1/teamkills
+// It lists friendly-fire kills between players, and optionally friendly hits,
+// together with a summary of the offenders.
+func (h *Handler) GetTeamKills(c echo.Context) error {
+	var (
+		ctx    = c.Request().Context()
+		filter = TeamKillFilter{}
+	)
+
+	if err := c.Bind(&filter); err != nil {
+		return err
+	}
+
+	cached, err := h.playerCache.GetTeamKills()
+	if err != nil {
+		return fmt.Errorf("process team kills: %w", err)
+	}
+
+	// Tags only live in the database; copy before filling them in, as the
+	// cached incidents are shared between requests.
+	incidents := append([]TeamKillIncident(nil), cached...)
+
+	seen := make(map[string]bool)
+	filenames := []string{}
+	for _, inc := range incidents {
+		if !seen[inc.Filename] {
+			seen[inc.Filename] = true
+			filenames = append(filenames, inc.Filename)
+		}
+	}
+	ops, err := h.repoOperation.SelectByFilenames(ctx, filenames)
+	if err != nil {
+		return fmt.Errorf("select operations: %w", err)
+	}
+	tags := make(map[string]string, len(ops))
+	for _, op := range ops {
+		tags[op.Filename] = op.Tag
+	}
+	for i := range incidents {
+		incidents[i].Tag = tags[incidents[i].Filename]
+	}
+
+	return c.JSONPretty(http.StatusOK, newTeamKillReport(incidents, filter), "\t")
+}
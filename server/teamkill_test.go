@@ -0,0 +1,53 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTeamKillIncidents(t *testing.T) {
+	stats := processFixture(t, `{
+		"worldName": "Altis", "missionName": "Op", "endFrame": 10, "captureDelay": 2,
+		"times": [{"frameNum": 0, "systemTimeUTC": "2024-03-09T19:00:00.000"}],
+		"entities": [
+			{"type": "unit", "id": 0, "name": "Alpha", "side": "WEST", "isPlayer": 1, "startFrameNum": 0},
+			{"type": "unit", "id": 1, "name": "Bravo", "side": "WEST", "isPlayer": 1, "startFrameNum": 0},
+			{"type": "unit", "id": 2, "name": "Charlie", "side": "EAST", "isPlayer": 1, "startFrameNum": 0},
+			{"type": "unit", "id": 3, "name": "Rifleman", "side": "WEST", "isPlayer": 0, "startFrameNum": 0}
+		],
+		"events": [
+			[3, "hit", 1, [0, "MX"], 5],
+			[4, "killed", 1, [0, "MX"], 5],
+			[5, "killed", 2, [0, "MX"], 50],
+			[6, "killed", 3, [0, "MX"], 5],
+			[7, "killed", 0, [0, "Grenade"], 0]
+		]
+	}`)
+
+	// Friendly AI and killing oneself are not incidents.
+	assert.Equal(t, []TeamKillIncident{
+		{Filename: "op", WorldName: "Altis", MissionName: "Op", Date: "2024-03-09", Type: "hit", Frame: 3, Time: 6, Killer: "Alpha", Victim: "Bravo", Side: "WEST", Weapon: "MX", Distance: 5},
+		{Filename: "op", WorldName: "Altis", MissionName: "Op", Date: "2024-03-09", Type: "killed", Frame: 4, Time: 8, Killer: "Alpha", Victim: "Bravo", Side: "WEST", Weapon: "MX", Distance: 5},
+	}, stats.TeamKills)
+}
+
+func TestTeamKillReport(t *testing.T) {
+	incidents := []TeamKillIncident{
+		{Filename: "a", Date: "2024-01-01", Tag: "TvT", Type: "killed", Frame: 1, Killer: "Alpha", Victim: "Bravo"},
+		{Filename: "b", Date: "2024-02-01", Tag: "PvE", Type: "killed", Frame: 1, Killer: "Bravo", Victim: "Alpha"},
+		{Filename: "c", Date: "2024-03-01", Tag: "TvT", Type: "killed", Frame: 1, Killer: "Alpha", Victim: "Charlie"},
+		{Filename: "c", Date: "2024-03-01", Tag: "TvT", Type: "hit", Frame: 1, Killer: "Charlie", Victim: "Alpha"},
+	}
+
+	report := newTeamKillReport(incidents, TeamKillFilter{Sort: "frequency"})
+	require.Len(t, report.Incidents, 3)
+	assert.Equal(t, "c", report.Incidents[0].Filename)
+	assert.Equal(t, "a", report.Incidents[1].Filename)
+	assert.Equal(t, TeamKillOffender{Name: "Alpha", TeamKills: 2, Victims: 2, Operations: 2}, report.Offenders[0])
+
+	report = newTeamKillReport(incidents, TeamKillFilter{Player: "charlie", Tag: "tvt", Hits: true, Newer: "2024-02-01"})
+	require.Len(t, report.Incidents, 2)
+	assert.Equal(t, "Charlie", report.Incidents[1].Killer)
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/OCAP2/web/capture"
+	"github.com/labstack/echo/v4"
+)
+
+// TrimOptions selects the frames TrimCapture keeps, inclusive, and where the
+// result goes: a new operation named Filename, or the trimmed capture itself
+// when Filename is empty.
+type TrimOptions struct {
+	From     int
+	To       int
+	Filename string
+}
+
+// TrimCapture cuts the stored capture name to a frame range. The result is
+// registered as a new operation, or replaces the capture in place, in which
+// case the original is archived.
+func TrimCapture(ctx context.Context, repo *RepoOperation, dataDir, name string, opts TrimOptions) (*Operation, error) {
+	name = filepath.Base(name)
+	if !captureExists(dataDir, name) {
+		return nil, ErrNotFound
+	}
+	op, err := storedOperation(ctx, repo, name)
+	if err != nil {
+		return nil, err
+	}
+
+	inPlace := opts.Filename == "" || opts.Filename == name
+	if !inPlace {
+		opts.Filename = filepath.Base(opts.Filename)
+		if captureExists(dataDir, opts.Filename) {
+			return nil, fmt.Errorf("capture %s: %w", opts.Filename, ErrExists)
+		}
+	}
+
+	src, err := capture.Open(filepath.Join(dataDir, name+".gz"))
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	var header *capture.Header
+	tmp, err := createCapture(dataDir, func(w io.Writer) (err error) {
+		header, err = capture.Trim(w, src, opts.From, opts.To)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("trim capture: %w", err)
+	}
+	defer os.Remove(tmp)
+
+	trimmed := *op
+	trimmed.MissionDuration = float64(header.EndFrame) * header.CaptureDelay
+
+	if inPlace {
+		archived, err := archiveCapture(dataDir, name)
+		if err != nil {
+			return nil, fmt.Errorf("archive capture: %w", err)
+		}
+		if err := os.Rename(tmp, filepath.Join(dataDir, name+".gz")); err != nil {
+			restoreCapture(dataDir, name, archived)
+			return nil, err
+		}
+		if err := repo.Update(ctx, &trimmed); err != nil {
+			restoreCapture(dataDir, name, archived)
+			return nil, fmt.Errorf("update operation: %w", err)
+		}
+		return &trimmed, nil
+	}
+
+	if err := os.Rename(tmp, filepath.Join(dataDir, opts.Filename+".gz")); err != nil {
+		return nil, err
+	}
+	trimmed.ID = 0
+	trimmed.Filename = opts.Filename
+	if err := repo.Store(ctx, &trimmed); err != nil {
+		os.Remove(filepath.Join(dataDir, opts.Filename+".gz"))
+		return nil, fmt.Errorf("store operation: %w", err)
+	}
+	return &trimmed, nil
+}
+
+// TrimOperation handles POST /api/v1/captures/:name/trim
+// It cuts a stored capture to the frames between the from and to form
+// values, inclusive. With a filename the result is stored as a new
+// operation, otherwise the capture is trimmed in place and the original
+// archived. It requires the upload secret.
+func (h *Handler) TrimOperation(c echo.Context) error {
+	if c.FormValue("secret") != h.setting.Secret {
+		return echo.ErrForbidden
+	}
+
+	name, err := url.PathUnescape(c.Param("name"))
+	if err != nil {
+		return err
+	}
+
+	opts := TrimOptions{Filename: c.FormValue("filename")}
+	if opts.From, err = strconv.Atoi(c.FormValue("from")); err != nil {
+		return echo.ErrBadRequest
+	}
+	if opts.To, err = strconv.Atoi(c.FormValue("to")); err != nil {
+		return echo.ErrBadRequest
+	}
+
+	op, err := TrimCapture(c.Request().Context(), h.repoOperation, h.setting.Data, name, opts)
+	if errors.Is(err, capture.ErrFrameRange) {
+		return echo.ErrBadRequest
+	}
+	if err != nil {
+		return err
+	}
+
+	h.playerCache.Invalidate()
+
+	return c.JSONPretty(http.StatusOK, op, "\t")
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/OCAP2/web/capture"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrimCapture(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeCapture(t, dir, "op", testCapture)
+	h := newAdminHandler(t, dir, "op")
+	repo := h.repoOperation
+
+	// As a new operation.
+	op, err := TrimCapture(ctx, repo, dir, "op", TrimOptions{From: 10, To: 59, Filename: "op_short"})
+	require.NoError(t, err)
+	assert.Equal(t, "op_short", op.Filename)
+	assert.Equal(t, 49.0, op.MissionDuration)
+	assert.FileExists(t, filepath.Join(dir, "op.gz"))
+
+	report, err := capture.ValidateFile(filepath.Join(dir, "op_short.gz"))
+	require.NoError(t, err)
+	assert.Equal(t, 49, report.Info.EndFrame)
+	assert.Equal(t, 7, report.Info.Entities)
+
+	ops, err := repo.SelectByFilenames(ctx, []string{"op", "op_short"})
+	require.NoError(t, err)
+	require.Len(t, ops, 2)
+	assert.Equal(t, "TvT", ops[1].Tag)
+
+	_, err = TrimCapture(ctx, repo, dir, "op", TrimOptions{From: 0, To: 10, Filename: "op_short"})
+	assert.ErrorIs(t, err, ErrExists)
+	_, err = TrimCapture(ctx, repo, dir, "missing", TrimOptions{From: 0, To: 10})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// In place, through the handler.
+	form := url.Values{"secret": {"secret"}, "from": {"20"}, "to": {"200"}}
+	c, rec := formContext("/api/v1/captures/op/trim", "op", form)
+	require.NoError(t, h.TrimOperation(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	report, err = capture.ValidateFile(filepath.Join(dir, "op.gz"))
+	require.NoError(t, err)
+	assert.Equal(t, 80, report.Info.EndFrame)
+	archived, err := filepath.Glob(filepath.Join(dir, archiveDir, "op.*.gz"))
+	require.NoError(t, err)
+	assert.Len(t, archived, 1)
+
+	ops, err = repo.SelectByFilenames(ctx, []string{"op"})
+	require.NoError(t, err)
+	require.Len(t, ops, 1)
+	assert.Equal(t, 80.0, ops[0].MissionDuration)
+
+	form.Set("secret", "wrong")
+	c, _ = formContext("/api/v1/captures/op/trim", "op", form)
+	assert.ErrorIs(t, h.TrimOperation(c), echo.ErrForbidden)
+}
+
+func TestTrimCaptureRestore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeCapture(t, dir, "op", testCapture)
+	repo := newAdminHandler(t, dir, "op").repoOperation
+	_, err := repo.db.Exec(`CREATE TRIGGER no_update BEFORE UPDATE ON operations BEGIN SELECT RAISE(FAIL, 'read only'); END`)
+	require.NoError(t, err)
+
+	// The original capture is back in place when the operation cannot be
+	// updated.
+	_, err = TrimCapture(ctx, repo, dir, "op", TrimOptions{From: 20, To: 200})
+	require.Error(t, err)
+	report, err := capture.ValidateFile(filepath.Join(dir, "op.gz"))
+	require.NoError(t, err)
+	assert.Equal(t, 100, report.Info.EndFrame)
+	archived, err := filepath.Glob(filepath.Join(dir, archiveDir, "*.gz"))
+	require.NoError(t, err)
+	assert.Empty(t, archived)
+}
+
+func TestArchiveCapture(t *testing.T) {
+	dir := t.TempDir()
+
+	// Archiving the same name twice within a second keeps both.
+	writeCapture(t, dir, "op", testCapture)
+	first, err := archiveCapture(dir, "op")
+	require.NoError(t, err)
+	writeCapture(t, dir, "op", `{}`)
+	second, err := archiveCapture(dir, "op")
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	assert.NoFileExists(t, filepath.Join(dir, "op.gz"))
+
+	report, err := capture.ValidateFile(first)
+	require.NoError(t, err)
+	assert.Equal(t, 100, report.Info.EndFrame)
+}
+
+func TestTrimCaptureStoreFails(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeCapture(t, dir, "op", testCapture)
+	repo := newAdminHandler(t, dir, "op").repoOperation
+	_, err := repo.db.Exec(`CREATE TRIGGER no_insert BEFORE INSERT ON operations BEGIN SELECT RAISE(FAIL, 'read only'); END`)
+	require.NoError(t, err)
+
+	// A failed trim leaves nothing behind, so that it can be retried.
+	_, err = TrimCapture(ctx, repo, dir, "op", TrimOptions{From: 10, To: 59, Filename: "op_short"})
+	require.Error(t, err)
+	assert.NoFileExists(t, filepath.Join(dir, "op_short.gz"))
+
+	_, err = repo.db.Exec(`DROP TRIGGER no_insert`)
+	require.NoError(t, err)
+	_, err = TrimCapture(ctx, repo, dir, "op", TrimOptions{From: 10, To: 59, Filename: "op_short"})
+	require.NoError(t, err)
+}
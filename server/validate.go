@@ -0,0 +1,54 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/OCAP2/web/capture"
+	"github.com/labstack/echo/v4"
+)
+
+// captureUpload returns the capture sent with a request: the "file" field of
+// a multipart form, or the request body otherwise.
+func captureUpload(c echo.Context) (io.ReadCloser, error) {
+	form, err := c.FormFile("file")
+	if err == nil {
+		return form.Open()
+	}
+	if err != http.ErrMissingFile && err != http.ErrNotMultipart {
+		return nil, err
+	}
+	if c.Request().ContentLength == 0 {
+		return nil, echo.ErrBadRequest
+	}
+	return c.Request().Body, nil
+}
+
+// validateCapture checks the capture read from r, which may be gzipped.
+func validateCapture(r io.Reader) (*capture.Report, error) {
+	dr, err := capture.Decompress(r)
+	if err != nil {
+		return nil, fmt.Errorf("decompress capture: %w", err)
+	}
+	return capture.Validate(dr), nil
+}
+
+// ValidateCapture handles POST /api/v1/captures/validate
+// It checks the uploaded capture, gzipped or not, against the capture format
+// and returns the problems found along with summary counts. Nothing is
+// stored.
+func (h *Handler) ValidateCapture(c echo.Context) error {
+	r, err := captureUpload(c)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	report, err := validateCapture(r)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSONPretty(http.StatusOK, report, "\t")
+}
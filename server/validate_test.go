@@ -0,0 +1,159 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/OCAP2/web/capture"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// multipartCapture returns a multipart form holding fields and capture as
+// its file, and the form's content type.
+func multipartCapture(t *testing.T, fields map[string]string, capture string) (*bytes.Buffer, string) {
+	t.Helper()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for k, v := range fields {
+		require.NoError(t, w.WriteField(k, v))
+	}
+	fw, err := w.CreateFormFile("file", "capture.json")
+	require.NoError(t, err)
+	_, err = fw.Write([]byte(capture))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return &body, w.FormDataContentType()
+}
+
+const invalidCapture = `{
+	"worldName": "Altis",
+	"missionName": "Op Broken",
+	"endFrame": 10,
+	"captureDelay": 1,
+	"entities": [
+		{"type": "unit", "id": 0, "name": "Alpha", "side": "WEST", "isPlayer": 1, "startFrameNum": 0},
+		{"type": "unit", "id": 1, "name": "Bravo", "side": "EAST", "isPlayer": 1, "startFrameNum": 0, "positions": [[[1, 1], 0, 1, 0, "Bravo", 1]]}
+	],
+	"events": [
+		[5, "killed", 1, [7, "MX"], 10],
+		[3, "hit", 0, [1, "AK-12"], 10],
+		[4, "respawnTickets", [10, 10]]
+	]
+}`
+
+func TestValidateCapture(t *testing.T) {
+	e := echo.New()
+	h := Handler{}
+
+	var gzBody bytes.Buffer
+	gz := gzip.NewWriter(&gzBody)
+	_, err := gz.Write([]byte(testCapture))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/captures/validate", &gzBody)
+	rec := httptest.NewRecorder()
+	require.NoError(t, h.ValidateCapture(e.NewContext(req, rec)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var report capture.Report
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Empty(t, report.Problems)
+	assert.Equal(t, 7, report.Info.Entities)
+	assert.Equal(t, 2, report.Info.Vehicles)
+	assert.Equal(t, 8, report.Info.EventTypes["killed"])
+	assert.Equal(t, 2, report.Info.Markers)
+	// Units without positions only warrant a warning.
+	assert.NotEmpty(t, report.Warnings)
+
+	body, contentType := multipartCapture(t, nil, invalidCapture)
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/captures/validate", body)
+	req.Header.Set(echo.HeaderContentType, contentType)
+	rec = httptest.NewRecorder()
+	require.NoError(t, h.ValidateCapture(e.NewContext(req, rec)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	report = capture.Report{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	problems := make(map[string]string)
+	for _, p := range report.Problems {
+		problems[p.Path] = p.Message
+	}
+	assert.Equal(t, "is missing", problems["entities[0].positions"])
+	assert.Equal(t, "unknown entity 7", problems["events[0][3]"])
+	assert.Equal(t, "frame 3 is before the previous event's frame 5", problems["events[1][0]"])
+	require.Len(t, report.Warnings, 1)
+	assert.Equal(t, "events[2][1]", report.Warnings[0].Path)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/captures/validate", nil)
+	err = h.ValidateCapture(e.NewContext(req, httptest.NewRecorder()))
+	assert.ErrorIs(t, err, echo.ErrBadRequest)
+
+	// A broken gzip stream is reported as such.
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/captures/validate", strings.NewReader("\x1f\x8bnot gzip"))
+	err = h.ValidateCapture(e.NewContext(req, httptest.NewRecorder()))
+	var he *echo.HTTPError
+	require.ErrorAs(t, err, &he)
+	assert.Equal(t, http.StatusBadRequest, he.Code)
+	assert.Contains(t, he.Message, "decompress capture")
+}
+
+func TestStoreOperationValidation(t *testing.T) {
+	dir := t.TempDir()
+	e := echo.New()
+	h := Handler{setting: Setting{Data: dir, Secret: "secret", ValidateUploads: true}}
+
+	fields := map[string]string{
+		"secret":          "secret",
+		"filename":        "op",
+		"worldName":       "Altis",
+		"missionName":     "Op Broken",
+		"missionDuration": "10",
+	}
+
+	// Invalid captures are rejected before anything is stored.
+	body, contentType := multipartCapture(t, fields, invalidCapture)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/operations/add", body)
+	req.Header.Set(echo.HeaderContentType, contentType)
+	rec := httptest.NewRecorder()
+	require.NoError(t, h.StoreOperation(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.NoFileExists(t, filepath.Join(dir, "op.gz"))
+
+	// A broken duration is reported once the capture is valid.
+	fields["missionDuration"] = "ten"
+	body, contentType = multipartCapture(t, fields, testCapture)
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/operations/add", body)
+	req.Header.Set(echo.HeaderContentType, contentType)
+	err := h.StoreOperation(e.NewContext(req, httptest.NewRecorder()))
+	var he *echo.HTTPError
+	require.ErrorAs(t, err, &he)
+	assert.Equal(t, http.StatusBadRequest, he.Code)
+	assert.NoFileExists(t, filepath.Join(dir, "op.gz"))
+
+	// A dry run reports on a valid capture without storing it either, and
+	// needs no duration.
+	delete(fields, "missionDuration")
+	fields["dryRun"] = "true"
+	body, contentType = multipartCapture(t, fields, testCapture)
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/operations/add", body)
+	req.Header.Set(echo.HeaderContentType, contentType)
+	rec = httptest.NewRecorder()
+	require.NoError(t, h.StoreOperation(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoFileExists(t, filepath.Join(dir, "op.gz"))
+
+	var report capture.Report
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.True(t, report.Valid())
+}
@@ -0,0 +1,251 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/OCAP2/web/capture"
+	"github.com/labstack/echo/v4"
+)
+
+// unknownSide is reported for vehicles destroyed by nothing identifiable.
+const unknownSide = "UNKNOWN"
+
+// VehicleClassStat holds statistics for one vehicle class. Kills counts kills
+// scored by any crew member, or by the vehicle itself; CrewMinutes and
+// Players only count player crew. Operations is only set across captures.
+type VehicleClassStat struct {
+	Class       string  `json:"class"`
+	Operations  int     `json:"operations,omitempty"`
+	Vehicles    int     `json:"vehicles"`
+	Destroyed   int     `json:"destroyed"`
+	Kills       int     `json:"kills"`
+	CrewMinutes float64 `json:"crew_minutes"`
+	Players     int     `json:"players"`
+
+	players map[string]bool
+}
+
+// PlayerVehicleStat holds the time a player spent crewing one vehicle class
+// and the kills they scored while doing so.
+type PlayerVehicleStat struct {
+	Class   string  `json:"class"`
+	Minutes float64 `json:"minutes"`
+	Kills   int     `json:"kills"`
+}
+
+// SideCount counts something per side.
+type SideCount struct {
+	Side  string `json:"side"`
+	Count int    `json:"count"`
+}
+
+// VehicleReport is the output of the vehicle endpoints. Classes are sorted by
+// player crew time, so the most used come first.
+type VehicleReport struct {
+	Classes         []VehicleClassStat `json:"classes"`
+	DestroyedBySide []SideCount        `json:"destroyed_by_side"`
+}
+
+// vehicleTally accumulates vehicle statistics, per capture or across them.
+type vehicleTally struct {
+	classes   map[string]*VehicleClassStat
+	destroyed map[string]int // killer side -> vehicles destroyed
+}
+
+func newVehicleTally() *vehicleTally {
+	return &vehicleTally{
+		classes:   make(map[string]*VehicleClassStat),
+		destroyed: make(map[string]int),
+	}
+}
+
+func (t *vehicleTally) class(name string) *VehicleClassStat {
+	c, ok := t.classes[name]
+	if !ok {
+		c = &VehicleClassStat{Class: name, players: make(map[string]bool)}
+		t.classes[name] = c
+	}
+	return c
+}
+
+// add merges the vehicle report of one capture into t.
+func (t *vehicleTally) add(r *VehicleReport, players []PlayerEventSummary) {
+	for _, rc := range r.Classes {
+		c := t.class(rc.Class)
+		c.Operations++
+		c.Vehicles += rc.Vehicles
+		c.Destroyed += rc.Destroyed
+		c.Kills += rc.Kills
+		c.CrewMinutes += rc.CrewMinutes
+	}
+	for _, sc := range r.DestroyedBySide {
+		t.destroyed[sc.Side] += sc.Count
+	}
+	for i := range players {
+		for _, v := range players[i].Vehicles {
+			t.class(v.Class).players[players[i].Name] = true
+		}
+	}
+}
+
+// report converts t into a sorted report.
+func (t *vehicleTally) report() VehicleReport {
+	r := VehicleReport{
+		Classes:         make([]VehicleClassStat, 0, len(t.classes)),
+		DestroyedBySide: make([]SideCount, 0, len(t.destroyed)),
+	}
+
+	for _, c := range t.classes {
+		c.Players = len(c.players)
+		r.Classes = append(r.Classes, *c)
+	}
+	sort.Slice(r.Classes, func(i, j int) bool {
+		a, b := r.Classes[i], r.Classes[j]
+		if a.CrewMinutes != b.CrewMinutes {
+			return a.CrewMinutes > b.CrewMinutes
+		}
+		if a.Vehicles != b.Vehicles {
+			return a.Vehicles > b.Vehicles
+		}
+		return a.Class < b.Class
+	})
+
+	for side, n := range t.destroyed {
+		r.DestroyedBySide = append(r.DestroyedBySide, SideCount{Side: side, Count: n})
+	}
+	sort.Slice(r.DestroyedBySide, func(i, j int) bool {
+		if r.DestroyedBySide[i].Count != r.DestroyedBySide[j].Count {
+			return r.DestroyedBySide[i].Count > r.DestroyedBySide[j].Count
+		}
+		return r.DestroyedBySide[i].Side < r.DestroyedBySide[j].Side
+	})
+
+	return r
+}
+
+// onVehicle records a vehicle entity and the crew runs read from its
+// positions.
+func (cp *captureParser) onVehicle(e capture.Entity, crew []crewRun) {
+	cp.vehicles.class(e.Class).Vehicles++
+	for _, run := range crew {
+		cp.crewRuns[run.Unit] = append(cp.crewRuns[run.Unit], run)
+	}
+}
+
+// vehicleAt returns the vehicle unit was crewing at frame, if any.
+func (cp *captureParser) vehicleAt(unit, frame int) (capture.Entity, bool) {
+	for _, run := range cp.crewRuns[unit] {
+		if run.Start <= frame && frame < run.End {
+			v, ok := cp.entities[run.Vehicle]
+			return v, ok
+		}
+	}
+	return capture.Entity{}, false
+}
+
+// onVehicleKill records destroyed vehicles and kills scored by vehicles or
+// their crews.
+func (cp *captureParser) onVehicleKill(ev hitKilledEvent, killerMeta, victimMeta capture.Entity, killerKnown bool) {
+	if victimMeta.Type == "vehicle" {
+		cp.vehicles.class(victimMeta.Class).Destroyed++
+
+		side := unknownSide
+		if killerKnown && killerMeta.Type == "unit" && killerMeta.Side != "" {
+			side = killerMeta.Side
+		}
+		cp.vehicles.destroyed[side]++
+	}
+
+	if !killerKnown || ev.CausedByID == ev.VictimID {
+		return
+	}
+
+	if killerMeta.Type == "vehicle" {
+		cp.vehicles.class(killerMeta.Class).Kills++
+		return
+	}
+
+	vehicle, ok := cp.vehicleAt(ev.CausedByID, ev.Frame)
+	if !ok {
+		return
+	}
+	cp.vehicles.class(vehicle.Class).Kills++
+	if p, ok := cp.players[ev.CausedByID]; ok {
+		p.vehicle(vehicle.Class).Kills++
+	}
+}
+
+// vehicle returns the crew entry for the named vehicle class, creating it if
+// needed.
+func (p *playerAcc) vehicle(class string) *PlayerVehicleStat {
+	v, ok := p.vehicleMap[class]
+	if !ok {
+		v = &PlayerVehicleStat{Class: class}
+		p.vehicleMap[class] = v
+	}
+	return v
+}
+
+// applyCrewTime adds the time each player spent crewing vehicles to both the
+// player and the vehicle class.
+func (cp *captureParser) applyCrewTime() {
+	for id, p := range cp.players {
+		for _, run := range cp.crewRuns[id] {
+			vehicle, ok := cp.entities[run.Vehicle]
+			if !ok {
+				continue
+			}
+			minutes := float64(run.End-run.Start) * cp.stats.CaptureDelay / 60
+			p.vehicle(vehicle.Class).Minutes += minutes
+
+			c := cp.vehicles.class(vehicle.Class)
+			c.CrewMinutes += minutes
+			c.players[p.Name] = true
+		}
+	}
+}
+
+// vehicleStatSlice converts a player's vehicle map into a slice, most used
+// first.
+func vehicleStatSlice(vehicleMap map[string]*PlayerVehicleStat) []PlayerVehicleStat {
+	vs := make([]PlayerVehicleStat, 0, len(vehicleMap))
+	for _, v := range vehicleMap {
+		vs = append(vs, *v)
+	}
+	sort.Slice(vs, func(i, j int) bool {
+		if vs[i].Minutes != vs[j].Minutes {
+			return vs[i].Minutes > vs[j].Minutes
+		}
+		return vs[i].Class < vs[j].Class
+	})
+	return vs
+}
+
+// GetVehicleStats handles GET /api/v1/vehicles
+// It returns vehicle class usage and losses across all captures.
+func (h *Handler) GetVehicleStats(c echo.Context) error {
+	report, err := h.playerCache.GetVehicles()
+	if err != nil {
+		return fmt.Errorf("process vehicle stats: %w", err)
+	}
+
+	return c.JSONPretty(http.StatusOK, report, "\t")
+}
+
+// GetCaptureVehicleStats handles GET /api/v1/captures/:name/vehicles
+// It returns vehicle class usage and losses in a single capture.
+func (h *Handler) GetCaptureVehicleStats(c echo.Context) error {
+	path, err := h.capturePath(c)
+	if err != nil {
+		return err
+	}
+
+	stats, err := processCapture(path)
+	if err != nil {
+		return fmt.Errorf("process vehicle stats: %w", err)
+	}
+
+	return c.JSONPretty(http.StatusOK, stats.Vehicles, "\t")
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVehicleStats(t *testing.T) {
+	stats := processFixture(t, `{
+		"worldName": "Altis", "missionName": "Op", "endFrame": 30, "captureDelay": 1,
+		"entities": [
+			{"type": "unit", "id": 0, "name": "Alpha", "side": "WEST", "isPlayer": 1, "startFrameNum": 0},
+			{"type": "unit", "id": 1, "name": "Bravo", "side": "EAST", "isPlayer": 1, "startFrameNum": 0},
+			{"type": "vehicle", "id": 2, "name": "Hunter", "class": "car", "startFrameNum": 10,
+				"positions": [[[0, 0, 0], 0, 1, [0]], [[0, 0, 0], 0, 1, [0]], [[0, 0, 0], 0, 1, []], [[0, 0, 0], 0, 1, [0]]]},
+			{"type": "vehicle", "id": 3, "name": "Ghosthawk", "class": "heli", "startFrameNum": 0,
+				"positions": [[[0, 0, 0], 0, 1, [1], [0, 4]], [[0, 0, 0], 0, 1, [1], [5, 9]]]},
+			{"type": "vehicle", "id": 4, "name": "Slammer", "class": "tank", "startFrameNum": 0, "positions": []}
+		],
+		"events": [
+			[11, "killed", 1, [0, "M2"], 50],
+			[13, "killed", 0, [0, "M2"], 0],
+			[20, "killed", 4, [1, "Titan"], 300],
+			[21, "killed", 3, [4, "Cannon"], 100],
+			[22, "killed", 2, ["null"], 0]
+		]
+	}`)
+
+	// Alpha crewed the car twice, with relative frames; Bravo's ranged
+	// positions join into one run in absolute frames.
+	carMinutes := 2.0 / 60
+	carMinutes += 1.0 / 60
+	heliMinutes := 10.0 / 60
+
+	require.Len(t, stats.Vehicles.Classes, 3)
+	// The suicide in the car is not a kill of the car; a vehicle killing
+	// counts for its own class.
+	assert.Equal(t, VehicleClassStat{Class: "heli", Vehicles: 1, Destroyed: 1, CrewMinutes: heliMinutes, Players: 1}, withoutPlayers(stats.Vehicles.Classes[0]))
+	assert.Equal(t, VehicleClassStat{Class: "car", Vehicles: 1, Destroyed: 1, Kills: 1, CrewMinutes: carMinutes, Players: 1}, withoutPlayers(stats.Vehicles.Classes[1]))
+	assert.Equal(t, VehicleClassStat{Class: "tank", Vehicles: 1, Destroyed: 1, Kills: 1}, withoutPlayers(stats.Vehicles.Classes[2]))
+
+	// Vehicles destroyed by vehicles or by nothing have no side.
+	assert.Equal(t, []SideCount{{Side: unknownSide, Count: 2}, {Side: "EAST", Count: 1}}, stats.Vehicles.DestroyedBySide)
+
+	// Bravo was out of the helicopter when destroying the tank.
+	alpha := playerByName(stats.Players, "Alpha")
+	require.NotNil(t, alpha)
+	assert.Equal(t, []PlayerVehicleStat{{Class: "car", Minutes: carMinutes, Kills: 1}}, alpha.Vehicles)
+	bravo := playerByName(stats.Players, "Bravo")
+	require.NotNil(t, bravo)
+	assert.Equal(t, []PlayerVehicleStat{{Class: "heli", Minutes: heliMinutes}}, bravo.Vehicles)
+}
+
+func TestVehicleTally(t *testing.T) {
+	tally := newVehicleTally()
+	tally.add(&VehicleReport{
+		Classes:         []VehicleClassStat{{Class: "car", Vehicles: 2, Destroyed: 1, Kills: 1, CrewMinutes: 1}},
+		DestroyedBySide: []SideCount{{Side: "EAST", Count: 1}},
+	}, []PlayerEventSummary{{Name: "Alpha", Vehicles: []PlayerVehicleStat{{Class: "car", Minutes: 1}}}})
+	tally.add(&VehicleReport{
+		Classes:         []VehicleClassStat{{Class: "car", Vehicles: 1, CrewMinutes: 2}, {Class: "heli", Vehicles: 1, Destroyed: 1}},
+		DestroyedBySide: []SideCount{{Side: "EAST", Count: 1}, {Side: "WEST", Count: 1}},
+	}, []PlayerEventSummary{
+		{Name: "Alpha", Vehicles: []PlayerVehicleStat{{Class: "car", Minutes: 1}}},
+		{Name: "Bravo", Vehicles: []PlayerVehicleStat{{Class: "car", Minutes: 1}}},
+	})
+
+	report := tally.report()
+	require.Len(t, report.Classes, 2)
+	// Players are counted once across captures.
+	assert.Equal(t, VehicleClassStat{Class: "car", Operations: 2, Vehicles: 3, Destroyed: 1, Kills: 1, CrewMinutes: 3, Players: 2}, withoutPlayers(report.Classes[0]))
+	assert.Equal(t, VehicleClassStat{Class: "heli", Operations: 1, Vehicles: 1, Destroyed: 1}, withoutPlayers(report.Classes[1]))
+	assert.Equal(t, []SideCount{{Side: "EAST", Count: 2}, {Side: "WEST", Count: 1}}, report.DestroyedBySide)
+}
+
+// withoutPlayers clears the unexported player set so stats can be compared.
+func withoutPlayers(c VehicleClassStat) VehicleClassStat {
+	c.players = nil
+	return c
+}